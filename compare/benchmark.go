@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"runtime"
 	"time"
@@ -116,10 +115,9 @@ func (cf *ComparisonFramework) benchmarkEBE(data interface{}) BenchmarkMeasureme
 	var memStats1, memStats2 runtime.MemStats
 	runtime.ReadMemStats(&memStats1)
 
-	var buf bytes.Buffer
 	start := time.Now()
 	
-	err := serialize.Serialize(data, &buf)
+	serialized, err := serialize.Marshal(data)
 	if err != nil {
 		panic(fmt.Sprintf("EBE serialization failed: %v", err))
 	}
@@ -128,7 +126,7 @@ func (cf *ComparisonFramework) benchmarkEBE(data interface{}) BenchmarkMeasureme
 	runtime.ReadMemStats(&memStats2)
 
 	return BenchmarkMeasurement{
-		Size:   buf.Len(),
+		Size:   len(serialized),
 		Time:   elapsed,
 		Memory: int64(memStats2.TotalAlloc - memStats1.TotalAlloc),
 	}
@@ -169,6 +169,26 @@ func runCollectionTests(framework *ComparisonFramework, testData *TestData, verb
 	} else {
 		printCompactResult(result)
 	}
+
+	// Nested arrays test
+	nestedTest := SerializationTest{
+		Name: "Nested Arrays",
+		EBEData: struct {
+			NestedIntArray [][]int32
+		}{
+			NestedIntArray: testData.Collections.NestedIntArray,
+		},
+		PBData: &testdata.CollectionTypes{
+			NestedIntArray: ConvertCollections(testData.Collections).NestedIntArray,
+		},
+	}
+
+	result = framework.RunComparison(nestedTest)
+	if verbose {
+		framework.PrintResult(result)
+	} else {
+		printCompactResult(result)
+	}
 }
 
 // runComplexTests runs tests for complex nested structures
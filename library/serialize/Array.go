@@ -5,243 +5,229 @@ import (
 	"ebe/utils"
 	"fmt"
 	"io"
+	"math/bits"
 	"reflect"
+	"time"
 )
 
-// This function appends the serialized array to the existing writer
-func serializeArray(rv reflect.Value, w io.Writer) error {
+// appendArray appends the serialized array to dst
+func appendArray(dst []byte, rv reflect.Value) ([]byte, error) {
 
 	var length = rv.Len()
 
 	// Determine the element type from the array's declared type
-	elemType := rv.Type().Elem()
-	elementType, err := typeCache.GetEBEType(elemType)
+	elementType, err := typeCache.GetElementType(rv.Type())
 	if err != nil {
-		return fmt.Errorf("unsupported array element type: %w", err)
+		return dst, fmt.Errorf("unsupported array element type: %w", err)
 	}
 
-	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
+	// Elements of plain numeric types are packed when that is smaller
+	elemType := rv.Type().Elem()
+	if isPackable(elementType) && (isNumericKind(elemType.Kind()) || elemType.Kind() == reflect.Bool) && elemType.NumMethod() == 0 {
+		switch elementType {
+		case types.Boolean:
+			return appendBoolElements(dst, length, func(i int) bool { return rv.Index(i).Bool() }), nil
+		case types.SInt:
+			return appendSintElements(dst, length, func(i int) int64 { return rv.Index(i).Int() }), nil
+		case types.UInt:
+			return appendUintElements(dst, length, func(i int) uint64 { return rv.Index(i).Uint() }), nil
+		default:
+			return appendFloatElements(dst, length, func(i int) float64 { return rv.Index(i).Float() }, 0, nil), nil
+		}
 	}
 
+	// Write the array header
+	dst = appendArrayHeader(dst, length, elementType)
+
 	// Serialize each element with their normal headers
 	for i := range length {
 		element := rv.Index(i).Interface()
-		if err := Serialize(element, w); err != nil {
-			return fmt.Errorf("failed to serialize array element %d: %w", i, err)
+		if dst, err = appendDeclaredValue(dst, element, elemType); err != nil {
+			return dst, fmt.Errorf("failed to serialize array element %d: %w", i, err)
 		}
 	}
 
-	return nil
+	return dst, nil
 }
 
 // Fast path serialization for integer arrays - avoids reflection overhead
-func serializeIntArray(arr interface{}, w io.Writer) error {
+func appendIntArray(dst []byte, arr interface{}) ([]byte, error) {
 	var length int
-	var elementType types.Types
 
 	// Handle different integer slice types
 	switch v := arr.(type) {
 	case []int:
 		length = len(v)
-		elementType = types.SInt
 	case []int32:
 		length = len(v)
-		elementType = types.SInt
 	case []int64:
 		length = len(v)
-		elementType = types.SInt
 	case []int8:
 		length = len(v)
-		elementType = types.SInt
 	case []int16:
 		length = len(v)
-		elementType = types.SInt
 	default:
-		return fmt.Errorf("unsupported integer array type: %T", arr)
+		return dst, fmt.Errorf("unsupported integer array type: %T", arr)
 	}
 
-	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
+	// A nil slice is written as Null so it decodes back to nil rather than an empty slice
+	if length == 0 && reflect.ValueOf(arr).IsNil() {
+		return appendNull(dst), nil
 	}
 
-	// Serialize each element directly without reflection
+	// Serialize the elements directly without reflection, packed if that is smaller
 	switch v := arr.(type) {
 	case []int:
-		for _, elem := range v {
-			if err := serializeSint(int64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize int element: %w", err)
-			}
-		}
+		return appendSintElements(dst, length, func(i int) int64 { return int64(v[i]) }), nil
 	case []int32:
-		for _, elem := range v {
-			if err := serializeSint(int64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize int32 element: %w", err)
-			}
-		}
+		return appendSintElements(dst, length, func(i int) int64 { return int64(v[i]) }), nil
 	case []int64:
-		for _, elem := range v {
-			if err := serializeSint(elem, w); err != nil {
-				return fmt.Errorf("failed to serialize int64 element: %w", err)
-			}
-		}
+		return appendSintElements(dst, length, func(i int) int64 { return v[i] }), nil
 	case []int8:
-		for _, elem := range v {
-			if err := serializeSint(int64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize int8 element: %w", err)
-			}
-		}
-	case []int16:
-		for _, elem := range v {
-			if err := serializeSint(int64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize int16 element: %w", err)
-			}
-		}
+		return appendSintElements(dst, length, func(i int) int64 { return int64(v[i]) }), nil
+	default:
+		v16 := v.([]int16)
+		return appendSintElements(dst, length, func(i int) int64 { return int64(v16[i]) }), nil
 	}
-
-	return nil
 }
 
 // Fast path serialization for unsigned integer arrays - avoids reflection overhead
-func serializeUintArray(arr interface{}, w io.Writer) error {
+func appendUintArray(dst []byte, arr interface{}) ([]byte, error) {
 	var length int
-	var elementType types.Types
 
 	// Handle different unsigned integer slice types
 	switch v := arr.(type) {
 	case []uint:
 		length = len(v)
-		elementType = types.UInt
 	case []uint32:
 		length = len(v)
-		elementType = types.UInt
 	case []uint64:
 		length = len(v)
-		elementType = types.UInt
 	case []uint16:
 		length = len(v)
-		elementType = types.UInt
 	default:
-		return fmt.Errorf("unsupported unsigned integer array type: %T", arr)
+		return dst, fmt.Errorf("unsupported unsigned integer array type: %T", arr)
 	}
 
-	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
+	// A nil slice is written as Null so it decodes back to nil rather than an empty slice
+	if length == 0 && reflect.ValueOf(arr).IsNil() {
+		return appendNull(dst), nil
 	}
 
-	// Serialize each element directly without reflection
+	// Serialize the elements directly without reflection, packed if that is smaller
 	switch v := arr.(type) {
 	case []uint:
-		for _, elem := range v {
-			if err := serializeUint(uint64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize uint element: %w", err)
-			}
-		}
+		return appendUintElements(dst, length, func(i int) uint64 { return uint64(v[i]) }), nil
 	case []uint32:
-		for _, elem := range v {
-			if err := serializeUint(uint64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize uint32 element: %w", err)
-			}
-		}
+		return appendUintElements(dst, length, func(i int) uint64 { return uint64(v[i]) }), nil
 	case []uint64:
-		for _, elem := range v {
-			if err := serializeUint(elem, w); err != nil {
-				return fmt.Errorf("failed to serialize uint64 element: %w", err)
-			}
-		}
-	case []uint16:
-		for _, elem := range v {
-			if err := serializeUint(uint64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize uint16 element: %w", err)
-			}
-		}
+		return appendUintElements(dst, length, func(i int) uint64 { return v[i] }), nil
+	default:
+		v16 := v.([]uint16)
+		return appendUintElements(dst, length, func(i int) uint64 { return uint64(v16[i]) }), nil
 	}
-
-	return nil
 }
 
 // Fast path serialization for float arrays - avoids reflection overhead
-func serializeFloatArray(arr interface{}, w io.Writer) error {
+func appendFloatArray(dst []byte, arr interface{}) ([]byte, error) {
 	var length int
-	var elementType types.Types
 
 	// Handle different float slice types
 	switch v := arr.(type) {
 	case []float32:
 		length = len(v)
-		elementType = types.Float
 	case []float64:
 		length = len(v)
-		elementType = types.Float
 	default:
-		return fmt.Errorf("unsupported float array type: %T", arr)
+		return dst, fmt.Errorf("unsupported float array type: %T", arr)
 	}
 
-	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
+	// A nil slice is written as Null so it decodes back to nil rather than an empty slice
+	if length == 0 && reflect.ValueOf(arr).IsNil() {
+		return appendNull(dst), nil
 	}
 
-	// Serialize each element directly without reflection
+	// Serialize the elements directly without reflection, packed if that is smaller
+	// Packed elements of the slice's own width are copied in bulk
 	switch v := arr.(type) {
 	case []float32:
+		return appendFloatElements(dst, length, func(i int) float64 { return float64(v[i]) },
+			4, func(dst []byte) []byte { return appendFloat32s(dst, v) }), nil
+	default:
+		v64 := v.([]float64)
+		return appendFloatElements(dst, length, func(i int) float64 { return v64[i] },
+			8, func(dst []byte) []byte { return appendFloat64s(dst, v64) }), nil
+	}
+}
+
+// Fast path serialization for complex arrays - avoids reflection overhead
+func appendComplexArray(dst []byte, arr interface{}) ([]byte, error) {
+	var length int
+	var elementType types.Types
+
+	// Handle different complex slice types
+	switch v := arr.(type) {
+	case []complex64:
+		length = len(v)
+		elementType = types.Complex
+	case []complex128:
+		length = len(v)
+		elementType = types.Complex
+	default:
+		return dst, fmt.Errorf("unsupported complex array type: %T", arr)
+	}
+
+	// A nil slice is written as Null so it decodes back to nil rather than an empty slice
+	if length == 0 && reflect.ValueOf(arr).IsNil() {
+		return appendNull(dst), nil
+	}
+
+	// Write the array header
+	dst = appendArrayHeader(dst, length, elementType)
+
+	// Serialize each element directly without reflection
+	switch v := arr.(type) {
+	case []complex64:
 		for _, elem := range v {
-			if err := serializeFloat(float64(elem), w); err != nil {
-				return fmt.Errorf("failed to serialize float32 element: %w", err)
-			}
+			dst = appendComplex(dst, complex128(elem))
 		}
-	case []float64:
+	case []complex128:
 		for _, elem := range v {
-			if err := serializeFloat(elem, w); err != nil {
-				return fmt.Errorf("failed to serialize float64 element: %w", err)
-			}
+			dst = appendComplex(dst, elem)
 		}
 	}
 
-	return nil
+	return dst, nil
 }
 
 // Fast path serialization for string arrays - avoids reflection overhead
-func serializeStringArray(arr []string, w io.Writer) error {
+func appendStringArray(dst []byte, arr []string) []byte {
+	if arr == nil {
+		return appendNull(dst)
+	}
+
 	length := len(arr)
 	elementType := types.String
 
 	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
-	}
+	dst = appendArrayHeader(dst, length, elementType)
 
 	// Serialize each string element directly without reflection
 	for _, elem := range arr {
-		if err := serializeString(elem, w); err != nil {
-			return fmt.Errorf("failed to serialize string element: %w", err)
-		}
+		dst = appendString(dst, elem)
 	}
 
-	return nil
+	return dst
 }
 
 // Fast path serialization for boolean arrays - avoids reflection overhead
-func serializeBoolArray(arr []bool, w io.Writer) error {
-	length := len(arr)
-	elementType := types.Boolean
-
-	// Write the array header
-	if err := writeArrayHeader(w, length, elementType); err != nil {
-		return err
+func appendBoolArray(dst []byte, arr []bool) []byte {
+	if arr == nil {
+		return appendNull(dst)
 	}
 
-	// Serialize each boolean element directly without reflection
-	for _, elem := range arr {
-		if err := serializeBoolean(elem, w); err != nil {
-			return fmt.Errorf("failed to serialize bool element: %w", err)
-		}
-	}
-
-	return nil
+	// Serialize the elements directly without reflection, as bits unless the array is very short
+	return appendBoolElements(dst, len(arr), func(i int) bool { return arr[i] })
 }
 
 func deserializeArray(r io.Reader, header byte, out interface{}) error {
@@ -253,6 +239,8 @@ func deserializeArray(r io.Reader, header byte, out interface{}) error {
 		return deserializeUintArray(r, header, out)
 	case *[]float32, *[]float64:
 		return deserializeFloatArray(r, header, out)
+	case *[]complex64, *[]complex128:
+		return deserializeComplexArray(r, header, out)
 	case *[]string:
 		return deserializeStringArray(r, header, out)
 	case *[]bool:
@@ -266,34 +254,50 @@ func deserializeArray(r io.Reader, header byte, out interface{}) error {
 // deserializeIntArray performs deserialization for integer arrays
 func deserializeIntArray(r io.Reader, header byte, out interface{}) error {
 	// Read array header and length
-	length, elementType, err := readArrayHeader(r, header)
+	start := headerOffset(r)
+	length, elementType, packing, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
 
 	// Verify element type is SInt
 	if elementType != types.SInt {
-		return fmt.Errorf("expected SInt element type, got %v", types.TypeName(elementType))
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
+	}
+	if packing.packed {
+		return deserializePackedIntArray(r, length, packing, out)
 	}
 
 	// Type switch to handle different integer slice types
+	strict := !isLenient(r)
 	switch ptr := out.(type) {
 	case *[]int:
 		*ptr = make([]int, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeInt64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize int element %d: %w", i, err)
 			}
+			if strict && overflowsInt(elem, bits.UintSize) {
+				return elementOverflow(elem, reflect.TypeOf(int(0)), i, at)
+			}
 			(*ptr)[i] = int(elem)
 		}
 	case *[]int32:
 		*ptr = make([]int32, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeInt64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize int32 element %d: %w", i, err)
 			}
+			if strict && overflowsInt(elem, 32) {
+				return elementOverflow(elem, reflect.TypeOf(int32(0)), i, at)
+			}
 			(*ptr)[i] = int32(elem)
 		}
 	case *[]int64:
@@ -308,19 +312,27 @@ func deserializeIntArray(r io.Reader, header byte, out interface{}) error {
 	case *[]int8:
 		*ptr = make([]int8, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeInt64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize int8 element %d: %w", i, err)
 			}
+			if strict && overflowsInt(elem, 8) {
+				return elementOverflow(elem, reflect.TypeOf(int8(0)), i, at)
+			}
 			(*ptr)[i] = int8(elem)
 		}
 	case *[]int16:
 		*ptr = make([]int16, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeInt64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize int16 element %d: %w", i, err)
 			}
+			if strict && overflowsInt(elem, 16) {
+				return elementOverflow(elem, reflect.TypeOf(int16(0)), i, at)
+			}
 			(*ptr)[i] = int16(elem)
 		}
 	default:
@@ -333,34 +345,50 @@ func deserializeIntArray(r io.Reader, header byte, out interface{}) error {
 // deserializeUintArray performs deserialization for unsigned integer arrays
 func deserializeUintArray(r io.Reader, header byte, out interface{}) error {
 	// Read array header and length
-	length, elementType, err := readArrayHeader(r, header)
+	start := headerOffset(r)
+	length, elementType, packing, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
 
 	// Verify element type is UInt
 	if elementType != types.UInt {
-		return fmt.Errorf("expected UInt element type, got %v", types.TypeName(elementType))
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
+	}
+	if packing.packed {
+		return deserializePackedUintArray(r, length, packing, out)
 	}
 
 	// Type switch to handle different unsigned integer slice types
+	strict := !isLenient(r)
 	switch ptr := out.(type) {
 	case *[]uint:
 		*ptr = make([]uint, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeUint64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize uint element %d: %w", i, err)
 			}
+			if strict && overflowsUint(elem, bits.UintSize) {
+				return elementOverflow(elem, reflect.TypeOf(uint(0)), i, at)
+			}
 			(*ptr)[i] = uint(elem)
 		}
 	case *[]uint32:
 		*ptr = make([]uint32, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeUint64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize uint32 element %d: %w", i, err)
 			}
+			if strict && overflowsUint(elem, 32) {
+				return elementOverflow(elem, reflect.TypeOf(uint32(0)), i, at)
+			}
 			(*ptr)[i] = uint32(elem)
 		}
 	case *[]uint64:
@@ -375,10 +403,14 @@ func deserializeUintArray(r io.Reader, header byte, out interface{}) error {
 	case *[]uint16:
 		*ptr = make([]uint16, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeUint64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize uint16 element %d: %w", i, err)
 			}
+			if strict && overflowsUint(elem, 16) {
+				return elementOverflow(elem, reflect.TypeOf(uint16(0)), i, at)
+			}
 			(*ptr)[i] = uint16(elem)
 		}
 	default:
@@ -391,25 +423,37 @@ func deserializeUintArray(r io.Reader, header byte, out interface{}) error {
 // deserializeFloatArray performs deserialization for float arrays
 func deserializeFloatArray(r io.Reader, header byte, out interface{}) error {
 	// Read array header and length
-	length, elementType, err := readArrayHeader(r, header)
+	start := headerOffset(r)
+	length, elementType, packing, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
 
 	// Verify element type is Float
 	if elementType != types.Float {
-		return fmt.Errorf("expected Float element type, got %v", types.TypeName(elementType))
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
+	}
+	if packing.packed {
+		return deserializePackedFloatArray(r, length, packing, out)
 	}
 
 	// Type switch to handle different float slice types
+	strict := !isLenient(r)
 	switch ptr := out.(type) {
 	case *[]float32:
 		*ptr = make([]float32, length)
 		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
 			elem, err := deserializeFloat64(r)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize float32 element %d: %w", i, err)
 			}
+			if strict && overflowsFloat32(elem) {
+				return elementOverflow(elem, reflect.TypeOf(float32(0)), i, at)
+			}
 			(*ptr)[i] = float32(elem)
 		}
 	case *[]float64:
@@ -428,17 +472,70 @@ func deserializeFloatArray(r io.Reader, header byte, out interface{}) error {
 	return nil
 }
 
+// deserializeComplexArray performs deserialization for complex arrays
+func deserializeComplexArray(r io.Reader, header byte, out interface{}) error {
+	// Read array header and length
+	start := headerOffset(r)
+	length, elementType, _, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
+	if err != nil {
+		return err
+	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
+
+	// Verify element type is Complex
+	if elementType != types.Complex {
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
+	}
+
+	// Type switch to handle different complex slice types
+	strict := !isLenient(r)
+	switch ptr := out.(type) {
+	case *[]complex64:
+		*ptr = make([]complex64, length)
+		for i := 0; i < int(length); i++ {
+			at := inputOffset(r)
+			elem, err := deserializeComplex128(r)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize complex64 element %d: %w", i, err)
+			}
+			if strict && (overflowsFloat32(real(elem)) || overflowsFloat32(imag(elem))) {
+				return elementOverflow(elem, reflect.TypeOf(complex64(0)), i, at)
+			}
+			(*ptr)[i] = complex64(elem)
+		}
+	case *[]complex128:
+		*ptr = make([]complex128, length)
+		for i := 0; i < int(length); i++ {
+			elem, err := deserializeComplex128(r)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize complex128 element %d: %w", i, err)
+			}
+			(*ptr)[i] = elem
+		}
+	default:
+		return fmt.Errorf("unsupported complex array type: %T", out)
+	}
+
+	return nil
+}
+
 // deserializeStringArray performs deserialization for string arrays
 func deserializeStringArray(r io.Reader, header byte, out interface{}) error {
 	// Read array header and length
-	length, elementType, err := readArrayHeader(r, header)
+	start := headerOffset(r)
+	length, elementType, _, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
 
 	// Verify element type is String
 	if elementType != types.String {
-		return fmt.Errorf("expected String element type, got %v", types.TypeName(elementType))
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
 	}
 
 	// Type switch to handle string slice
@@ -448,7 +545,7 @@ func deserializeStringArray(r io.Reader, header byte, out interface{}) error {
 		for i := 0; i < int(length); i++ {
 			elem, err := deserializeStringWithoutHeader(r)
 			if err != nil {
-				return fmt.Errorf("failed to deserialize string element %d: %w", i, err)
+				return withPath(r, fmt.Errorf("failed to deserialize string element %d: %w", i, err), indexSegment(i))
 			}
 			(*ptr)[i] = elem
 		}
@@ -462,20 +559,34 @@ func deserializeStringArray(r io.Reader, header byte, out interface{}) error {
 // deserializeBoolArray performs deserialization for boolean arrays
 func deserializeBoolArray(r io.Reader, header byte, out interface{}) error {
 	// Read array header and length
-	length, elementType, err := readArrayHeader(r, header)
+	start := headerOffset(r)
+	length, elementType, packing, err := readArrayHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, length, out); err != nil {
+		return err
+	}
 
 	// Verify element type is Boolean
 	if elementType != types.Boolean {
-		return fmt.Errorf("expected Boolean element type, got %v", types.TypeName(elementType))
+		return &TypeMismatchError{Wire: elementType, GoType: reflect.TypeOf(out).Elem(), Offset: start}
 	}
 
 	// Type switch to handle boolean slice
 	switch ptr := out.(type) {
 	case *[]bool:
 		*ptr = make([]bool, length)
+		if packing.packed {
+			p, err := newPackedReader(r, length, packing)
+			if err != nil {
+				return err
+			}
+			for i := range *ptr {
+				(*ptr)[i] = p.bool()
+			}
+			break
+		}
 		for i := 0; i < int(length); i++ {
 			header, err := utils.ReadByte(r)
 			if err != nil {
@@ -497,36 +608,7 @@ func deserializeBoolArray(r io.Reader, header byte, out interface{}) error {
 // deserializeArrayGeneric is the original reflection-based array deserialization
 func deserializeArrayGeneric(r io.Reader, header byte, out interface{}) error {
 
-	headerType := types.TypeFromHeader(header)
-	headerValue := types.ValueFromHeader(header)
-
-	if headerType != types.Array {
-		return fmt.Errorf("expected Array type, got %v", types.TypeName(headerType))
-	}
-
-	length := uint64(headerValue)
-
-	// If the 4th bit of the nibble is not set then this is a special cased array whose length fits in the length nibble
-	// Otherwise get the array length from integer in the next data type
-	if length&0x08 != 0 {
-
-		// Parse the length using deserializeUint64 directly from the reader
-		arrayLength, err := deserializeUintWithHeader(r)
-		if err != nil {
-			return fmt.Errorf("failed to deserialize array length: %w", err)
-		}
-		length = arrayLength
-	}
-
-	// Read the element type
-	elementTypeByte, err := utils.ReadByte(r)
-	if err != nil {
-		return fmt.Errorf("failed to read element type: %w", err)
-	}
-	elementType := types.Types(elementTypeByte)
-
-	// Validate element type (optional - could be used for type checking)
-	_ = elementType // Currently unused, but reserved for future type validation
+	start := headerOffset(r)
 
 	// Get the output value and validate it's a pointer to slice or array
 	outValue := reflect.ValueOf(out)
@@ -536,46 +618,116 @@ func deserializeArrayGeneric(r io.Reader, header byte, out interface{}) error {
 
 	outElem := outValue.Elem()
 	if outElem.Kind() != reflect.Slice && outElem.Kind() != reflect.Array {
-		return fmt.Errorf("output must be a pointer to slice or array")
+		return typeMismatchAt(start, header, outElem.Type())
+	}
+
+	length, elementType, packing, err := readArrayHeader(r, header, outElem.Type())
+	if err != nil {
+		return err
+	}
+
+	// The declared element type of a homogeneous array must be one the Go elements can hold
+	if !elementTypeFits(elementType, outElem.Type().Elem()) {
+		return &TypeMismatchError{Wire: elementType, GoType: outElem.Type().Elem(), Offset: start}
 	}
 
 	// For slices, create a new slice of the appropriate length
+	// Fixed-size Go arrays must match the encoded length exactly, and are a mismatch of types otherwise
 	if outElem.Kind() == reflect.Slice {
 		sliceType := outElem.Type()
+		if !encodesToNothing(sliceType.Elem()) {
+			if err := checkCount(r, length); err != nil {
+				return err
+			}
+		}
+		if err := reserveType(r, length, sliceType.Elem()); err != nil {
+			return err
+		}
 		newSlice := reflect.MakeSlice(sliceType, int(length), int(length))
 		outElem.Set(newSlice)
+	} else if length != uint64(outElem.Len()) {
+		return typeMismatchAt(start, header, outElem.Type())
 	}
 
-	// Deserialize each element using the generic deserializer
-	for i := 0; i < int(length); i++ {
-		if i >= outElem.Len() {
-			return fmt.Errorf("array index %d out of bounds (length %d)", i, outElem.Len())
+	// Packed elements have no headers, so each is given one before it is decoded
+	var p *packedReader
+	if packing.packed {
+		if p, err = newPackedReader(r, length, packing); err != nil {
+			return err
 		}
+	}
 
+	// Deserialize each element using the generic deserializer
+	for i := 0; i < int(length); i++ {
 		elemPtr := outElem.Index(i).Addr().Interface()
 
 		// Deserialize the element using the generic deserializer
-		err = Deserialize(r, elemPtr)
+		// Times in packed arrays are set directly, since they have no other representation there,
+		// and so are plain bools, which need no conversion
+		if p != nil && outElem.Type().Elem() == timeType {
+			var t time.Time
+			if t, err = p.time(); err == nil {
+				outElem.Index(i).Set(reflect.ValueOf(t))
+			}
+		} else if p != nil && elementType == types.Boolean && outElem.Type().Elem().Kind() == reflect.Bool {
+			outElem.Index(i).SetBool(p.bool())
+		} else if p != nil {
+			err = p.deserializeElement(elementType, elemPtr)
+		} else {
+			err = Deserialize(r, elemPtr)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to deserialize array element %d: %w", i, err)
+			return withPath(r, fmt.Errorf("failed to deserialize array element %d: %w", i, err), indexSegment(i))
 		}
 	}
 
 	return nil
 }
 
+// elementTypeFits reports whether array elements declared as elementType can be decoded into Go values of type t
+// Mixed elements and elements decoded into interfaces or by unmarshalers are only checked one by one
+func elementTypeFits(elementType types.Types, t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface || hasCustomDecoding(reflect.New(t).Interface()) {
+		return true
+	}
+
+	switch elementType {
+	case types.Mixed, types.Extended, types.Json:
+		return true
+	case types.UNibble, types.SNibble, types.SInt, types.UInt, types.Float:
+		return isNumericKind(t.Kind()) && t.Kind() != reflect.Complex64 && t.Kind() != reflect.Complex128
+	case types.Complex:
+		return t.Kind() == reflect.Complex64 || t.Kind() == reflect.Complex128
+	case types.Boolean:
+		return t.Kind() == reflect.Bool
+	case types.String, types.Buffer:
+		return t.Kind() == reflect.String || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t == bytesBufferType.Elem()
+	case types.Array:
+		return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+	case types.Map:
+		return t.Kind() == reflect.Map
+	case types.Struct:
+		return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+	}
+	return false
+}
+
 // Helper function to determine the Types enum value for a reflect.Type using cache
 func getTypeForReflectType(t reflect.Type) (types.Types, error) {
 	return typeCache.GetEBEType(t)
 }
 
-// readArrayHeader reads and parses the array header, returning length and element type
-func readArrayHeader(r io.Reader, header byte) (uint64, types.Types, error) {
+// readArrayHeader reads and parses the array header, returning length, element type and how the elements are stored
+// Headers of other types are reported as a mismatch with goType, the type being decoded into
+func readArrayHeader(r io.Reader, header byte, goType reflect.Type) (uint64, types.Types, arrayPacking, error) {
 	headerType := types.TypeFromHeader(header)
 	headerValue := types.ValueFromHeader(header)
 
 	if headerType != types.Array {
-		return 0, 0, fmt.Errorf("expected Array type, got %v", types.TypeName(headerType))
+		return 0, 0, arrayPacking{}, newTypeMismatch(r, header, goType)
 	}
 
 	length := uint64(headerValue)
@@ -584,19 +736,39 @@ func readArrayHeader(r io.Reader, header byte) (uint64, types.Types, error) {
 	if length&0x08 != 0 {
 		arrayLength, err := deserializeUintWithHeader(r)
 		if err != nil {
-			return 0, 0, fmt.Errorf("failed to deserialize array length: %w", err)
+			return 0, 0, arrayPacking{}, fmt.Errorf("failed to deserialize array length: %w", err)
 		}
 		length = arrayLength
 	}
+	if err := checkLength(r, length); err != nil {
+		return 0, 0, arrayPacking{}, err
+	}
 
 	// Read the element type
 	elementTypeByte, err := utils.ReadByte(r)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to read element type: %w", err)
+		return 0, 0, arrayPacking{}, fmt.Errorf("failed to read element type: %w", err)
 	}
 	elementType := types.Types(elementTypeByte)
 
-	return length, elementType, nil
+	// Packed arrays follow the element type with their packing
+	// Elements of empty structs encode to nothing, so only decoders that know the Go type can check their count
+	if headerValue != types.ArrayPacked {
+		if elementType != types.Struct {
+			if err := checkCount(r, length); err != nil {
+				return 0, 0, arrayPacking{}, err
+			}
+		}
+		return length, elementType, arrayPacking{}, nil
+	}
+	packing, err := readPacking(r, elementType)
+	if err != nil {
+		return 0, 0, arrayPacking{}, err
+	}
+	if err := checkPackedCount(r, length, packing); err != nil {
+		return 0, 0, arrayPacking{}, err
+	}
+	return length, elementType, packing, nil
 }
 
 // deserializeStringWithoutHeader deserializes a string value directly without reflection
@@ -613,30 +785,20 @@ func deserializeStringWithoutHeader(r io.Reader) (string, error) {
 		return deserializeString(r, header)
 
 	default:
-		return "", fmt.Errorf("cannot deserialize %s as string", types.TypeName(headerType))
+		return "", newTypeMismatch(r, header, stringType)
 	}
 }
 
-// writeArrayHeader writes the array header with length and element type
-func writeArrayHeader(w io.Writer, length int, elementType types.Types) error {
+// appendArrayHeader appends the array header with length and element type to dst
+func appendArrayHeader(dst []byte, length int, elementType types.Types) []byte {
 	// Write the array header with length
 	if length <= 0x07 {
-		if err := utils.WriteByte(w, types.CreateHeader(types.Array, byte(length))); err != nil {
-			return err
-		}
+		dst = append(dst, types.CreateHeader(types.Array, byte(length)))
 	} else {
-		if err := utils.WriteByte(w, types.CreateHeader(types.Array, 0x08)); err != nil {
-			return err
-		}
-		if err := serializeUint(uint64(length), w); err != nil {
-			return err
-		}
+		dst = append(dst, types.CreateHeader(types.Array, 0x08))
+		dst = appendUint(dst, uint64(length))
 	}
 
 	// Write the element type
-	if err := utils.WriteByte(w, byte(elementType)); err != nil {
-		return err
-	}
-
-	return nil
+	return append(dst, byte(elementType))
 }
@@ -0,0 +1,139 @@
+package serialize
+
+import (
+	"ebe/types"
+	"ebe/utils"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// appendBoolElements appends a Boolean array of length elements given by at, packed as bits if that is smaller
+func appendBoolElements(dst []byte, length int, at func(i int) bool) []byte {
+	if !packedIsSmaller(length, uint64(length+7)/8, uint64(length)) {
+		dst = appendArrayHeader(dst, length, types.Boolean)
+		for i := 0; i < length; i++ {
+			dst = appendBoolean(dst, at(i))
+		}
+		return dst
+	}
+
+	dst = appendPackedArrayHeader(dst, length, types.Boolean, types.PackedBits)
+	var bits byte
+	for i := 0; i < length; i++ {
+		if at(i) {
+			bits |= 1 << (i % 8)
+		}
+		if i%8 == 7 || i == length-1 {
+			dst = append(dst, bits)
+			bits = 0
+		}
+	}
+	return dst
+}
+
+var bitsetType = reflect.TypeOf(Bitset{})
+
+// Bitset is a fixed length sequence of bits, encoded the same way as a []bool of that length
+type Bitset struct {
+	bits   []byte
+	length int
+}
+
+// NewBitset returns a Bitset of length bits, all of them clear
+func NewBitset(length int) *Bitset {
+	return &Bitset{bits: make([]byte, (length+7)/8), length: length}
+}
+
+// Len returns the number of bits in the set
+func (b Bitset) Len() int {
+	return b.length
+}
+
+// Get reports whether bit i is set, panicking if i is out of range like a slice index
+func (b Bitset) Get(i int) bool {
+	b.check(i)
+	return b.bits[i/8]&(1<<(i%8)) != 0
+}
+
+// Set sets bit i to value, panicking if i is out of range like a slice index
+func (b *Bitset) Set(i int, value bool) {
+	b.check(i)
+	if value {
+		b.bits[i/8] |= 1 << (i % 8)
+	} else {
+		b.bits[i/8] &^= 1 << (i % 8)
+	}
+}
+
+// check panics if i is not the index of a bit in the set
+func (b Bitset) check(i int) {
+	if i < 0 || i >= b.length {
+		panic(fmt.Sprintf("serialize: bit index %d out of range [0:%d]", i, b.length))
+	}
+}
+
+// Bools returns the bits of the set as a []bool
+func (b Bitset) Bools() []bool {
+	bools := make([]bool, b.length)
+	for i := range bools {
+		bools[i] = b.Get(i)
+	}
+	return bools
+}
+
+// Bytes returns the bits of the set eight to a byte, starting from the lowest bit of the first byte
+// The returned slice shares the set's storage
+func (b Bitset) Bytes() []byte {
+	return b.bits
+}
+
+// MarshalEBE appends the set to dst as a Boolean array, which is packed as bits unless it is very short
+func (b Bitset) MarshalEBE(dst []byte) ([]byte, error) {
+	return appendBoolElements(dst, b.length, b.Get), nil
+}
+
+// UnmarshalEBE decodes a Boolean array, packed or not, into the set, replacing its contents
+// Null decodes as an empty set
+func (b *Bitset) UnmarshalEBE(r io.Reader, header byte) error {
+	if types.TypeFromHeader(header) == types.Null {
+		*b = Bitset{}
+		return nil
+	}
+
+	start := headerOffset(r)
+	length, elementType, packing, err := readArrayHeader(r, header, bitsetType)
+	if err != nil {
+		return err
+	}
+	if elementType != types.Boolean {
+		return &TypeMismatchError{Wire: elementType, GoType: bitsetType, Offset: start}
+	}
+	if packing.packed {
+		p, err := newPackedReader(r, length, packing)
+		if err != nil {
+			return err
+		}
+		*b = Bitset{bits: p.payload, length: int(length)}
+	} else {
+		set := NewBitset(int(length))
+		for i := 0; i < set.length; i++ {
+			header, err := utils.ReadByte(r)
+			if err != nil {
+				return fmt.Errorf("failed to read bool element %d header: %w", i, err)
+			}
+			value, err := deserializeBoolean(r, header)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize bool element %d: %w", i, err)
+			}
+			set.Set(i, value)
+		}
+		*b = *set
+	}
+
+	// Unused bits of a packed array should be zero, but are cleared in case they are not
+	if extra := b.length % 8; extra != 0 {
+		b.bits[len(b.bits)-1] &= 1<<extra - 1
+	}
+	return nil
+}
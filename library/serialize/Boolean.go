@@ -2,21 +2,16 @@ package serialize
 
 import (
 	"ebe/types"
-	"ebe/utils"
-	"fmt"
 	"io"
 )
 
-func serializeBoolean(value bool, w io.Writer) error {
-	// This function appends the serialized boolean to the existing writer
+// appendBoolean appends the serialized boolean to dst
+func appendBoolean(dst []byte, value bool) []byte {
 	// Set the header for the type and put the boolean value in the value nibble
-	var b byte
 	if value {
-		b = types.CreateHeader(types.Boolean, 1)
-	} else {
-		b = types.CreateHeader(types.Boolean, 0)
+		return append(dst, types.CreateHeader(types.Boolean, 1))
 	}
-	return utils.WriteByte(w, b)
+	return append(dst, types.CreateHeader(types.Boolean, 0))
 }
 
 func deserializeBoolean(r io.Reader, header byte) (bool, error) {
@@ -24,7 +19,7 @@ func deserializeBoolean(r io.Reader, header byte) (bool, error) {
 	headerValue := types.ValueFromHeader(header)
 
 	if headerType != types.Boolean {
-		return false, fmt.Errorf("expected Boolean type, got %v", types.TypeName(headerType))
+		return false, newTypeMismatch(r, header, boolType)
 	}
 
 	return headerValue != 0, nil
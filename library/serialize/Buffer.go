@@ -3,13 +3,12 @@ package serialize
 import (
 	"bytes"
 	"ebe/types"
-	"ebe/utils"
 	"fmt"
 	"io"
 )
 
-func serializeBuffer(value []byte, w io.Writer) error {
-	// This function appends the serialized buffer to the existing writer
+// appendBuffer appends the serialized buffer to dst
+func appendBuffer(dst []byte, value []byte) []byte {
 	// Write the length of the buffer as an [UInt]
 	var length = len(value)
 
@@ -18,17 +17,14 @@ func serializeBuffer(value []byte, w io.Writer) error {
 	// The high bit of the nibble will be 0 if the length is in the nibble and will be 1 if the length is in a following UInt
 	// Note: it is legal to have a zero length buffer so zero can't be used as the indicator
 	if length <= 0x07 {
-		utils.WriteByte(w, types.CreateHeader(types.Buffer, byte(length)))
+		dst = append(dst, types.CreateHeader(types.Buffer, byte(length)))
 	} else {
-		utils.WriteByte(w, types.CreateHeader(types.Buffer, 0x08))
-		if err := serializeUint(uint64(length), w); err != nil {
-			return err
-		}
+		dst = append(dst, types.CreateHeader(types.Buffer, 0x08))
+		dst = appendUint(dst, uint64(length))
 	}
 
 	// Write the raw buffer data
-	_, err := w.Write(value)
-	return err
+	return append(dst, value...)
 }
 
 // deserializeBuffer deserializes a buffer with a pre-read header byte
@@ -39,7 +35,7 @@ func deserializeBuffer(r io.Reader, header byte) (*bytes.Buffer, error) {
 	headerValue := types.ValueFromHeader(header)
 
 	if headerType != types.Buffer {
-		return value, fmt.Errorf("expected Buffer type, got %v", types.TypeName(headerType))
+		return value, newTypeMismatch(r, header, bytesBufferType)
 	}
 
 	length := uint64(headerValue)
@@ -54,6 +50,9 @@ func deserializeBuffer(r io.Reader, header byte) (*bytes.Buffer, error) {
 	}
 
 	// Read the buffer data
+	if err := checkPayload(r, length); err != nil {
+		return value, err
+	}
 	data := make([]byte, length)
 	_, err := io.ReadFull(r, data)
 	if err != nil {
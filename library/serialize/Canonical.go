@@ -0,0 +1,529 @@
+package serialize
+
+import (
+	"bytes"
+	"ebe/types"
+	"ebe/utils"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Canonical form gives every value exactly one encoding, so equal values always produce equal bytes
+// and encodings can be hashed, signed and compared directly:
+//   - integers, floats, complex numbers and lengths use the shortest form that holds their value,
+//     except that floats are never half precision, which encoders only write when asked to
+//   - a NaN float is always the header-only NaN form, and a NaN part of a complex number is math.NaN at the width of the pair;
+//     booleans are 0 or 1 and the unused nibbles are 0
+//   - map entries are sorted by the bytes of their encoded keys, and no two keys encode the same
+// Everything else, such as field order and the choice between tagged and positional structs,
+// is already fixed by the Go types being encoded.
+
+// MarshalCanonical returns the canonical encoding of value
+func MarshalCanonical(value interface{}) ([]byte, error) {
+	data, err := appendValue(nil, value)
+	if err != nil {
+		return nil, err
+	}
+	return appendCanonical(nil, data)
+}
+
+// Canonicalize returns the canonical encoding of the single value encoded in data
+// It fails with a *NonCanonicalError if data holds a map with two equal keys
+func Canonicalize(data []byte) ([]byte, error) {
+	return appendCanonical(nil, data)
+}
+
+// IsCanonical reports whether data holds a single value in canonical form
+func IsCanonical(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	c := newCanonicalizer(bytes.NewReader(data), true)
+	if _, err := c.appendValue(nil); err != nil {
+		return false
+	}
+	return c.state.offset == int64(len(data))
+}
+
+// appendCanonical appends the canonical form of the single value encoded in data to dst
+func appendCanonical(dst []byte, data []byte) ([]byte, error) {
+	return appendRewritten(dst, data, rewriting{})
+}
+
+// rewriting selects how a canonicalizer rewrites values for an encoder, and is canonical form when it is zero
+type rewriting struct {
+	delta   DeltaMode
+	half    bool         // Floats that half precision holds exactly take two bytes
+	strings *stringTable // If set, strings are interned through it
+}
+
+// appendRewritten appends the single value encoded in data to dst, rewritten by a canonicalizer as rw selects
+func appendRewritten(dst []byte, data []byte, rw rewriting) ([]byte, error) {
+
+	// Empty structs are encoded as no bytes at all
+	if len(data) == 0 {
+		return dst, nil
+	}
+
+	c := newCanonicalizer(bytes.NewReader(data), false)
+	c.rewriting = rw
+	out, err := c.appendValue(dst)
+	if err != nil {
+		return dst, withPath(c.state, err, "")
+	}
+	if c.state.offset != int64(len(data)) {
+		return dst, fmt.Errorf("unexpected %d trailing bytes after value", int64(len(data))-c.state.offset)
+	}
+	return out, nil
+}
+
+// canonicalizer rewrites encoded values into canonical form as it reads them
+// When checking, the input is captured as it is read, so that each value can be compared with its canonical form
+// Given a delta mode, it instead keeps map order and NaNs as they are, and rewrites arrays of integers and times
+// with deltas where that is smaller, which is how encoders with a delta mode produce their output
+// Given a string table or half precision, it likewise keeps map order and NaNs, and interns strings through
+// the table or writes floats in half precision where that holds them
+type canonicalizer struct {
+	state *decodeState
+	input *captureReader
+	base  int64 // Offset of the first captured byte
+	check bool  // Fail at the first value that is not canonical instead of rewriting it
+	rewriting
+}
+
+// newCanonicalizer returns a canonicalizer that reads from r
+func newCanonicalizer(r io.Reader, check bool) *canonicalizer {
+	c := &canonicalizer{check: check}
+	if check {
+		c.input = &captureReader{r: r}
+		r = c.input
+	}
+	c.state = newDecodeState(r, DecodeOptions{})
+	return c
+}
+
+// captureReader keeps a copy of everything read through it
+type captureReader struct {
+	r    io.Reader
+	read bytes.Buffer
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read.Write(p[:n])
+	return n, err
+}
+
+// appendValue reads one value and appends its canonical form to dst
+func (c *canonicalizer) appendValue(dst []byte) ([]byte, error) {
+	header, err := utils.ReadByte(c.state)
+	if err != nil {
+		return dst, err
+	}
+	return c.appendValueWithHeader(dst, header)
+}
+
+// appendValueWithHeader reads the remainder of a value whose header has been read and appends its canonical form to dst
+func (c *canonicalizer) appendValueWithHeader(dst []byte, header byte) ([]byte, error) {
+	r := c.state
+	start := headerOffset(r)
+	mark := len(dst)
+	reason := "a shorter encoding exists"
+
+	if isNestedHeader(header) {
+		if err := enterNested(r); err != nil {
+			return dst, err
+		}
+		defer leaveNested(r)
+	}
+
+	headerType := types.TypeFromHeader(header)
+	headerValue := types.ValueFromHeader(header)
+
+	switch headerType {
+
+	case types.UNibble, types.UInt:
+		value, err := deserializeUint(r, header)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendUint(dst, value)
+
+	case types.SNibble, types.SInt:
+		value, err := deserializeSint(r, header)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendSint(dst, value)
+
+	case types.Float:
+		value, err := deserializeFloat(r, header)
+		if err != nil {
+			return dst, err
+		}
+		if math.IsNaN(value) {
+			reason = "NaN is not the canonical NaN"
+		}
+		if headerValue == types.FloatHalf {
+			reason = "floats are not half precision in canonical form"
+		}
+		dst = appendCompactFloat(dst, c.float(value), c.half)
+
+	case types.Complex:
+		value, err := deserializeComplex(r, header)
+		if err != nil {
+			return dst, err
+		}
+		if math.IsNaN(real(value)) || math.IsNaN(imag(value)) {
+			reason = "NaN is not the canonical NaN"
+		}
+		dst = appendComplex(dst, complex(c.float(real(value)), c.float(imag(value))))
+
+	case types.Boolean:
+		dst = appendBoolean(dst, headerValue != 0)
+
+	case types.Null:
+		dst = appendNull(dst)
+
+	case types.String:
+		value, err := deserializeString(r, header)
+		if err != nil {
+			return dst, err
+		}
+		if headerValue == types.StringDefine || headerValue == types.StringReference {
+			reason = "strings are not interned in canonical form"
+		}
+		if c.strings != nil {
+			dst = c.strings.appendString(dst, value)
+		} else {
+			dst = appendString(dst, value)
+		}
+
+	case types.Buffer:
+		value, err := deserializeBuffer(r, header)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendBuffer(dst, value.Bytes())
+
+	case types.Json:
+		length, err := deserializeUintWithHeader(r)
+		if err != nil {
+			return dst, fmt.Errorf("failed to read JSON length: %w", err)
+		}
+		if err := checkPayload(r, length); err != nil {
+			return dst, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return dst, fmt.Errorf("failed to read JSON data: %w", err)
+		}
+		dst = appendJson(dst, data)
+
+	case types.Extended:
+		var count uint64
+		switch headerValue {
+		case types.ExtendedTime, types.ExtendedTyped:
+			count = 2
+		case types.ExtendedTimeOffset:
+			count = 3
+		case types.ExtendedDuration:
+			count = 1
+		default:
+			return dst, &UnsupportedTypeError{Wire: headerType, Offset: start}
+		}
+		dst = append(dst, header)
+		var err error
+		if dst, err = c.appendValues(dst, count); err != nil {
+			return dst, err
+		}
+
+	case types.Array:
+		length, elementType, packing, err := readArrayHeader(r, header, nil)
+		if err != nil {
+			return dst, err
+		}
+		if isPackable(elementType) || packing.packed || (c.delta != DeltaNone && elementType == types.Extended) {
+			if dst, err = c.appendNumericArray(dst, length, elementType, packing); err != nil {
+				return dst, err
+			}
+			break
+		}
+		if err := checkCount(r, length); err != nil {
+			return dst, err
+		}
+		dst = appendArrayHeader(dst, int(length), elementType)
+		if dst, err = c.appendValues(dst, length); err != nil {
+			return dst, err
+		}
+
+	case types.Map:
+		var err error
+		var sorted bool
+		if dst, sorted, err = c.appendMap(dst, header); err != nil {
+			return dst, err
+		}
+		if !sorted {
+			reason = "map keys are not sorted by their encoding"
+		}
+
+	case types.Struct:
+		fieldCount, tagged, err := readStructHeader(r, header, nil)
+		if err != nil {
+			return dst, err
+		}
+		if tagged {
+			dst = appendTaggedStructHeader(dst, int(fieldCount))
+			fieldCount *= 2
+		} else {
+			dst = appendStructHeader(dst, int(fieldCount))
+		}
+		if dst, err = c.appendValues(dst, fieldCount); err != nil {
+			return dst, err
+		}
+
+	default:
+		return dst, &UnsupportedTypeError{Wire: headerType, Offset: start}
+	}
+
+	if c.check && !bytes.Equal(dst[mark:], c.input.read.Bytes()[start-c.base:r.offset-c.base]) {
+		return dst, &NonCanonicalError{Reason: reason, Offset: start}
+	}
+	return dst, nil
+}
+
+// appendValues reads count consecutive values and appends their canonical forms to dst
+func (c *canonicalizer) appendValues(dst []byte, count uint64) ([]byte, error) {
+	var err error
+	for i := uint64(0); i < count; i++ {
+		if dst, err = c.appendValue(dst); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// appendNumericArray reads the elements of an SInt, UInt or Float array, or an array of times, whose header
+// has been read and appends the array to dst, packed exactly when the encoder would pack it
+func (c *canonicalizer) appendNumericArray(dst []byte, length uint64, elementType types.Types, packing arrayPacking) ([]byte, error) {
+	r := c.state
+	if packing.packed {
+		p, err := newPackedReader(r, length, packing)
+		if err != nil {
+			return dst, err
+		}
+		if err := reserve(r, length, 8); err != nil {
+			return dst, err
+		}
+		values := make([]uint64, length)
+		for i := range values {
+			if values[i], err = p.bits(elementType); err != nil {
+				return dst, err
+			}
+			if elementType == types.Float {
+				values[i] = math.Float64bits(c.float(math.Float64frombits(values[i])))
+			}
+		}
+		return c.appendElements(dst, elementType, values), nil
+	}
+
+	// Regular elements are rewritten one by one, and repacked if every one has the array's element type
+	if err := reserve(r, length, 8); err != nil {
+		return dst, err
+	}
+	var scratch []byte
+	values := make([]uint64, length)
+	numeric := true
+	for i := range values {
+		mark := len(scratch)
+		var err error
+		if scratch, err = c.appendValue(scratch); err != nil {
+			return dst, err
+		}
+		if numeric {
+			values[i], numeric = numericBits(scratch[mark:], elementType)
+		}
+	}
+	if !numeric {
+		dst = appendArrayHeader(dst, int(length), elementType)
+		return append(dst, scratch...), nil
+	}
+	return c.appendElements(dst, elementType, values), nil
+}
+
+// appendElements appends an array of elementType elements whose bits are given by values, as the encoder would,
+// or delta encoded if the canonicalizer has a delta mode and that is smaller
+func (c *canonicalizer) appendElements(dst []byte, elementType types.Types, values []uint64) []byte {
+	mark := len(dst)
+	if elementType == types.Extended {
+		dst = appendArrayHeader(dst, len(values), elementType)
+		for _, value := range values {
+			dst = appendTime(dst, time.Unix(0, int64(value)).UTC())
+		}
+	} else {
+		dst = appendNumericElements(dst, elementType, values)
+	}
+
+	// Half precision elements can make a regular array smaller than the packed one
+	if c.half && elementType == types.Float {
+		regular := appendArrayHeader(nil, len(values), elementType)
+		for _, value := range values {
+			regular = appendCompactFloat(regular, math.Float64frombits(value), true)
+		}
+		if len(regular) < len(dst)-mark {
+			dst = append(dst[:mark], regular...)
+		}
+	}
+
+	if c.delta == DeltaNone || elementType == types.Float || elementType == types.Boolean || len(values) < 2 {
+		return dst
+	}
+	if delta := appendDeltaElements(nil, elementType, values, c.delta); len(delta) < len(dst)-mark {
+		dst = append(dst[:mark], delta...)
+	}
+	return dst
+}
+
+// float returns a float as it is rewritten, which is canonical unless the canonicalizer rewrites for an encoder
+func (c *canonicalizer) float(value float64) float64 {
+	if !c.canonical() {
+		return value
+	}
+	return canonicalFloat(value)
+}
+
+// canonical reports whether the canonicalizer produces canonical form, rather than rewriting values for an encoder
+func (c *canonicalizer) canonical() bool {
+	return c.rewriting == rewriting{}
+}
+
+// numericBits returns the bits of the canonical value encoded in data, as given to appendNumericElements,
+// and whether it is an element that an array of elementType holds
+func numericBits(data []byte, elementType types.Types) (uint64, bool) {
+	r := bytes.NewReader(data[1:])
+	header := data[0]
+	headerType := types.TypeFromHeader(header)
+	switch {
+	case elementType == types.SInt && (headerType == types.SNibble || headerType == types.SInt):
+		value, err := deserializeSint(r, header)
+		return uint64(value), err == nil
+	case elementType == types.UInt && (headerType == types.UNibble || headerType == types.UInt):
+		value, err := deserializeUint(r, header)
+		return value, err == nil
+	case elementType == types.UInt && header == types.CreateHeader(types.SNibble, 0):
+		return 0, true
+	case elementType == types.Float && headerType == types.Float:
+		value, err := deserializeFloat(r, header)
+		return math.Float64bits(value), err == nil
+	case elementType == types.Boolean && headerType == types.Boolean:
+		return uint64(types.ValueFromHeader(header)), true
+	case elementType == types.Extended && header == types.CreateHeader(types.Extended, types.ExtendedTime):
+		value, err := deserializeTime(r, types.ExtendedTime)
+		nanoseconds, ok := timeNanoseconds(value)
+		return uint64(nanoseconds), err == nil && ok
+	}
+	return 0, false
+}
+
+// canonicalEntry locates the canonical key and value of a map entry in a scratch buffer
+type canonicalEntry struct {
+	key, value, end int
+}
+
+// appendMap reads the remainder of a map and appends it to dst with its entries sorted by key
+// It also reports whether the entries were already sorted
+func (c *canonicalizer) appendMap(dst []byte, header byte) ([]byte, bool, error) {
+	r := c.state
+	entryCount, err := readMapHeader(r, header, nil)
+	if err != nil {
+		return dst, false, err
+	}
+
+	// Keys are compared in canonical form, so each entry is rewritten before it is placed
+	var scratch []byte
+	entries := make([]canonicalEntry, entryCount)
+	keyOffsets := make([]int64, entryCount)
+	for i := range entries {
+		keyOffsets[i] = inputOffset(r)
+		entries[i].key = len(scratch)
+		if scratch, err = c.appendValue(scratch); err != nil {
+			return dst, false, err
+		}
+		entries[i].value = len(scratch)
+		if scratch, err = c.appendValue(scratch); err != nil {
+			return dst, false, err
+		}
+		entries[i].end = len(scratch)
+	}
+
+	// Maps keep their order when only arrays and strings are being rewritten
+	// Interned strings must also stay in order, since each definition has to come before its references
+	key := func(e canonicalEntry) []byte { return scratch[e.key:e.value] }
+	sorted := !c.canonical() || sort.SliceIsSorted(entries, func(i, j int) bool {
+		return bytes.Compare(key(entries[i]), key(entries[j])) < 0
+	})
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	if !sorted {
+		sort.SliceStable(order, func(i, j int) bool {
+			return bytes.Compare(key(entries[order[i]]), key(entries[order[j]])) < 0
+		})
+	}
+	for i := 1; i < len(order) && c.canonical(); i++ {
+		if bytes.Equal(key(entries[order[i-1]]), key(entries[order[i]])) {
+			return dst, false, &NonCanonicalError{Reason: "duplicate map key", Offset: keyOffsets[order[i]]}
+		}
+	}
+
+	dst = appendMapHeader(dst, len(entries))
+	for _, i := range order {
+		dst = append(dst, scratch[entries[i].key:entries[i].end]...)
+	}
+	return dst, sorted, nil
+}
+
+// checkCount rejects element counts that cannot fit in the rest of the input, where each value takes at least a byte
+func checkCount(r io.Reader, count uint64) error {
+	if remaining, ok := remainingInput(r); ok && count > remaining {
+		return fmt.Errorf("%d values exceed the %d bytes of remaining input: %w", count, remaining, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// canonicalFloat replaces every NaN with the one NaN that canonical encodings use
+func canonicalFloat(value float64) float64 {
+	if math.IsNaN(value) {
+		return math.NaN()
+	}
+	return value
+}
+
+// deserializeCanonical checks that the value whose header has been read from d is in canonical form,
+// then decodes it into out
+func (d *decodeState) deserializeCanonical(header byte, out interface{}, outValue reflect.Value) error {
+	r, br, start, allocated := d.r, d.br, headerOffset(d), d.allocated
+
+	// Read the value through a canonicalizer that shares this state, so limits and offsets still apply
+	c := &canonicalizer{state: d, input: &captureReader{r: r}, base: start, check: true}
+	c.input.read.WriteByte(header)
+	d.setReader(c.input)
+	_, err := c.appendValueWithHeader(nil, header)
+	d.r, d.br = r, br
+	if err != nil {
+		return err
+	}
+
+	// Decode the value again from the bytes that were checked
+	end := d.offset
+	d.setReader(bytes.NewReader(c.input.read.Bytes()[1:]))
+	d.offset, d.allocated, d.canonical = start+1, allocated, false
+	err = deserializeWithHeaderInternal(d, header, out, outValue)
+	d.r, d.br, d.offset, d.canonical = r, br, end, true
+	return err
+}
@@ -0,0 +1,70 @@
+package serialize
+
+import (
+	"ebe/types"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// appendComplex appends the serialized complex number to dst
+// Format: [Complex Header: component width 4 or 8] [real part] [imaginary part], both little-endian
+func appendComplex(dst []byte, value complex128) []byte {
+	re, im := real(value), imag(value)
+
+	// If both parts survive a round trip through float32, then serialize as a pair of float32
+	if fitsFloat32(re) && fitsFloat32(im) {
+
+		// Write the header as float32 components
+		dst = append(dst, types.CreateHeader(types.Complex, 4))
+
+		// Write the real and imaginary parts
+		dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(re)))
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(im)))
+	}
+
+	// Write the header as float64 components
+	dst = append(dst, types.CreateHeader(types.Complex, 8))
+
+	// Write the real and imaginary parts
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(re))
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(im))
+}
+
+// fitsFloat32 reports whether a float64 can be stored as a float32 without losing precision
+func fitsFloat32(value float64) bool {
+	return float64(float32(value)) == value || math.IsNaN(value)
+}
+
+// deserializeComplex deserializes a complex number with a pre-read header byte
+func deserializeComplex(r io.Reader, header byte) (complex128, error) {
+	headerType := types.TypeFromHeader(header)
+	width := types.ValueFromHeader(header)
+
+	// Make sure the data is a valid complex value
+	if headerType != types.Complex {
+		return 0, newTypeMismatch(r, header, complex128Type)
+	}
+
+	if width != 4 && width != 8 {
+		return 0, fmt.Errorf("invalid complex component width: expected 4 or 8, got %d", width)
+	}
+
+	// Read both parts at once
+	var data [16]byte
+	if _, err := io.ReadFull(r, data[:2*width]); err != nil {
+		return 0, fmt.Errorf("failed to read complex%d: %w", 16*int(width), err)
+	}
+
+	// If the parts are float32 then widen them to float64
+	if width == 4 {
+		re := math.Float32frombits(binary.LittleEndian.Uint32(data[0:4]))
+		im := math.Float32frombits(binary.LittleEndian.Uint32(data[4:8]))
+		return complex(float64(re), float64(im)), nil
+	}
+
+	re := math.Float64frombits(binary.LittleEndian.Uint64(data[0:8]))
+	im := math.Float64frombits(binary.LittleEndian.Uint64(data[8:16]))
+	return complex(re, im), nil
+}
@@ -0,0 +1,163 @@
+package serialize
+
+import (
+	"ebe/utils"
+	"io"
+	"math"
+	"reflect"
+)
+
+// setDecodedValue stores a value decoded from a header at offset start in outValue
+// Numbers are range-checked against the Go type unless the decode is lenient, and never become strings
+func setDecodedValue(r io.Reader, start int64, header byte, outValue reflect.Value, value interface{}) error {
+	if !isLenient(r) {
+		source := reflect.ValueOf(value)
+		if isNumericKind(source.Kind()) {
+			if isNumericKind(outValue.Kind()) {
+				return setNumber(start, header, outValue, source)
+			}
+			if outValue.Kind() == reflect.String {
+				return typeMismatchAt(start, header, outValue.Type())
+			}
+		}
+	}
+
+	if err := utils.SetValueWithConversion(outValue, value); err != nil {
+		return typeMismatchAt(start, header, outValue.Type())
+	}
+	return nil
+}
+
+// setNumber stores the number in source in the numeric outValue, failing if it cannot be represented exactly
+func setNumber(start int64, header byte, outValue reflect.Value, source reflect.Value) error {
+	overflow := func() error {
+		return &OverflowError{Value: numberOf(source), GoType: outValue.Type(), Offset: start}
+	}
+
+	switch outValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var value int64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = source.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if source.Uint() > math.MaxInt64 {
+				return overflow()
+			}
+			value = int64(source.Uint())
+		case reflect.Float32, reflect.Float64:
+			f := source.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return overflow()
+			}
+			value = int64(f)
+		default:
+			return typeMismatchAt(start, header, outValue.Type())
+		}
+		if outValue.OverflowInt(value) {
+			return overflow()
+		}
+		outValue.SetInt(value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var value uint64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if source.Int() < 0 {
+				return overflow()
+			}
+			value = uint64(source.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = source.Uint()
+		case reflect.Float32, reflect.Float64:
+			f := source.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return overflow()
+			}
+			value = uint64(f)
+		default:
+			return typeMismatchAt(start, header, outValue.Type())
+		}
+		if outValue.OverflowUint(value) {
+			return overflow()
+		}
+		outValue.SetUint(value)
+
+	case reflect.Float32, reflect.Float64:
+		var value float64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = float64(source.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = float64(source.Uint())
+		case reflect.Float32, reflect.Float64:
+			value = source.Float()
+		default:
+			return typeMismatchAt(start, header, outValue.Type())
+		}
+		// Infinities and NaN are representable in both widths, only finite values can overflow
+		if outValue.OverflowFloat(value) {
+			return overflow()
+		}
+		outValue.SetFloat(value)
+
+	case reflect.Complex64, reflect.Complex128:
+		if source.Kind() != reflect.Complex64 && source.Kind() != reflect.Complex128 {
+			return typeMismatchAt(start, header, outValue.Type())
+		}
+		if outValue.OverflowComplex(source.Complex()) {
+			return overflow()
+		}
+		outValue.SetComplex(source.Complex())
+
+	default:
+		return typeMismatchAt(start, header, outValue.Type())
+	}
+	return nil
+}
+
+// isNumericKind reports whether values of kind k are numbers
+func isNumericKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Complex128
+}
+
+// numberOf returns a number widened to int64, uint64, float64 or complex128 for error reports
+func numberOf(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	default:
+		return value.Complex()
+	}
+}
+
+// overflowsInt reports whether value does not fit in a signed integer of the given number of bits
+func overflowsInt(value int64, bits uint) bool {
+	if bits >= 64 {
+		return false
+	}
+	return value < -1<<(bits-1) || value >= 1<<(bits-1)
+}
+
+// overflowsUint reports whether value does not fit in an unsigned integer of the given number of bits
+func overflowsUint(value uint64, bits uint) bool {
+	return bits < 64 && value >= 1<<bits
+}
+
+// overflowsFloat32 reports whether a finite value is beyond the range of float32
+// Infinities and NaN convert unchanged
+func overflowsFloat32(value float64) bool {
+	if math.IsInf(value, 0) {
+		return false
+	}
+	return math.Abs(value) > math.MaxFloat32
+}
+
+// elementOverflow returns the *OverflowError for array element i whose header is at offset
+func elementOverflow(value interface{}, goType reflect.Type, i int, offset int64) error {
+	return &OverflowError{Value: value, GoType: goType, Path: indexSegment(i), Offset: offset}
+}
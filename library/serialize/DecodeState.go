@@ -0,0 +1,132 @@
+package serialize
+
+import (
+	"bytes"
+	"ebe/utils"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DecodeOptions configures how values are decoded
+type DecodeOptions struct {
+	Limits Limits
+
+	// Lenient converts numbers to narrower Go types the way reflect.Value.Convert does, wrapping
+	// out-of-range integers, changing the sign of negative values decoded into unsigned types and
+	// truncating floats decoded into integers. By default such values fail with an *OverflowError.
+	// Deserialize is always lenient, for compatibility with existing callers.
+	Lenient bool
+
+	// Canonical rejects input that is not in the canonical form MarshalCanonical produces with a
+	// *NonCanonicalError, so that decoded values always have exactly one encoding
+	Canonical bool
+}
+
+// DeserializeWithOptions is like Deserialize but decodes with the given options
+func DeserializeWithOptions(r io.Reader, out interface{}, options DecodeOptions) error {
+	d := decodeStatePool.Get().(*decodeState)
+	d.setReader(r)
+	d.setOptions(options)
+	err := Deserialize(d, out)
+	*d = decodeState{}
+	decodeStatePool.Put(d)
+	return err
+}
+
+// UnmarshalWithOptions is like Unmarshal but decodes with the given options
+func UnmarshalWithOptions(data []byte, out interface{}, options DecodeOptions) error {
+	r := bytes.NewReader(data)
+	if err := DeserializeWithOptions(r, out, options); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("unexpected %d trailing bytes after value", r.Len())
+	}
+	return nil
+}
+
+// decodeStatePool holds the states of finished top-level decodes for reuse
+var decodeStatePool = sync.Pool{
+	New: func() interface{} { return new(decodeState) },
+}
+
+// decodeState carries the limits, the resources used so far and the input offset while decoding a value
+// It wraps the reader and is passed down in its place, so nested calls and Unmarshaler implementations share it
+type decodeState struct {
+	r         io.Reader
+	br        io.ByteReader // r as an io.ByteReader, if it is one
+	limits    Limits
+	lenient   bool
+	canonical bool
+	depth     int
+	allocated uint64
+	offset    int64
+
+	// Interned strings defined so far, which are kept from one value to the next for a whole stream
+	strings     []string
+	stringBytes int
+	keepStrings bool
+}
+
+func (d *decodeState) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.offset += int64(n)
+	return n, err
+}
+
+func (d *decodeState) ReadByte() (byte, error) {
+	var b byte
+	var err error
+	if d.br != nil {
+		b, err = d.br.ReadByte()
+	} else {
+		b, err = utils.ReadByte(d.r)
+	}
+	if err == nil {
+		d.offset++
+	}
+	return b, err
+}
+
+// newDecodeState returns a state for decoding from r
+func newDecodeState(r io.Reader, options DecodeOptions) *decodeState {
+	d := &decodeState{}
+	d.setReader(r)
+	d.setOptions(options)
+	return d
+}
+
+// setOptions applies options to the values decoded from now on
+func (d *decodeState) setOptions(options DecodeOptions) {
+	d.limits = options.Limits
+	d.lenient = options.Lenient
+	d.canonical = options.Canonical
+}
+
+// setReader directs the state to read from r
+func (d *decodeState) setReader(r io.Reader) {
+	d.r = r
+	d.br, _ = r.(io.ByteReader)
+}
+
+// reset prepares the state for decoding the next value
+func (d *decodeState) reset() {
+	d.depth = 0
+	d.allocated = 0
+	if !d.keepStrings {
+		d.resetStrings()
+	}
+}
+
+// resetStrings empties the table of interned strings
+func (d *decodeState) resetStrings() {
+	d.strings = d.strings[:0]
+	d.stringBytes = 0
+}
+
+// isLenient reports whether numbers decoded from r are converted without range checks
+func isLenient(r io.Reader) bool {
+	d, ok := r.(*decodeState)
+	return !ok || d.lenient
+}
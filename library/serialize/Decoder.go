@@ -0,0 +1,72 @@
+package serialize
+
+import (
+	"bufio"
+	"io"
+)
+
+// decoderBufferSize is the size of the read-ahead buffer used by a Decoder
+const decoderBufferSize = 4096
+
+// Decoder reads a sequence of EBE values from an io.Reader through an internal buffer
+// The decoder may read ahead of the values it has returned, so once a Decoder is attached to a
+// reader, all further reads should go through it (see Buffered).
+// A Decoder can be reused for another reader with Reset, which makes it suitable for pooling.
+type Decoder struct {
+	r     *bufio.Reader
+	state *decodeState
+}
+
+// NewDecoder returns a Decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	br := bufio.NewReaderSize(r, decoderBufferSize)
+	return &Decoder{
+		r:     br,
+		state: newDecodeState(br, DecodeOptions{}),
+	}
+}
+
+// Decode reads the next value from the stream and stores it in the value pointed to by out
+// It returns io.EOF when the stream ends cleanly before the next value
+// Errors report offsets from the start of the stream
+func (d *Decoder) Decode(out interface{}) error {
+	d.state.reset()
+	return Deserialize(d.state, out)
+}
+
+// SetLimits bounds the resources committed to each decoded value
+// Input that exceeds them fails with a *LimitError before anything is allocated for it
+func (d *Decoder) SetLimits(limits Limits) {
+	d.state.limits = limits
+}
+
+// SetLenient turns off range checks on numbers decoded into narrower Go types (see DecodeOptions)
+func (d *Decoder) SetLenient(lenient bool) {
+	d.state.lenient = lenient
+}
+
+// SetCanonical makes the decoder reject values that are not in canonical form (see DecodeOptions)
+func (d *Decoder) SetCanonical(canonical bool) {
+	d.state.canonical = canonical
+}
+
+// SetStringTable makes the decoder keep the strings interned by one value for the values after it,
+// when the stream was written by an Encoder with StringTableStream
+// Values with their own string table are read with any scope but StringTableStream.
+func (d *Decoder) SetStringTable(scope StringTableScope) {
+	d.state.keepStrings = scope == StringTableStream
+	d.state.resetStrings()
+}
+
+// Reset discards any buffered data and directs the decoder to read from r
+// A stream's string table starts again empty
+func (d *Decoder) Reset(r io.Reader) {
+	d.r.Reset(r)
+	d.state.offset = 0
+	d.state.resetStrings()
+}
+
+// Buffered returns the number of bytes read from the underlying reader but not yet decoded
+func (d *Decoder) Buffered() int {
+	return d.r.Buffered()
+}
@@ -0,0 +1,112 @@
+package serialize
+
+import (
+	"ebe/types"
+	"reflect"
+	"time"
+)
+
+// DeltaMode selects whether arrays of integers and times are encoded as differences between their elements
+// Sorted IDs and timestamps taken at intervals have small differences, which take far fewer bytes than the elements
+type DeltaMode int
+
+const (
+	DeltaNone    DeltaMode = iota // Elements are encoded independently
+	Delta                         // The first element, then the difference from each element to the next
+	DeltaOfDelta                  // The first element and difference, then the change from each difference to the next
+)
+
+// packing returns the packing byte of arrays encoded with the mode
+func (m DeltaMode) packing() byte {
+	if m == DeltaOfDelta {
+		return types.PackedDeltaOfDelta
+	}
+	return types.PackedDelta
+}
+
+// appendDeltaElements appends a delta packed array of elementType elements to dst
+// The bits of the elements are given as for appendNumericElements, with times as nanoseconds since the Unix epoch
+func appendDeltaElements(dst []byte, elementType types.Types, values []uint64, mode DeltaMode) []byte {
+
+	// Packed arrays have at least one element, so empty ones are written as regular arrays
+	if len(values) == 0 {
+		return appendArrayHeader(dst, 0, elementType)
+	}
+
+	dst = appendPackedArrayHeader(dst, len(values), elementType, mode.packing())
+
+	// Differences wrap around, so every pair of elements has one whatever their distance
+	var previous, delta uint64
+	for i, value := range values {
+		switch {
+		case i == 0 && elementType == types.UInt:
+			dst = appendVarint(dst, value)
+		case i == 0:
+			dst = appendVarint(dst, zigzag(int64(value)))
+		case i == 1 || mode == Delta:
+			delta = value - previous
+			dst = appendVarint(dst, zigzag(int64(delta)))
+		default:
+			next := value - previous
+			dst = appendVarint(dst, zigzag(int64(next-delta)))
+			delta = next
+		}
+		previous = value
+	}
+	return dst
+}
+
+// timeNanoseconds returns t as nanoseconds since the Unix epoch, and whether that holds it exactly
+// Only UTC times between the years 1678 and 2262 can be delta encoded
+func timeNanoseconds(t time.Time) (int64, bool) {
+	nanoseconds := t.UnixNano()
+	return nanoseconds, t.Location() == time.UTC && time.Unix(0, nanoseconds).Equal(t)
+}
+
+// deltaElementType returns the element type of delta encoded arrays of Go type t, if they can be delta encoded
+func deltaElementType(t reflect.Type) (types.Types, bool) {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return 0, false
+	}
+	elem := t.Elem()
+	if elem == timeType {
+		return types.Extended, true
+	}
+	if elem.NumMethod() != 0 {
+		return 0, false
+	}
+	switch elem.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.SInt, true
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.UInt, true
+	}
+	return 0, false
+}
+
+// appendDeltaField appends a slice or array of integers or times from a field tagged with a delta option
+// Nil slices are written as Null, and times that cannot be delta encoded fall back to the regular encoding
+func appendDeltaField(dst []byte, rv reflect.Value, mode DeltaMode) ([]byte, error) {
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return appendNull(dst), nil
+	}
+
+	elementType, _ := deltaElementType(rv.Type())
+	values := make([]uint64, rv.Len())
+	for i := range values {
+		element := rv.Index(i)
+		switch elementType {
+		case types.SInt:
+			values[i] = uint64(element.Int())
+		case types.UInt:
+			values[i] = element.Uint()
+		default:
+			nanoseconds, ok := timeNanoseconds(element.Interface().(time.Time))
+			if !ok {
+				return appendValue(dst, rv.Interface())
+			}
+			values[i] = uint64(nanoseconds)
+		}
+	}
+	return appendDeltaElements(dst, elementType, values, mode), nil
+}
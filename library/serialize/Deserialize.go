@@ -1,6 +1,7 @@
 package serialize
 
 import (
+	"bytes"
 	"ebe/types"
 	"ebe/utils"
 	"fmt"
@@ -8,9 +9,18 @@ import (
 	"reflect"
 )
 
+// bytesBufferType is the *bytes.Buffer type, which Buffer values convert to directly
+var bytesBufferType = reflect.TypeOf((*bytes.Buffer)(nil))
+
 // Deserialize reads the serialized type from the header and deserializes into the provided output parameter
+// Numbers are converted to narrower Go types without range checks, as with DecodeOptions.Lenient
 func Deserialize(r io.Reader, out interface{}) error {
-	
+
+	// The outermost call tracks the input offset for error locations, and nested calls share it
+	if _, nested := r.(*decodeState); !nested {
+		return DeserializeWithOptions(r, out, DecodeOptions{Lenient: true})
+	}
+
 	// Validate and get the output value from within the interface{}
 	outValue, err := getOutputValue(out)
 	if err != nil {
@@ -18,17 +28,37 @@ func Deserialize(r io.Reader, out interface{}) error {
 	}
 
 	// Check if this is an empty struct first - they serialize to 0 bytes (no header)
-	if outValue.Kind() == reflect.Struct && isStructEmpty(outValue) {
+	// Types that decode themselves always have a header, whatever their fields
+	if outValue.Kind() == reflect.Struct && isStructEmpty(outValue) && !hasCustomDecoding(out) {
 		return nil
 	}
 	
 	// Read the header byte and delegate to the internal deserializer
+	// A clean end of stream is reported as a bare io.EOF so stream readers can detect it
 	header, err := utils.ReadByte(r)
+	if err == io.EOF {
+		return io.EOF
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
-	
-	return deserializeWithHeaderInternal(r, header, out, outValue)
+
+	if d, ok := r.(*decodeState); ok && d.canonical {
+		err = d.deserializeCanonical(header, out, outValue)
+	} else {
+		err = deserializeWithHeaderInternal(r, header, out, outValue)
+	}
+	if err != nil {
+		return withPath(r, err, "")
+	}
+	return nil
+}
+
+// Unmarshal deserializes a single value from data into the provided output parameter
+// It is an error for data to contain bytes beyond the end of the value
+// Numbers that do not fit the Go type they are decoded into fail with an *OverflowError
+func Unmarshal(data []byte, out interface{}) error {
+	return UnmarshalWithOptions(data, out, DecodeOptions{})
 }
 
 // deserializeWithHeader deserializes data with a pre-read header byte (internal use only)
@@ -48,6 +78,47 @@ func deserializeWithHeaderInternal(r io.Reader, header byte, out interface{}, ou
 	
 	headerType := types.TypeFromHeader(header)
 
+	// A Null marker stands for an absent value and leaves the zero value of the target
+	if headerType == types.Null {
+		return deserializeNull(r, header, outValue)
+	}
+
+	// Types that define their own representation decode themselves
+	if handled, err := deserializeCustom(r, header, out); handled {
+		return err
+	}
+
+	// Pointer targets are allocated on demand and the value is decoded into what they point to
+	// *bytes.Buffer is left to the Buffer conversion, which replaces the buffer with the decoded bytes
+	if outValue.Kind() == reflect.Ptr && outValue.Type() != bytesBufferType {
+		return deserializePointer(r, header, outValue)
+	}
+
+	// Empty interface targets receive the natural Go representation of whatever was encoded,
+	// and typed values restore their registered concrete type in any interface
+	if outValue.Kind() == reflect.Interface {
+		return deserializeInterface(r, header, outValue)
+	}
+
+	// Channels and functions have no encoding to decode from
+	switch outValue.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return &UnsupportedTypeError{GoType: outValue.Type(), Offset: headerOffset(r)}
+	}
+
+	// Containers count towards the nesting depth limit
+	if isNestedHeader(header) {
+		if err := enterNested(r); err != nil {
+			return err
+		}
+		defer leaveNested(r)
+	}
+
+	// Extended values such as time.Time are structs or named integers in Go, so they are decoded before either
+	if headerType == types.Extended {
+		return deserializeExtended(r, header, outValue)
+	}
+
 	// For JSON, parse with header parameter
 	// This has to happen before struct deserialization so we can handle the JSON type correctly
 	if headerType == types.Json {
@@ -57,7 +128,7 @@ func deserializeWithHeaderInternal(r io.Reader, header byte, out interface{}, ou
 	// For structs, validate that we have a struct type header and use header-aware struct deserialization
 	if outValue.Kind() == reflect.Struct {
 		if headerType != types.Struct {
-			return fmt.Errorf("expected Struct header type for struct value, got %v", types.TypeName(headerType))
+			return newTypeMismatch(r, header, outValue.Type())
 		}
 		return deserializeStruct(r, header, outValue)
 	}
@@ -66,6 +137,15 @@ func deserializeWithHeaderInternal(r io.Reader, header byte, out interface{}, ou
 	return deserializeSimpleType(r, header, outValue)
 }
 
+// deserializePointer decodes a non-null value through a pointer target
+// A nil pointer is allocated first, an existing one is decoded into in place
+func deserializePointer(r io.Reader, header byte, outValue reflect.Value) error {
+	if outValue.IsNil() {
+		outValue.Set(reflect.New(outValue.Type().Elem()))
+	}
+	return deserializeWithHeader(r, header, outValue.Interface())
+}
+
 // getOutputValue validates the output parameter and returns the reflect.Value to set
 // Uses fast-path type assertions and cached validation for optimal performance
 func getOutputValue(out interface{}) (reflect.Value, error) {
@@ -136,6 +216,8 @@ func getOutputValue(out interface{}) (reflect.Value, error) {
 		return reflect.ValueOf(v).Elem(), nil
 	case *map[int]string:
 		return reflect.ValueOf(v).Elem(), nil
+	case *interface{}:
+		return reflect.ValueOf(v).Elem(), nil
 	}
 
 	// Fallback to cached reflection for uncommon types
@@ -196,14 +278,12 @@ func isStructEmpty(outValue reflect.Value) bool {
 func deserializeSimpleType(r io.Reader, header byte, outValue reflect.Value) error {
 
 	headerType := types.TypeFromHeader(header)
+	start := headerOffset(r)
 
 	switch headerType {
 	case types.UNibble:
 		value := types.ValueFromHeader(header)
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set UNibble value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.SNibble:
 		var negative = (header & 0x8) != 0
@@ -212,70 +292,56 @@ func deserializeSimpleType(r io.Reader, header byte, outValue reflect.Value) err
 		if negative {
 			value = -value
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set SNibble value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.Boolean:
 		value, err := deserializeBoolean(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set Boolean value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.UInt:
 		value, err := deserializeUint(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set UInt value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.SInt:
 		value, err := deserializeSint(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set SInt value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.Float:
 		value, err := deserializeFloat(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set Float value: %w", err)
+		return setDecodedValue(r, start, header, outValue, value)
+
+	case types.Complex:
+		value, err := deserializeComplex(r, header)
+		if err != nil {
+			return err
 		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.String:
 		value, err := deserializeString(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set String value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.Buffer:
 		value, err := deserializeBuffer(r, header)
 		if err != nil {
 			return err
 		}
-		if err := utils.SetValueWithConversion(outValue, value); err != nil {
-			return fmt.Errorf("failed to set Buffer value: %w", err)
-		}
-		return nil
+		return setDecodedValue(r, start, header, outValue, value)
 
 	case types.Array:
 		if err := deserializeArray(r, header, outValue.Addr().Interface()); err != nil {
@@ -296,7 +362,7 @@ func deserializeSimpleType(r io.Reader, header byte, outValue reflect.Value) err
 		return nil
 
 	default:
-		return fmt.Errorf("unsupported type: %s", types.TypeName(headerType))
+		return &UnsupportedTypeError{Wire: headerType, Offset: start}
 	}
 }
 
@@ -336,12 +402,12 @@ func deserializeInt64(r io.Reader) (int64, error) {
 		}
 		// Check for overflow when converting uint64 to int64
 		if uvalue > 9223372036854775807 { // math.MaxInt64
-			return 0, fmt.Errorf("uint64 value %d overflows int64", uvalue)
+			return 0, &OverflowError{Value: uvalue, GoType: int64Type, Offset: headerOffset(r)}
 		}
 		return int64(uvalue), nil
 
 	default:
-		return 0, fmt.Errorf("cannot deserialize %s as int64", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, int64Type)
 	}
 }
 
@@ -366,7 +432,7 @@ func deserializeUint64(r io.Reader) (uint64, error) {
 		// Convert SNibble to uint64 if non-negative
 		var negative = (header & 0x8) != 0
 		if negative {
-			return 0, fmt.Errorf("cannot convert negative SNibble to uint64")
+			return 0, &OverflowError{Value: -int64(header & 0x7), GoType: uint64Type, Offset: headerOffset(r)}
 		}
 		var magnitude = header & 0x7
 		return uint64(magnitude), nil
@@ -377,12 +443,12 @@ func deserializeUint64(r io.Reader) (uint64, error) {
 			return 0, err
 		}
 		if svalue < 0 {
-			return 0, fmt.Errorf("cannot convert negative int64 %d to uint64", svalue)
+			return 0, &OverflowError{Value: svalue, GoType: uint64Type, Offset: headerOffset(r)}
 		}
 		return uint64(svalue), nil
 
 	default:
-		return 0, fmt.Errorf("cannot deserialize %s as uint64", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, uint64Type)
 	}
 }
 
@@ -427,8 +493,24 @@ func deserializeFloat64(r io.Reader) (float64, error) {
 		return float64(svalue), nil
 
 	default:
-		return 0, fmt.Errorf("cannot deserialize %s as float64", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, float64Type)
 	}
 }
 
+// deserializeComplex128 deserializes a complex128 value directly without reflection
+func deserializeComplex128(r io.Reader) (complex128, error) {
+	header, err := utils.ReadByte(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	headerType := types.TypeFromHeader(header)
+
+	switch headerType {
+	case types.Complex:
+		return deserializeComplex(r, header)
 
+	default:
+		return 0, newTypeMismatch(r, header, complex128Type)
+	}
+}
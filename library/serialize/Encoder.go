@@ -0,0 +1,131 @@
+package serialize
+
+import (
+	"fmt"
+	"io"
+)
+
+// encoderBufferSize is the number of buffered bytes after which an Encoder flushes to its writer
+const encoderBufferSize = 4096
+
+// Encoder writes a sequence of EBE values to an io.Writer through an internal buffer
+// Values are accumulated in memory and written to the underlying writer in large chunks,
+// so Flush must be called once the last value has been encoded.
+// An Encoder can be reused for another writer with Reset, which makes it suitable for pooling.
+type Encoder struct {
+	w         io.Writer
+	buf       []byte
+	canonical bool
+	delta     DeltaMode
+	half      bool         // Floats are written in half precision where it holds them exactly
+	strings   *stringTable // Interned strings, if the encoder has a string table
+	scratch   []byte       // Encoding of the current value before it is made canonical, delta encoded or interned
+}
+
+// NewEncoder returns an Encoder that writes to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:   w,
+		buf: make([]byte, 0, encoderBufferSize),
+	}
+}
+
+// Encode serializes value into the encoder's buffer, flushing to the writer when the buffer is full
+// If serialization fails, any partial output of the value is discarded so the stream stays valid
+func (e *Encoder) Encode(value interface{}) error {
+	var buf []byte
+	var err error
+	if e.canonical || e.delta != DeltaNone || e.half || e.strings != nil {
+		if e.scratch, err = appendValue(e.scratch[:0], value); err != nil {
+			return err
+		}
+		rw := rewriting{delta: e.delta, half: e.half, strings: e.strings}
+		switch {
+		case e.canonical:
+			buf, err = appendCanonical(e.buf, e.scratch)
+		case e.strings != nil:
+			buf, err = appendInterned(e.buf, e.scratch, rw)
+		default:
+			buf, err = appendRewritten(e.buf, e.scratch, rw)
+		}
+	} else {
+		buf, err = appendValue(e.buf, value)
+	}
+	if err != nil {
+		return err
+	}
+	e.buf = buf
+
+	if len(e.buf) >= encoderBufferSize {
+		return e.Flush()
+	}
+
+	return nil
+}
+
+// SetCanonical makes the encoder write every following value in canonical form (see MarshalCanonical)
+func (e *Encoder) SetCanonical(canonical bool) {
+	e.canonical = canonical
+}
+
+// SetDelta makes the encoder delta encode every following array of integers or UTC times, wherever it is nested,
+// when that is smaller than encoding the elements independently
+// Canonical form has no delta encoded arrays, so SetCanonical takes precedence
+func (e *Encoder) SetDelta(mode DeltaMode) {
+	e.delta = mode
+}
+
+// SetHalfPrecision makes the encoder write every following float that IEEE 754 half precision holds exactly,
+// such as 0.5 or 1024, in two bytes instead of four
+// Half precision is off by default, since readers outside Go often have no float16 type to decode it into.
+// Canonical form has no half precision floats, so SetCanonical takes precedence.
+func (e *Encoder) SetHalfPrecision(half bool) {
+	e.half = half
+}
+
+// SetStringTable makes the encoder intern the strings of every following value with a table of the given scope
+// Values encoded with StringTableStream must be read by a Decoder with the same scope, from the first value
+// written after the call or after Reset. Canonical form has no interned strings, so SetCanonical takes precedence.
+func (e *Encoder) SetStringTable(scope StringTableScope) {
+	e.strings = nil
+	if scope != StringTableNone {
+		e.strings = newStringTable(scope == StringTableStream)
+	}
+}
+
+// Flush writes any buffered data to the underlying writer
+func (e *Encoder) Flush() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+
+	n, err := e.w.Write(e.buf)
+	if n < len(e.buf) && err == nil {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		// Keep the unwritten bytes so a later Flush can retry them
+		if n > 0 {
+			e.buf = e.buf[:copy(e.buf, e.buf[n:])]
+		}
+		return fmt.Errorf("failed to flush encoder: %w", err)
+	}
+
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// Reset discards any unflushed data and directs the encoder to write to w
+// A stream's string table starts again empty
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+	e.buf = e.buf[:0]
+	if e.strings != nil {
+		e.strings.truncate(0)
+	}
+}
+
+// Buffered returns the number of bytes that have been encoded but not yet flushed
+func (e *Encoder) Buffered() int {
+	return len(e.buf)
+}
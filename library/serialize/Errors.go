@@ -0,0 +1,210 @@
+package serialize
+
+import (
+	"ebe/types"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Decoding errors carry the location of the failure in two forms:
+// Path is the route from the decoded value to the failing part, such as Users[3].Address.Zip,
+// built from struct field names, array indexes and map keys, and empty for the value itself.
+// Offset is the byte offset in the input of the header of a mismatched or unsupported value,
+// or of the point where the input ran out or an oversized length was read.
+
+// TypeMismatchError reports an encoded value that cannot be stored in the Go value it is decoded into
+type TypeMismatchError struct {
+	Wire   types.Types  // Type found on the wire
+	GoType reflect.Type // Type of the Go value being decoded into
+	Path   string
+	Offset int64
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("ebe: cannot decode %s into %v%s", types.TypeName(e.Wire), e.GoType, location(e.Path, e.Offset))
+}
+
+// TruncatedError reports input that ends in the middle of a value
+// It matches io.ErrUnexpectedEOF with errors.Is
+type TruncatedError struct {
+	Path   string
+	Offset int64
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("ebe: unexpected end of input%s", location(e.Path, e.Offset))
+}
+
+func (e *TruncatedError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// UnsupportedTypeError reports a wire type the decoder does not know, or a Go type that cannot be decoded into
+// Only one of Wire and GoType is set; GoType is nil when the wire type is unsupported
+type UnsupportedTypeError struct {
+	Wire   types.Types
+	GoType reflect.Type
+	Path   string
+	Offset int64
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.GoType != nil {
+		return fmt.Sprintf("ebe: cannot decode into unsupported type %v%s", e.GoType, location(e.Path, e.Offset))
+	}
+	if name := types.TypeName(e.Wire); name != "" {
+		return fmt.Sprintf("ebe: unsupported wire type %s%s", name, location(e.Path, e.Offset))
+	}
+	return fmt.Sprintf("ebe: unsupported wire type %d%s", e.Wire, location(e.Path, e.Offset))
+}
+
+// OverflowError reports a number that cannot be represented by the Go type it is decoded into,
+// such as 300 decoded into a uint8, a negative number into an unsigned type or 1.5 into an int
+type OverflowError struct {
+	Value  interface{}  // Decoded value, as an int64, uint64, float64 or complex128
+	GoType reflect.Type // Type of the Go value being decoded into
+	Path   string
+	Offset int64
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("ebe: %v overflows %v%s", e.Value, e.GoType, location(e.Path, e.Offset))
+}
+
+// NonCanonicalError reports input that is valid but not in canonical form (see MarshalCanonical)
+type NonCanonicalError struct {
+	Reason string // What makes the value non-canonical, such as "duplicate map key"
+	Offset int64
+}
+
+func (e *NonCanonicalError) Error() string {
+	return fmt.Sprintf("ebe: value at offset %d is not canonical: %s", e.Offset, e.Reason)
+}
+
+// StringReferenceError reports an interned string reference to a position the input has not defined
+type StringReferenceError struct {
+	Position uint64 // Position referenced by the input
+	Defined  int    // Number of strings defined before the reference
+	Path     string
+	Offset   int64
+}
+
+func (e *StringReferenceError) Error() string {
+	return fmt.Sprintf("ebe: string reference %d is beyond the %d strings defined%s", e.Position, e.Defined, location(e.Path, e.Offset))
+}
+
+// locatedError is implemented by the decoding errors that record where they happened
+type locatedError interface {
+	error
+	prependPath(segment string)
+}
+
+func (e *TypeMismatchError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+func (e *TruncatedError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+func (e *UnsupportedTypeError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+func (e *OverflowError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+func (e *StringReferenceError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+func (e *LimitError) prependPath(segment string) {
+	e.Path = joinPath(segment, e.Path)
+}
+
+// joinPath puts a field name or [index] segment in front of a path
+func joinPath(segment, path string) string {
+	if segment == "" {
+		return path
+	}
+	if path == "" || strings.HasPrefix(path, "[") {
+		return segment + path
+	}
+	return segment + "." + path
+}
+
+// location formats the path and offset of an error for its message
+func location(path string, offset int64) string {
+	if path == "" {
+		return fmt.Sprintf(" at offset %d", offset)
+	}
+	return fmt.Sprintf(" at %s (offset %d)", path, offset)
+}
+
+// inputOffset returns how many bytes have been consumed from the input, if r is being tracked
+func inputOffset(r io.Reader) int64 {
+	if d, ok := r.(*decodeState); ok {
+		return d.offset
+	}
+	return 0
+}
+
+// headerOffset returns the offset of a header that has just been read from r
+func headerOffset(r io.Reader) int64 {
+	if offset := inputOffset(r); offset > 0 {
+		return offset - 1
+	}
+	return 0
+}
+
+// newTypeMismatch returns a *TypeMismatchError for a value whose header has just been read
+func newTypeMismatch(r io.Reader, header byte, goType reflect.Type) error {
+	return typeMismatchAt(headerOffset(r), header, goType)
+}
+
+// typeMismatchAt returns a *TypeMismatchError for a value whose header is at offset
+func typeMismatchAt(offset int64, header byte, goType reflect.Type) error {
+	return &TypeMismatchError{Wire: types.TypeFromHeader(header), GoType: goType, Offset: offset}
+}
+
+// withPath locates a failure to decode the part of a value named by segment
+// A decoding error found in err is returned on its own with the segment prepended to its path, and an early
+// end of input becomes a *TruncatedError; any other error is returned unchanged
+func withPath(r io.Reader, err error, segment string) error {
+	var located locatedError
+	if errors.As(err, &located) {
+		located.prependPath(segment)
+		return located
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return &TruncatedError{Path: segment, Offset: inputOffset(r)}
+	}
+	return err
+}
+
+// indexSegment returns the path segment of an array element
+func indexSegment(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+// keySegment returns the path segment of a map value
+func keySegment(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return fmt.Sprintf("[%q]", key.String())
+	}
+	return fmt.Sprintf("[%v]", key.Interface())
+}
+
+// Go types that the low-level decoders produce, reported when the wire type does not match
+var (
+	boolType       = reflect.TypeOf(false)
+	complex128Type = reflect.TypeOf(complex128(0))
+	float64Type    = reflect.TypeOf(float64(0))
+	int64Type      = reflect.TypeOf(int64(0))
+	stringType     = reflect.TypeOf("")
+	uint64Type     = reflect.TypeOf(uint64(0))
+)
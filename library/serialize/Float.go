@@ -2,68 +2,164 @@ package serialize
 
 import (
 	"ebe/types"
-	"ebe/utils"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
 )
 
-func serializeFloat(value float64, writer io.Writer) error {
+// appendFloat appends the serialized float to dst
+// Zeros, infinities, NaN, -1 and the integers 1 to 7 are stored in the header alone, and other values
+// use the narrower of single and double precision that holds them exactly
+func appendFloat(dst []byte, value float64) []byte {
+	return appendCompactFloat(dst, value, false)
+}
+
+// appendCompactFloat is appendFloat that also uses half precision, when half is set and it holds the value exactly
+// Half precision is only written for encoders that ask for it, since many readers outside Go have no float16
+func appendCompactFloat(dst []byte, value float64, half bool) []byte {
+	switch {
+	case value == 0:
+		if math.Signbit(value) {
+			return append(dst, types.CreateHeader(types.Float, types.FloatNegativeZero))
+		}
+		return append(dst, types.CreateHeader(types.Float, types.FloatZero))
+
+	case math.IsNaN(value):
+		return append(dst, types.CreateHeader(types.Float, types.FloatNaN))
 
-	// If the value fits into a float32, then serialize as a float32
-	if value >= -math.SmallestNonzeroFloat32 && value <= math.MaxFloat32 {
+	case math.IsInf(value, 1):
+		return append(dst, types.CreateHeader(types.Float, types.FloatInf))
+
+	case math.IsInf(value, -1):
+		return append(dst, types.CreateHeader(types.Float, types.FloatNegativeInf))
+
+	case value == -1:
+		return append(dst, types.CreateHeader(types.Float, types.FloatMinusOne))
+
+	case value >= 1 && value <= 7 && value == math.Trunc(value):
+		return append(dst, types.CreateHeader(types.Float, types.FloatSmallInt+byte(value)-1))
+	}
+
+	// If the value survives a round trip through half precision, then serialize it in two bytes
+	if bits, ok := float16Bits(value); ok && half {
+		dst = append(dst, types.CreateHeader(types.Float, types.FloatHalf))
+		return binary.LittleEndian.AppendUint16(dst, bits)
+	}
+
+	// If the value survives a round trip through float32, then serialize as a float32
+	if fitsFloat32(value) {
 
 		// Write the header as float32
-		if err := utils.WriteByte(writer, types.CreateHeader(types.Float, 4)); err != nil {
-			return err
-		}
+		dst = append(dst, types.CreateHeader(types.Float, types.FloatSingle))
 
 		// Write the value
-		return binary.Write(writer, binary.LittleEndian, float32(value))
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(value)))
 	}
 
 	// Write the header as float64
-	if err := utils.WriteByte(writer, types.CreateHeader(types.Float, 8)); err != nil {
-		return err
-	}
+	dst = append(dst, types.CreateHeader(types.Float, types.FloatDouble))
 
 	// Write the value
-	return binary.Write(writer, binary.LittleEndian, float64(value))
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(value))
 }
 
 // deserializeFloat deserializes a float with a pre-read header byte
 func deserializeFloat(r io.Reader, header byte) (float64, error) {
 	headerType := types.TypeFromHeader(header)
-	headerValue := types.ValueFromHeader(header)
-
-	length := headerValue
+	form := types.ValueFromHeader(header)
 
 	// Make sure the data is a valid float value
 	if headerType != types.Float {
-		return 0, fmt.Errorf("expected Float type, got %v", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, float64Type)
+	}
+
+	switch form {
+	case types.FloatZero:
+		return 0, nil
+	case types.FloatNegativeZero:
+		return math.Copysign(0, -1), nil
+	case types.FloatNaN:
+		return math.NaN(), nil
+	case types.FloatInf:
+		return math.Inf(1), nil
+	case types.FloatNegativeInf:
+		return math.Inf(-1), nil
+	case types.FloatMinusOne:
+		return -1, nil
+	case types.FloatHalf, types.FloatSingle, types.FloatDouble:
+		// The value follows the header
+	default:
+		return float64(form-types.FloatSmallInt) + 1, nil
+	}
+
+	// Read the value and widen it to float64
+	var data [8]byte
+	length := types.FloatDataSize(form)
+	if _, err := io.ReadFull(r, data[:length]); err != nil {
+		return 0, fmt.Errorf("failed to read float%d: %w", 8*length, err)
+	}
+
+	switch form {
+	case types.FloatHalf:
+		return float16Value(binary.LittleEndian.Uint16(data[:2])), nil
+	case types.FloatSingle:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[:4]))), nil
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[:8])), nil
+	}
+}
+
+// float16Bits returns the IEEE 754 half precision bits of a finite non-zero value, if it has an exact half precision form
+func float16Bits(value float64) (uint16, bool) {
+	var sign uint16
+	if value < 0 {
+		sign = 0x8000
+		value = -value
 	}
 
-	if length != 4 && length != 8 {
-		return 0, fmt.Errorf("invalid float length: expected 4 or 8, got %d", length)
+	// Half precision holds 11 significant bits, with exponents from -14 down to -24 for subnormals
+	if value < 0x1p-24 || value > 65504 {
+		return 0, false
 	}
 
-	// Read the value
-	// If the value is a float32 then read into float32 then copy to float64
-	var value float64 = 0
-	if length == 4 {
-		var float32Value float32 = 0
-		err := binary.Read(r, binary.LittleEndian, &float32Value)
-		if err != nil {
-			return 0, fmt.Errorf("failed to read float32: %w", err)
+	if value < 0x1p-14 {
+		mantissa := math.Ldexp(value, 24)
+		if mantissa != math.Trunc(mantissa) {
+			return 0, false
 		}
-		value = float64(float32Value)
-	} else {
-		err := binary.Read(r, binary.LittleEndian, &value)
-		if err != nil {
-			return 0, fmt.Errorf("failed to read float64: %w", err)
+		return sign | uint16(mantissa), true
+	}
+
+	_, exp := math.Frexp(value)
+	exp-- // Frexp returns a fraction in [0.5, 1), half precision uses [1, 2)
+	mantissa := math.Ldexp(value, 10-exp)
+	if mantissa != math.Trunc(mantissa) {
+		return 0, false
+	}
+	return sign | uint16(exp+15)<<10 | uint16(mantissa)&0x3ff, true
+}
+
+// float16Value widens IEEE 754 half precision bits to a float64
+func float16Value(bits uint16) float64 {
+	exp := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+
+	var value float64
+	switch exp {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		value = math.Inf(1)
+		if mantissa != 0 {
+			value = math.NaN()
 		}
+	default:
+		value = math.Ldexp(1024+mantissa, exp-25)
 	}
 
-	return value, nil
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
 }
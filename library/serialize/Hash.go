@@ -0,0 +1,255 @@
+package serialize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"ebe/types"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Hash writes the canonical encoding of value to h
+// Values with equal canonical encodings, such as maps with the same entries, always hash the same,
+// in any process and whatever the order maps were filled in
+// The encoding is written to h in chunks as the value is walked, so the full encoding is never held in memory;
+// only the entries of the map being sorted and single values such as numeric arrays are encoded whole
+func Hash(value interface{}, h hash.Hash) error {
+	s := &hashStream{w: h}
+	chunk, err := s.appendValue(make([]byte, 0, hashChunkSize), reflect.ValueOf(value), nil)
+	if err != nil {
+		return err
+	}
+	_, err = h.Write(chunk)
+	return err
+}
+
+// Sum256 returns the SHA-256 digest of the canonical encoding of value
+func Sum256(value interface{}) ([32]byte, error) {
+	var sum [32]byte
+	h := sha256.New()
+	if err := Hash(value, h); err != nil {
+		return sum, err
+	}
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// hashChunkSize is the amount of output Hash accumulates before writing it
+const hashChunkSize = 4096
+
+// Go types that hashStream recognizes, besides those the low-level decoders report
+var (
+	intType        = reflect.TypeOf(0)
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// hashStream appends the canonical encoding of a value while walking it, and writes the output to w in chunks
+// Structs, maps and arrays of non-numeric elements are walked as appendValue would encode them,
+// and any other value is encoded as usual and canonicalized on its own
+type hashStream struct {
+	w       io.Writer
+	sorting int    // Number of maps whose entries are being collected for sorting
+	scratch []byte // Regular encoding of the value being canonicalized
+}
+
+// appendValue appends the canonical encoding of rv to dst, read from a location of the declared type if there is one
+// Values are walked as reflect.Values, so elements and fields are only copied into interfaces to be canonicalized whole
+func (s *hashStream) appendValue(dst []byte, rv reflect.Value, declared reflect.Type) ([]byte, error) {
+	if rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return appendNull(dst), nil
+	}
+
+	// Interface-typed locations write the type id of registered types first, as appendInterfaceValue does
+	if declared != nil && declared.Kind() == reflect.Interface {
+		if registered, found := lookupRegisteredType(rv.Type()); found {
+			dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedTyped))
+			dst = appendUint(dst, registered.id)
+		}
+	}
+
+	// Common scalars are appended directly, since their canonical form is the one they are encoded in
+	switch rv.Type() {
+	case stringType:
+		return appendString(dst, rv.String()), nil
+	case intType, int64Type:
+		return appendSint(dst, rv.Int()), nil
+	case uint64Type:
+		return appendUint(dst, rv.Uint()), nil
+	case float64Type:
+		return appendFloat(dst, canonicalFloat(rv.Float())), nil
+	case boolType:
+		return appendBoolean(dst, rv.Bool()), nil
+	case bytesBufferType, rawMessageType:
+		return s.appendCanonical(dst, rv.Interface())
+	}
+	if typeCache.GetMarshalerInfo(rv.Type()).Custom() {
+		return s.appendCanonical(dst, rv.Interface())
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return appendNull(dst), nil
+		}
+		return s.appendValue(dst, rv.Elem(), nil)
+
+	case reflect.Struct:
+		return s.appendStruct(dst, rv)
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return appendNull(dst), nil
+		}
+		return s.appendArray(dst, rv)
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return appendNull(dst), nil
+		}
+		return s.appendMap(dst, rv)
+	}
+	return s.appendCanonical(dst, rv.Interface())
+}
+
+// appendCanonical encodes value as usual and appends the canonical form of that encoding to dst
+func (s *hashStream) appendCanonical(dst []byte, value interface{}) ([]byte, error) {
+	var err error
+	if s.scratch, err = appendValue(s.scratch[:0], value); err != nil {
+		return dst, err
+	}
+	return appendCanonical(dst, s.scratch)
+}
+
+// appendStruct appends a struct field by field, as appendStruct would encode it
+func (s *hashStream) appendStruct(dst []byte, rv reflect.Value) ([]byte, error) {
+	structInfo, err := typeCache.GetStructInfo(rv.Type())
+	if err != nil {
+		return dst, fmt.Errorf("failed to get struct info: %w", err)
+	}
+	if structInfo.Empty {
+		return dst, nil
+	}
+
+	// Omitted fields are left out of tagged structs, and written as Null in positional ones
+	if structInfo.Tagged {
+		fieldCount := 0
+		for _, fieldInfo := range structInfo.Fields {
+			if !fieldInfo.OmitEmpty || !rv.FieldByIndex(fieldInfo.Index).IsZero() {
+				fieldCount++
+			}
+		}
+		dst = appendTaggedStructHeader(dst, fieldCount)
+	} else {
+		dst = appendStructHeader(dst, len(structInfo.Fields))
+	}
+
+	for _, fieldInfo := range structInfo.Fields {
+		fieldValue := rv.FieldByIndex(fieldInfo.Index)
+		if fieldInfo.OmitEmpty && fieldValue.IsZero() {
+			if !structInfo.Tagged {
+				dst = appendNull(dst)
+			}
+			continue
+		}
+
+		if structInfo.Tagged {
+			dst = appendUint(dst, fieldInfo.ID)
+		}
+		if fieldInfo.Delta != DeltaNone {
+			if s.scratch, err = appendField(s.scratch[:0], fieldValue, fieldInfo); err == nil {
+				dst, err = appendCanonical(dst, s.scratch)
+			}
+		} else {
+			dst, err = s.appendValue(dst, fieldValue, fieldInfo.Type)
+		}
+		if err != nil {
+			return dst, fmt.Errorf("error serializing field %s: %w", fieldInfo.Name, err)
+		}
+		if dst, err = s.flush(dst); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// appendArray appends an array element by element, unless its elements may be packed,
+// in which case the canonical form depends on all of them and the array is canonicalized whole
+func (s *hashStream) appendArray(dst []byte, rv reflect.Value) ([]byte, error) {
+	elementType, err := typeCache.GetElementType(rv.Type())
+	if err != nil || isPackable(elementType) {
+		return s.appendCanonical(dst, rv.Interface())
+	}
+
+	dst = appendArrayHeader(dst, rv.Len(), elementType)
+	elemType := rv.Type().Elem()
+	for i := range rv.Len() {
+		if dst, err = s.appendValue(dst, rv.Index(i), elemType); err != nil {
+			return dst, fmt.Errorf("failed to serialize array element %d: %w", i, err)
+		}
+		if dst, err = s.flush(dst); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// appendMap appends a map with its entries sorted by their canonical keys
+// Its entries are the only part of the output that is held until the whole map has been walked
+func (s *hashStream) appendMap(dst []byte, rv reflect.Value) ([]byte, error) {
+	s.sorting++
+	defer func() { s.sorting-- }()
+
+	var err error
+	var scratch []byte
+	entries := make([]canonicalEntry, 0, rv.Len())
+	keyType := rv.Type().Key()
+	valueType := rv.Type().Elem()
+	iter := rv.MapRange()
+	for iter.Next() {
+		entry := canonicalEntry{key: len(scratch)}
+		if scratch, err = s.appendValue(scratch, iter.Key(), keyType); err != nil {
+			return dst, fmt.Errorf("failed to serialize map key: %w", err)
+		}
+		entry.value = len(scratch)
+		if scratch, err = s.appendValue(scratch, iter.Value(), valueType); err != nil {
+			return dst, fmt.Errorf("failed to serialize map value: %w", err)
+		}
+		entry.end = len(scratch)
+		entries = append(entries, entry)
+	}
+
+	key := func(e canonicalEntry) []byte { return scratch[e.key:e.value] }
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(key(entries[i]), key(entries[j])) < 0
+	})
+	for i := 1; i < len(entries); i++ {
+		if bytes.Equal(key(entries[i-1]), key(entries[i])) {
+			return dst, &NonCanonicalError{Reason: "duplicate map key"}
+		}
+	}
+
+	dst = appendMapHeader(dst, len(entries))
+	for _, entry := range entries {
+		dst = append(dst, scratch[entry.key:entry.end]...)
+	}
+	return dst, nil
+}
+
+// flush writes dst to the stream's writer once it is large enough and returns it emptied
+// Output is kept while map entries are collected, since it is sorted before being written
+func (s *hashStream) flush(dst []byte) ([]byte, error) {
+	if s.sorting > 0 || len(dst) < hashChunkSize {
+		return dst, nil
+	}
+	if _, err := s.w.Write(dst); err != nil {
+		return dst, err
+	}
+	return dst[:0], nil
+}
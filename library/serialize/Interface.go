@@ -0,0 +1,249 @@
+package serialize
+
+import (
+	"ebe/types"
+	"ebe/utils"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// interfaceType is the interface{} type, the element type of dynamically decoded collections
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// deserializeInterfaceValue deserializes a value into interface{} by peeking at the type
+func deserializeInterfaceValue(r io.Reader, out *interface{}) error {
+
+	// Peek at the header to determine type
+	header, err := utils.ReadByte(r)
+	if err != nil {
+		return fmt.Errorf("failed to read value header: %w", err)
+	}
+
+	value, err := deserializeDynamic(r, header)
+	if err != nil {
+		return err
+	}
+
+	*out = value
+	return nil
+}
+
+// deserializeInterface decodes a value with a pre-read header into an interface target
+// Interfaces with methods can only be filled from typed values whose registered type implements them
+func deserializeInterface(r io.Reader, header byte, outValue reflect.Value) error {
+	start := headerOffset(r)
+	value, err := deserializeDynamic(r, header)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		outValue.Set(reflect.Zero(outValue.Type()))
+		return nil
+	}
+
+	valueReflect := reflect.ValueOf(value)
+	if !valueReflect.Type().AssignableTo(outValue.Type()) {
+		return typeMismatchAt(start, header, outValue.Type())
+	}
+	outValue.Set(valueReflect)
+	return nil
+}
+
+// deserializeDynamic decodes a value with a pre-read header into the natural Go type for its wire type
+// Unsigned integers become uint64, signed integers int64, floats float64, complex numbers complex128,
+// Buffers []byte, Json the encoding/json tree and Null nil
+// Arrays and positional structs become []interface{}, tagged structs map[uint64]interface{} keyed by field id,
+// and maps map[string]interface{} when every key is a string or map[interface{}]interface{} otherwise
+func deserializeDynamic(r io.Reader, header byte) (interface{}, error) {
+
+	headerType := types.TypeFromHeader(header)
+
+	if isNestedHeader(header) {
+		if err := enterNested(r); err != nil {
+			return nil, err
+		}
+		defer leaveNested(r)
+	}
+
+	switch headerType {
+
+	case types.Null:
+		return nil, nil
+
+	case types.UNibble:
+		return uint64(types.ValueFromHeader(header)), nil
+
+	case types.SNibble:
+		var negative = (header & 0x8) != 0
+		var magnitude = header & 0x7
+		value := int64(magnitude)
+		if negative {
+			value = -value
+		}
+		return value, nil
+
+	case types.UInt:
+		return deserializeUint(r, header)
+
+	case types.SInt:
+		return deserializeSint(r, header)
+
+	case types.Float:
+		return deserializeFloat(r, header)
+
+	case types.Complex:
+		return deserializeComplex(r, header)
+
+	case types.Boolean:
+		return deserializeBoolean(r, header)
+
+	case types.String:
+		return deserializeString(r, header)
+
+	case types.Buffer:
+		var value []byte
+		if err := deserializeWithHeader(r, header, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+
+	case types.Json:
+		var value interface{}
+		if err := deserializeJson(r, header, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+
+	case types.Extended:
+		return readExtended(r, header, interfaceType)
+
+	case types.Array:
+		length, elementType, packing, err := readArrayHeader(r, header, interfaceType)
+		if err != nil {
+			return nil, err
+		}
+		if packing.packed {
+			return deserializeDynamicPacked(r, length, elementType, packing)
+		}
+		return deserializeDynamicValues(r, length, "array element")
+
+	case types.Map:
+		return deserializeDynamicMap(r, header)
+
+	case types.Struct:
+		fieldCount, tagged, err := readStructHeader(r, header, interfaceType)
+		if err != nil {
+			return nil, err
+		}
+		if !tagged {
+			return deserializeDynamicValues(r, fieldCount, "struct field")
+		}
+		return deserializeDynamicTaggedStruct(r, fieldCount)
+
+	default:
+		return nil, &UnsupportedTypeError{Wire: headerType, Offset: headerOffset(r)}
+	}
+}
+
+// deserializeDynamicValues decodes count consecutive values into a []interface{}
+func deserializeDynamicValues(r io.Reader, count uint64, what string) ([]interface{}, error) {
+	if err := checkCount(r, count); err != nil {
+		return nil, err
+	}
+	if err := reserveType(r, count, interfaceType); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, count)
+	for i := range values {
+		if err := deserializeInterfaceValue(r, &values[i]); err != nil {
+			return nil, fmt.Errorf("failed to deserialize %s %d: %w", what, i, err)
+		}
+	}
+	return values, nil
+}
+
+// deserializeDynamicPacked decodes the elements of a packed array whose header has been read
+func deserializeDynamicPacked(r io.Reader, length uint64, elementType types.Types, packing arrayPacking) ([]interface{}, error) {
+	p, err := newPackedReader(r, length, packing)
+	if err != nil {
+		return nil, err
+	}
+	if err := reserveType(r, length, interfaceType); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, length)
+	for i := range values {
+		if values[i], err = p.element(elementType); err != nil {
+			return nil, fmt.Errorf("failed to deserialize array element %d: %w", i, err)
+		}
+	}
+	return values, nil
+}
+
+// deserializeDynamicMap decodes a map whose key and value types are only known from the data
+func deserializeDynamicMap(r io.Reader, header byte) (interface{}, error) {
+	entryCount, err := readMapHeader(r, header, interfaceType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read every entry first, since the map type depends on whether all keys are strings
+	// Keys and values are held twice, in the slices and in the map built from them
+	if err := reserveType(r, 4*entryCount, interfaceType); err != nil {
+		return nil, err
+	}
+	keys := make([]interface{}, entryCount)
+	values := make([]interface{}, entryCount)
+	stringKeys := true
+	for i := range keys {
+		if err := deserializeInterfaceValue(r, &keys[i]); err != nil {
+			return nil, fmt.Errorf("failed to deserialize map key %d: %w", i, err)
+		}
+		if err := deserializeInterfaceValue(r, &values[i]); err != nil {
+			return nil, fmt.Errorf("failed to deserialize map value %d: %w", i, err)
+		}
+		if _, ok := keys[i].(string); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		result := make(map[string]interface{}, entryCount)
+		for i, key := range keys {
+			result[key.(string)] = values[i]
+		}
+		return result, nil
+	}
+
+	result := make(map[interface{}]interface{}, entryCount)
+	for i, key := range keys {
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("map key %d of type %T cannot be used as an interface{} map key", i, key)
+		}
+		result[key] = values[i]
+	}
+	return result, nil
+}
+
+// deserializeDynamicTaggedStruct decodes a tagged struct into a map from field id to value
+func deserializeDynamicTaggedStruct(r io.Reader, fieldCount uint64) (map[uint64]interface{}, error) {
+	if err := reserve(r, fieldCount, 8+interfaceType.Size()); err != nil {
+		return nil, err
+	}
+	fields := make(map[uint64]interface{}, fieldCount)
+	for i := uint64(0); i < fieldCount; i++ {
+		id, err := deserializeUintWithHeader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read struct field id: %w", err)
+		}
+
+		var value interface{}
+		if err := deserializeInterfaceValue(r, &value); err != nil {
+			return nil, fmt.Errorf("failed to deserialize struct field id %d: %w", id, err)
+		}
+		fields[id] = value
+	}
+	return fields, nil
+}
@@ -2,24 +2,21 @@ package serialize
 
 import (
 	"ebe/types"
-	"ebe/utils"
 	"encoding/json"
 	"fmt"
 	"io"
+	"reflect"
 )
 
-// SerializeJson serializes a json.RawMessage
+// appendJson appends a serialized json.RawMessage to dst
 // The jsonMessage parameter should come from json.Marshal() wrapped as json.RawMessage
-func serializeJson(jsonMessage json.RawMessage, w io.Writer) error {
+func appendJson(dst []byte, jsonMessage json.RawMessage) []byte {
 	// Write header with JSON type
-	utils.WriteByte(w, types.CreateHeader(types.Json, 0x00))
-	if err := serializeUint(uint64(len(jsonMessage)), w); err != nil {
-		return err
-	}
+	dst = append(dst, types.CreateHeader(types.Json, 0x00))
+	dst = appendUint(dst, uint64(len(jsonMessage)))
 
 	// Write the JSON bytes
-	_, err := w.Write(jsonMessage)
-	return err
+	return append(dst, jsonMessage...)
 }
 
 // DeserializeJson deserializes JSON data from a stream and unmarshals it into the provided output
@@ -28,7 +25,7 @@ func deserializeJson(r io.Reader, header byte, out interface{}) error {
 
 	// Verify the header type
 	if headerType != types.Json {
-		return fmt.Errorf("expected Json type, got %s", types.TypeName(headerType))
+		return newTypeMismatch(r, header, reflect.TypeOf(out).Elem())
 	}
 
 	// Length always follows as a UInt (no nibble optimization)
@@ -38,6 +35,9 @@ func deserializeJson(r io.Reader, header byte, out interface{}) error {
 	}
 
 	// Read the JSON bytes
+	if err := checkPayload(r, length); err != nil {
+		return err
+	}
 	jsonBytes := make([]byte, length)
 	_, err = io.ReadFull(r, jsonBytes)
 	if err != nil {
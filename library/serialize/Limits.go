@@ -0,0 +1,168 @@
+package serialize
+
+import (
+	"ebe/types"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Limits bounds the resources a decoder commits to a single value, so that input from untrusted
+// sources cannot request huge allocations or recurse without bound
+// Limits are checked against the sizes declared on the wire before anything is allocated
+// A zero field means no limit
+type Limits struct {
+	MaxBytes      uint64 // Largest String, Buffer or Json payload in bytes
+	MaxLength     uint64 // Most elements in an Array, entries in a Map or fields in a Struct
+	MaxDepth      int    // Deepest nesting of arrays, maps, structs and typed values
+	MaxAllocation uint64 // Most bytes allocated for payloads and collections while decoding one value
+}
+
+// LimitError reports input that declares a size beyond one of the configured Limits
+type LimitError struct {
+	Limit  string // Name of the exceeded Limits field, such as "MaxBytes"
+	Value  uint64 // Size declared by the input
+	Max    uint64 // Configured limit
+	Path   string
+	Offset int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("ebe: %d exceeds %s limit of %d%s", e.Value, e.Limit, e.Max, location(e.Path, e.Offset))
+}
+
+// DeserializeWithLimits is like Deserialize but fails with a *LimitError when the input exceeds limits
+func DeserializeWithLimits(r io.Reader, out interface{}, limits Limits) error {
+	return DeserializeWithOptions(r, out, DecodeOptions{Limits: limits})
+}
+
+// UnmarshalWithLimits is like Unmarshal but fails with a *LimitError when the input exceeds limits
+func UnmarshalWithLimits(data []byte, out interface{}, limits Limits) error {
+	return UnmarshalWithOptions(data, out, DecodeOptions{Limits: limits})
+}
+
+// remainingInput returns how many bytes are left in readers that know their size, such as *bytes.Reader
+func remainingInput(r io.Reader) (uint64, bool) {
+	if d, ok := r.(*decodeState); ok {
+		r = d.r
+	}
+	if c, ok := r.(*captureReader); ok {
+		r = c.r
+	}
+	if sized, ok := r.(interface{ Len() int }); ok {
+		return uint64(sized.Len()), true
+	}
+	return 0, false
+}
+
+// checkPayload is called with the declared length of a String, Buffer or Json payload before it is allocated
+// Lengths beyond the end of sized input are rejected even without limits, since they can never be read
+func checkPayload(r io.Reader, length uint64) error {
+	if remaining, ok := remainingInput(r); ok && length > remaining {
+		return fmt.Errorf("length %d exceeds the %d bytes of remaining input: %w", length, remaining, io.ErrUnexpectedEOF)
+	}
+
+	d, ok := r.(*decodeState)
+	if !ok {
+		return nil
+	}
+	if d.limits.MaxBytes > 0 && length > d.limits.MaxBytes {
+		return &LimitError{Limit: "MaxBytes", Value: length, Max: d.limits.MaxBytes, Offset: d.offset}
+	}
+	return d.allocate(length, 1)
+}
+
+// checkLength is called with the declared element, entry or field count of a container
+func checkLength(r io.Reader, length uint64) error {
+	d, ok := r.(*decodeState)
+	if !ok || d.limits.MaxLength == 0 || length <= d.limits.MaxLength {
+		return nil
+	}
+	return &LimitError{Limit: "MaxLength", Value: length, Max: d.limits.MaxLength, Offset: d.offset}
+}
+
+// reserve is called before allocating count items of size bytes for a decoded collection
+func reserve(r io.Reader, count uint64, size uintptr) error {
+	d, ok := r.(*decodeState)
+	if !ok {
+		return nil
+	}
+	return d.allocate(count, uint64(size))
+}
+
+// reserveType is reserve for count items of type t
+func reserveType(r io.Reader, count uint64, t reflect.Type) error {
+	if !limitsAllocation(r) {
+		return nil
+	}
+	return reserve(r, count, t.Size())
+}
+
+// limitsAllocation reports whether allocations made while decoding from r are limited
+func limitsAllocation(r io.Reader) bool {
+	d, ok := r.(*decodeState)
+	return ok && d.limits.MaxAllocation > 0
+}
+
+// allocate adds count items of size bytes to the running total and checks it against MaxAllocation
+func (d *decodeState) allocate(count uint64, size uint64) error {
+	if d.limits.MaxAllocation == 0 {
+		return nil
+	}
+
+	// Compare by division so hostile counts cannot overflow the product
+	available := d.limits.MaxAllocation - d.allocated
+	if size > 0 && count > available/size {
+		requested := d.limits.MaxAllocation + 1
+		if count <= (^uint64(0)-d.allocated)/size {
+			requested = d.allocated + count*size
+		}
+		return &LimitError{Limit: "MaxAllocation", Value: requested, Max: d.limits.MaxAllocation, Offset: d.offset}
+	}
+	d.allocated += count * size
+	return nil
+}
+
+// reserveCollection is reserve for count elements of the slice or entries of the map that out points to
+func reserveCollection(r io.Reader, count uint64, out interface{}) error {
+	if !limitsAllocation(r) {
+		return nil
+	}
+	t := reflect.TypeOf(out).Elem()
+	if t.Kind() == reflect.Map {
+		return reserve(r, count, t.Key().Size()+t.Elem().Size())
+	}
+	return reserve(r, count, t.Elem().Size())
+}
+
+// enterNested is called before decoding the contents of a container value and must be paired with leaveNested
+func enterNested(r io.Reader) error {
+	d, ok := r.(*decodeState)
+	if !ok {
+		return nil
+	}
+	if d.limits.MaxDepth > 0 && d.depth >= d.limits.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Value: uint64(d.depth + 1), Max: uint64(d.limits.MaxDepth), Offset: d.offset}
+	}
+	d.depth++
+	return nil
+}
+
+// leaveNested is called after the contents of a container value have been decoded
+func leaveNested(r io.Reader) {
+	if d, ok := r.(*decodeState); ok {
+		d.depth--
+	}
+}
+
+// isNestedHeader reports whether a header starts a value that contains other values
+func isNestedHeader(header byte) bool {
+	switch types.TypeFromHeader(header) {
+	case types.Array, types.Map, types.Struct:
+		return true
+	case types.Extended:
+		return types.ValueFromHeader(header) == types.ExtendedTyped
+	default:
+		return false
+	}
+}
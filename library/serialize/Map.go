@@ -5,259 +5,192 @@ import (
 	"ebe/utils"
 	"fmt"
 	"io"
+	"math/bits"
 	"reflect"
 )
 
-// serializeMap serializes a Go map to the EBE format
+// appendMap appends a Go map in the EBE format to dst
 // Format: [Map Header] [Optional Entry Count] [Key-Value Pairs...]
 // Each key and value is a self-describing EBE value with its own header
-func serializeMap(value interface{}, w io.Writer) error {
+func appendMap(dst []byte, value interface{}) ([]byte, error) {
 	
+	// A nil map is written as Null so it decodes back to nil rather than an empty map
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Map && rv.IsNil() {
+		return appendNull(dst), nil
+	}
+
 	// Try fast paths for common map types first
 	switch m := value.(type) {
 
 	case map[string]int:
-		return serializeMapStringInt(m, w)
+		return appendMapStringInt(dst, m), nil
 
 	case map[string]string:
-		return serializeMapStringString(m, w)
+		return appendMapStringString(dst, m), nil
 
 	case map[string]interface{}:
-		return serializeMapStringInterface(m, w)
+		return appendMapStringInterface(dst, m)
 
 	case map[int]string:
-		return serializeMapIntString(m, w)
+		return appendMapIntString(dst, m), nil
 
 	case map[string]int32:
-		return serializeMapStringInt32(m, w)
+		return appendMapStringInt32(dst, m), nil
 
 	case map[string]bool:
-		return serializeMapStringBool(m, w)
+		return appendMapStringBool(dst, m), nil
 
 	default:
 		// Fall back to generic reflection-based approach
-		return serializeMapGeneric(value, w)
+		return appendMapGeneric(dst, value)
 	}
 }
 
-// serializeMapGeneric handles arbitrary map types using reflection (fallback)
-func serializeMapGeneric(value interface{}, w io.Writer) error {
+// appendMapGeneric handles arbitrary map types using reflection (fallback)
+func appendMapGeneric(dst []byte, value interface{}) ([]byte, error) {
 
 	// Validate input parameter
 	rv := reflect.ValueOf(value)
 	
 	// Ensure we have a map
 	if rv.Kind() != reflect.Map {
-		return fmt.Errorf("expected map, got %v", rv.Kind())
+		return dst, fmt.Errorf("expected map, got %v", rv.Kind())
 	}
 	
-	entryCount := rv.Len()
-	
 	// Write map header with entry count optimization
-	if entryCount <= 7 {
-
-		// Small maps: store count directly in header nibble
-		header := types.CreateHeader(types.Map, byte(entryCount))
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write map header: %w", err)
-		}
-	} else {
-
-		// Large maps: use overflow indicator (8) in header, then UInt for actual count
-		header := types.CreateHeader(types.Map, 8)
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write map header: %w", err)
-		}
-		
-		// Write actual count as standard EBE UInt
-		if err := serializeUint(uint64(entryCount), w); err != nil {
-			return fmt.Errorf("failed to write map entry count: %w", err)
-		}
-	}
+	dst = appendMapHeader(dst, rv.Len())
+	keyType := rv.Type().Key()
+	valueType := rv.Type().Elem()
 	
 	// Write each key-value pair using standard EBE serialization
 	// Each key and value is self-describing with its own header
-	for _, key := range rv.MapKeys() {
+	var err error
+	iter := rv.MapRange()
+	for iter.Next() {
 
 		// Serialize key
-		if err := Serialize(key.Interface(), w); err != nil {
-			return fmt.Errorf("failed to serialize map key: %w", err)
+		if dst, err = appendDeclaredValue(dst, iter.Key().Interface(), keyType); err != nil {
+			return dst, fmt.Errorf("failed to serialize map key: %w", err)
 		}
 		
 		// Serialize corresponding value
-		value := rv.MapIndex(key)
-		if err := Serialize(value.Interface(), w); err != nil {
-			return fmt.Errorf("failed to serialize map value: %w", err)
+		if dst, err = appendDeclaredValue(dst, iter.Value().Interface(), valueType); err != nil {
+			return dst, fmt.Errorf("failed to serialize map value: %w", err)
 		}
 	}
 	
-	return nil
+	return dst, nil
 }
 
 // Fast path serialization functions for common map types
 
-// serializeMapStringInt serializes map[string]int without reflection
-func serializeMapStringInt(m map[string]int, w io.Writer) error {
+// appendMapStringInt serializes map[string]int without reflection
+func appendMapStringInt(dst []byte, m map[string]int) []byte {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
 	// Write key-value pairs directly without reflection
 	for key, value := range m {
-		if err := serializeString(key, w); err != nil {
-			return fmt.Errorf("failed to serialize string key: %w", err)
-		}
-		if err := serializeSint(int64(value), w); err != nil {
-			return fmt.Errorf("failed to serialize int value: %w", err)
-		}
+		dst = appendString(dst, key)
+		dst = appendSint(dst, int64(value))
 	}
 	
-	return nil
+	return dst
 }
 
-// serializeMapStringString serializes map[string]string without reflection
-func serializeMapStringString(m map[string]string, w io.Writer) error {
+// appendMapStringString serializes map[string]string without reflection
+func appendMapStringString(dst []byte, m map[string]string) []byte {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
 	// Write key-value pairs directly without reflection
 	for key, value := range m {
-		if err := serializeString(key, w); err != nil {
-			return fmt.Errorf("failed to serialize string key: %w", err)
-		}
-		if err := serializeString(value, w); err != nil {
-			return fmt.Errorf("failed to serialize string value: %w", err)
-		}
+		dst = appendString(dst, key)
+		dst = appendString(dst, value)
 	}
 	
-	return nil
+	return dst
 }
 
-// serializeMapStringInterface serializes map[string]interface{} with minimal reflection
-func serializeMapStringInterface(m map[string]interface{}, w io.Writer) error {
+// appendMapStringInterface serializes map[string]interface{} with minimal reflection
+func appendMapStringInterface(dst []byte, m map[string]interface{}) ([]byte, error) {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
-	// Write key-value pairs - keys are direct, values need Serialize()
+	// Write key-value pairs - keys are direct, values need appendValue()
+	var err error
 	for key, value := range m {
-		if err := serializeString(key, w); err != nil {
-			return fmt.Errorf("failed to serialize string key: %w", err)
-		}
-		if err := Serialize(value, w); err != nil {
-			return fmt.Errorf("failed to serialize interface{} value: %w", err)
+		dst = appendString(dst, key)
+		if dst, err = appendInterfaceValue(dst, value); err != nil {
+			return dst, fmt.Errorf("failed to serialize interface{} value: %w", err)
 		}
 	}
 	
-	return nil
+	return dst, nil
 }
 
-// serializeMapIntString serializes map[int]string without reflection
-func serializeMapIntString(m map[int]string, w io.Writer) error {
+// appendMapIntString serializes map[int]string without reflection
+func appendMapIntString(dst []byte, m map[int]string) []byte {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
 	// Write key-value pairs directly without reflection
 	for key, value := range m {
-		if err := serializeSint(int64(key), w); err != nil {
-			return fmt.Errorf("failed to serialize int key: %w", err)
-		}
-		if err := serializeString(value, w); err != nil {
-			return fmt.Errorf("failed to serialize string value: %w", err)
-		}
+		dst = appendSint(dst, int64(key))
+		dst = appendString(dst, value)
 	}
 	
-	return nil
+	return dst
 }
 
-// serializeMapStringInt32 serializes map[string]int32 without reflection
-func serializeMapStringInt32(m map[string]int32, w io.Writer) error {
+// appendMapStringInt32 serializes map[string]int32 without reflection
+func appendMapStringInt32(dst []byte, m map[string]int32) []byte {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
 	// Write key-value pairs directly without reflection
 	for key, value := range m {
-		if err := serializeString(key, w); err != nil {
-			return fmt.Errorf("failed to serialize string key: %w", err)
-		}
-		if err := serializeSint(int64(value), w); err != nil {
-			return fmt.Errorf("failed to serialize int32 value: %w", err)
-		}
+		dst = appendString(dst, key)
+		dst = appendSint(dst, int64(value))
 	}
 	
-	return nil
+	return dst
 }
 
-// serializeMapStringBool serializes map[string]bool without reflection
-func serializeMapStringBool(m map[string]bool, w io.Writer) error {
+// appendMapStringBool serializes map[string]bool without reflection
+func appendMapStringBool(dst []byte, m map[string]bool) []byte {
 
-	entryCount := len(m)
-	
 	// Write map header
-	if err := writeMapHeader(entryCount, w); err != nil {
-		return err
-	}
+	dst = appendMapHeader(dst, len(m))
 	
 	// Write key-value pairs directly without reflection
 	for key, value := range m {
-		if err := serializeString(key, w); err != nil {
-			return fmt.Errorf("failed to serialize string key: %w", err)
-		}
-		if err := serializeBoolean(value, w); err != nil {
-			return fmt.Errorf("failed to serialize bool value: %w", err)
-		}
+		dst = appendString(dst, key)
+		dst = appendBoolean(dst, value)
 	}
 	
-	return nil
+	return dst
 }
 
-// writeMapHeader writes the map header with entry count optimization
-func writeMapHeader(entryCount int, w io.Writer) error {
+// appendMapHeader appends the map header with entry count optimization to dst
+func appendMapHeader(dst []byte, entryCount int) []byte {
 
 	if entryCount <= 7 {
 
 		// Small maps: store count directly in header nibble
-		header := types.CreateHeader(types.Map, byte(entryCount))
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write map header: %w", err)
-		}
-	} else {
+		return append(dst, types.CreateHeader(types.Map, byte(entryCount)))
+	}
 
-		// Large maps: use overflow indicator (8) in header, then UInt for actual count
-		header := types.CreateHeader(types.Map, 8)
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write map header: %w", err)
-		}
+	// Large maps: use overflow indicator (8) in header, then UInt for actual count
+	dst = append(dst, types.CreateHeader(types.Map, 8))
 		
-		// Write actual count as standard EBE UInt
-		if err := serializeUint(uint64(entryCount), w); err != nil {
-			return fmt.Errorf("failed to write map entry count: %w", err)
-		}
-	}
-	return nil
+	// Write actual count as standard EBE UInt
+	return appendUint(dst, uint64(entryCount))
 }
 
 // deserializeMap deserializes a map from the EBE format with fast paths for common types
@@ -290,7 +223,7 @@ func deserializeMapGeneric(r io.Reader, header byte, out interface{}) error {
 	// Get the map value (already validated as a settable pointer by main Deserialize)
 	mapValue := reflect.ValueOf(out).Elem()
 	if mapValue.Kind() != reflect.Map {
-		return fmt.Errorf("output parameter must be a pointer to a map, got pointer to %v", mapValue.Kind())
+		return newTypeMismatch(r, header, mapValue.Type())
 	}
 	
 	// Get map type information
@@ -299,29 +232,12 @@ func deserializeMapGeneric(r io.Reader, header byte, out interface{}) error {
 	valueType := mapType.Elem()
 	
 	// Parse map header
-	headerType := types.TypeFromHeader(header)
-	headerValue := types.ValueFromHeader(header)
-	
-	if headerType != types.Map {
-		return fmt.Errorf("expected Map type, got %v", types.TypeName(headerType))
+	entryCount, err := readMapHeader(r, header, mapType)
+	if err != nil {
+		return err
 	}
-	
-	// Determine entry count
-	var entryCount uint64
-	var err error
-	if headerValue <= 7 {
-
-		// Small map: count stored in header
-		entryCount = uint64(headerValue)
-	} else if headerValue == 8 {
-
-		// Large map: read count as UInt
-		entryCount, err = deserializeUintWithHeader(r)
-		if err != nil {
-			return fmt.Errorf("failed to read map entry count: %w", err)
-		}
-	} else {
-		return fmt.Errorf("invalid map header value: %d", headerValue)
+	if err := reserve(r, entryCount, keyType.Size()+valueType.Size()); err != nil {
+		return err
 	}
 	
 	// Initialize the map if it's nil
@@ -338,12 +254,12 @@ func deserializeMapGeneric(r io.Reader, header byte, out interface{}) error {
 		
 		// Deserialize key
 		if err := Deserialize(r, keyPtr.Interface()); err != nil {
-			return fmt.Errorf("failed to deserialize map key %d: %w", i, err)
+			return withPath(r, fmt.Errorf("failed to deserialize map key %d: %w", i, err), fmt.Sprintf("[key %d]", i))
 		}
 		
 		// Deserialize value
 		if err := Deserialize(r, valuePtr.Interface()); err != nil {
-			return fmt.Errorf("failed to deserialize map value %d: %w", i, err)
+			return withPath(r, fmt.Errorf("failed to deserialize map value %d: %w", i, err), keySegment(keyPtr.Elem()))
 		}
 		
 		// Add to map
@@ -357,10 +273,13 @@ func deserializeMapGeneric(r io.Reader, header byte, out interface{}) error {
 
 // deserializeMapStringInt deserializes map[string]int without reflection
 func deserializeMapStringInt(r io.Reader, header byte, out *map[string]int) error {
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -381,6 +300,7 @@ func deserializeMapStringInt(r io.Reader, header byte, out *map[string]int) erro
 		}
 		
 		// Deserialize int value
+		at := inputOffset(r)
 		valueHeader, err := utils.ReadByte(r)
 		if err != nil {
 			return fmt.Errorf("failed to read value header %d: %w", i, err)
@@ -389,6 +309,9 @@ func deserializeMapStringInt(r io.Reader, header byte, out *map[string]int) erro
 		if err != nil {
 			return fmt.Errorf("failed to deserialize int value %d: %w", i, err)
 		}
+		if overflowsInt(value, bits.UintSize) && !isLenient(r) {
+			return &OverflowError{Value: value, GoType: reflect.TypeOf(0), Path: keySegment(reflect.ValueOf(key)), Offset: at}
+		}
 		
 		(*out)[key] = int(value)
 	}
@@ -399,10 +322,13 @@ func deserializeMapStringInt(r io.Reader, header byte, out *map[string]int) erro
 // deserializeMapStringString deserializes map[string]string without reflection
 func deserializeMapStringString(r io.Reader, header byte, out *map[string]string) error {
 
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -441,10 +367,13 @@ func deserializeMapStringString(r io.Reader, header byte, out *map[string]string
 // deserializeMapStringInterface deserializes map[string]interface{} with minimal reflection
 func deserializeMapStringInterface(r io.Reader, header byte, out *map[string]interface{}) error {
 
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -479,10 +408,13 @@ func deserializeMapStringInterface(r io.Reader, header byte, out *map[string]int
 // deserializeMapIntString deserializes map[int]string without reflection
 func deserializeMapIntString(r io.Reader, header byte, out *map[int]string) error {
 
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -493,6 +425,7 @@ func deserializeMapIntString(r io.Reader, header byte, out *map[int]string) erro
 	for i := uint64(0); i < entryCount; i++ {
 
 		// Deserialize int key
+		at := inputOffset(r)
 		keyHeader, err := utils.ReadByte(r)
 		if err != nil {
 			return fmt.Errorf("failed to read key header %d: %w", i, err)
@@ -501,6 +434,9 @@ func deserializeMapIntString(r io.Reader, header byte, out *map[int]string) erro
 		if err != nil {
 			return fmt.Errorf("failed to deserialize int key %d: %w", i, err)
 		}
+		if overflowsInt(keyVal, bits.UintSize) && !isLenient(r) {
+			return &OverflowError{Value: keyVal, GoType: reflect.TypeOf(0), Path: keySegment(reflect.ValueOf(keyVal)), Offset: at}
+		}
 		
 		// Deserialize string value
 		valueHeader, err := utils.ReadByte(r)
@@ -521,10 +457,13 @@ func deserializeMapIntString(r io.Reader, header byte, out *map[int]string) erro
 // deserializeMapStringInt32 deserializes map[string]int32 without reflection
 func deserializeMapStringInt32(r io.Reader, header byte, out *map[string]int32) error {
 
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -544,6 +483,7 @@ func deserializeMapStringInt32(r io.Reader, header byte, out *map[string]int32)
 		}
 		
 		// Deserialize int32 value
+		at := inputOffset(r)
 		valueHeader, err := utils.ReadByte(r)
 		if err != nil {
 			return fmt.Errorf("failed to read value header %d: %w", i, err)
@@ -552,6 +492,9 @@ func deserializeMapStringInt32(r io.Reader, header byte, out *map[string]int32)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize int32 value %d: %w", i, err)
 		}
+		if overflowsInt(value, 32) && !isLenient(r) {
+			return &OverflowError{Value: value, GoType: reflect.TypeOf(int32(0)), Path: keySegment(reflect.ValueOf(key)), Offset: at}
+		}
 		
 		(*out)[key] = int32(value)
 	}
@@ -562,10 +505,13 @@ func deserializeMapStringInt32(r io.Reader, header byte, out *map[string]int32)
 // deserializeMapStringBool deserializes map[string]bool without reflection
 func deserializeMapStringBool(r io.Reader, header byte, out *map[string]bool) error {
 
-	entryCount, err := readMapHeader(r, header)
+	entryCount, err := readMapHeader(r, header, reflect.TypeOf(out).Elem())
 	if err != nil {
 		return err
 	}
+	if err := reserveCollection(r, entryCount, out); err != nil {
+		return err
+	}
 	
 	// Initialize map if nil
 	if *out == nil {
@@ -601,13 +547,14 @@ func deserializeMapStringBool(r io.Reader, header byte, out *map[string]bool) er
 }
 
 // readMapHeader reads and parses the map header, returning entry count
-func readMapHeader(r io.Reader, header byte) (uint64, error) {
+// Headers of other types are reported as a mismatch with goType, the type being decoded into
+func readMapHeader(r io.Reader, header byte, goType reflect.Type) (uint64, error) {
 
 	headerType := types.TypeFromHeader(header)
 	headerValue := types.ValueFromHeader(header)
 	
 	if headerType != types.Map {
-		return 0, fmt.Errorf("expected Map type, got %v", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, goType)
 	}
 	
 	// Determine entry count
@@ -625,78 +572,12 @@ func readMapHeader(r io.Reader, header byte) (uint64, error) {
 	} else {
 		return 0, fmt.Errorf("invalid map header value: %d", headerValue)
 	}
-	
-	return entryCount, nil
-}
-
-// deserializeInterfaceValue deserializes a value into interface{} by peeking at the type
-func deserializeInterfaceValue(r io.Reader, out *interface{}) error {
-
-	// Peek at the header to determine type
-	header, err := utils.ReadByte(r)
-	if err != nil {
-		return fmt.Errorf("failed to read value header: %w", err)
+	if err := checkLength(r, entryCount); err != nil {
+		return 0, err
 	}
-	
-	headerType := types.TypeFromHeader(header)
-	
-	// Create appropriate concrete type based on header
-	switch headerType {
-
-	case types.UNibble, types.UInt:
-		var value uint64
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.SNibble, types.SInt:
-		var value int64
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.Float:
-		var value float64
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.Boolean:
-		var value bool
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.String:
-		var value string
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.Buffer:
-		var value []byte
-		if err := deserializeWithHeader(r, header, &value); err != nil {
-			return err
-		}
-		*out = value
-
-	case types.Array:
-		// For arrays in interface{}, we need to determine element type dynamically
-		// Fall back to generic deserialization
-		return fmt.Errorf("arrays in interface{} values require generic deserialization")
-
-	case types.Map:
-		// For nested maps in interface{}, fall back to generic deserialization
-		return fmt.Errorf("nested maps in interface{} values require generic deserialization")
-		
-	default:
-		return fmt.Errorf("unsupported type in interface{}: %s", types.TypeName(headerType))
+	if err := checkCount(r, entryCount); err != nil {
+		return 0, err
 	}
 	
-	return nil
-}
\ No newline at end of file
+	return entryCount, nil
+}
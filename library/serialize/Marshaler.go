@@ -0,0 +1,143 @@
+package serialize
+
+import (
+	"ebe/types"
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Marshaler is implemented by types that define their own EBE representation
+// MarshalEBE must append exactly one complete, self-describing EBE value (header included)
+// to dst and return the extended slice, typically by calling AppendValue on a compact form of the value.
+type Marshaler interface {
+	MarshalEBE(dst []byte) ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode their own EBE representation
+// UnmarshalEBE is called with the already-read header byte of the value and must consume
+// the rest of the value from r, typically by calling DeserializeWithHeader.
+type Unmarshaler interface {
+	UnmarshalEBE(r io.Reader, header byte) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// DeserializeWithHeader deserializes a value whose header byte has already been read from r
+// It is intended for Unmarshaler implementations that delegate to the standard decoding.
+func DeserializeWithHeader(r io.Reader, header byte, out interface{}) error {
+	return deserializeWithHeader(r, header, out)
+}
+
+// appendMarshaler appends the value produced by a Marshaler to dst
+func appendMarshaler(dst []byte, m Marshaler) ([]byte, error) {
+
+	// A nil pointer cannot be asked to marshal itself, so it is written as Null
+	if isNilPointer(m) {
+		return appendNull(dst), nil
+	}
+
+	start := len(dst)
+	data, err := m.MarshalEBE(dst)
+	if err != nil {
+		return dst, fmt.Errorf("MarshalEBE for %T failed: %w", m, err)
+	}
+	if len(data) <= start {
+		return dst, fmt.Errorf("MarshalEBE for %T did not append a value", m)
+	}
+
+	return data, nil
+}
+
+// appendBinaryMarshaler appends the output of MarshalBinary to dst as a Buffer value
+func appendBinaryMarshaler(dst []byte, m encoding.BinaryMarshaler) ([]byte, error) {
+	if isNilPointer(m) {
+		return appendNull(dst), nil
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return dst, fmt.Errorf("MarshalBinary for %T failed: %w", m, err)
+	}
+
+	return appendBuffer(dst, data), nil
+}
+
+// appendTextMarshaler appends the output of MarshalText to dst as a String value
+func appendTextMarshaler(dst []byte, m encoding.TextMarshaler) ([]byte, error) {
+	if isNilPointer(m) {
+		return appendNull(dst), nil
+	}
+
+	text, err := m.MarshalText()
+	if err != nil {
+		return dst, fmt.Errorf("MarshalText for %T failed: %w", m, err)
+	}
+
+	return appendString(dst, string(text)), nil
+}
+
+// appendViaPointer appends a value whose custom encoding is implemented with a pointer receiver
+// The value is copied into a new addressable location so the method can be called on it
+func appendViaPointer(dst []byte, rv reflect.Value) ([]byte, error) {
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	return appendValue(dst, ptr.Interface())
+}
+
+// hasCustomDecoding reports whether the output pointer decodes itself rather than being filled by reflection
+func hasCustomDecoding(out interface{}) bool {
+	switch out.(type) {
+	case Unmarshaler, encoding.BinaryUnmarshaler, encoding.TextUnmarshaler:
+		return true
+	}
+	return false
+}
+
+// deserializeCustom decodes into an output pointer that implements one of the unmarshaler interfaces
+// The standard library unmarshalers are only used when the wire type matches what their marshalers produce
+// The second return value is false when the value must be decoded by the regular path instead
+func deserializeCustom(r io.Reader, header byte, out interface{}) (bool, error) {
+	if u, ok := out.(Unmarshaler); ok {
+		return true, u.UnmarshalEBE(r, header)
+	}
+
+	switch types.TypeFromHeader(header) {
+	case types.Buffer:
+		if u, ok := out.(encoding.BinaryUnmarshaler); ok {
+			value, err := deserializeBuffer(r, header)
+			if err != nil {
+				return true, err
+			}
+			if err := u.UnmarshalBinary(value.Bytes()); err != nil {
+				return true, fmt.Errorf("UnmarshalBinary for %T failed: %w", out, err)
+			}
+			return true, nil
+		}
+
+	case types.String:
+		if u, ok := out.(encoding.TextUnmarshaler); ok {
+			value, err := deserializeString(r, header)
+			if err != nil {
+				return true, err
+			}
+			if err := u.UnmarshalText([]byte(value)); err != nil {
+				return true, fmt.Errorf("UnmarshalText for %T failed: %w", out, err)
+			}
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isNilPointer reports whether an interface holds a nil pointer
+func isNilPointer(value interface{}) bool {
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,25 @@
+package serialize
+
+import (
+	"ebe/types"
+	"io"
+	"reflect"
+)
+
+// appendNull appends a Null marker to dst
+// Null stands for an absent value and decodes to the zero value of the target
+func appendNull(dst []byte) []byte {
+	return append(dst, types.CreateHeader(types.Null, 0))
+}
+
+// deserializeNull handles a pre-read Null header by resetting the output to its zero value
+func deserializeNull(r io.Reader, header byte, outValue reflect.Value) error {
+	headerType := types.TypeFromHeader(header)
+
+	if headerType != types.Null {
+		return newTypeMismatch(r, header, outValue.Type())
+	}
+
+	outValue.Set(reflect.Zero(outValue.Type()))
+	return nil
+}
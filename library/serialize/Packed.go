@@ -0,0 +1,762 @@
+package serialize
+
+import (
+	"bytes"
+	"ebe/types"
+	"ebe/utils"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// Arrays of SInt, UInt and Float elements are packed when that is smaller than writing a header per element.
+// The packed elements all have the width of the widest one, or are varints when that is smaller still.
+
+// arrayPacking describes how the elements of an array are stored
+type arrayPacking struct {
+	packed bool
+	width  byte // Bytes per packed element, or one of the varint packings such as types.PackedVarint
+}
+
+// fixedWidth reports whether every element takes width bytes, rather than being a varint
+func (p arrayPacking) fixedWidth() bool {
+	return p.width >= 1 && p.width <= 8
+}
+
+// nativeLittleEndian reports whether packed floats have the same layout in memory as on the wire
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// isPackable reports whether arrays of elementType elements can be packed
+func isPackable(elementType types.Types) bool {
+	return elementType == types.SInt || elementType == types.UInt || elementType == types.Float || elementType == types.Boolean
+}
+
+// appendPackedArrayHeader appends the header of a packed array to dst
+func appendPackedArrayHeader(dst []byte, length int, elementType types.Types, width byte) []byte {
+	dst = append(dst, types.CreateHeader(types.Array, types.ArrayPacked))
+	dst = appendUint(dst, uint64(length))
+	return append(dst, byte(elementType), width)
+}
+
+// packedIsSmaller compares a packed array of length elements taking payload bytes with the
+// same array taking regular bytes as elements with headers
+func packedIsSmaller(length int, payload, regular uint64) bool {
+	countSize := uint64(uintSize(uint64(length)))
+	packed := countSize + 1 + payload
+	if length > 7 {
+		regular += countSize
+	}
+	return packed < regular
+}
+
+// sintStats accumulates the encoded sizes of SInt elements to choose between packed and regular arrays
+type sintStats struct {
+	regular uint64 // Bytes of the elements with a header each
+	varint  uint64 // Bytes of the elements as zigzag varints
+	width   byte   // Bytes of the widest element in two's complement
+}
+
+func (s *sintStats) add(value int64) {
+	magnitude := utils.Abs(value)
+	if magnitude <= 0x07 {
+		s.regular++
+	} else {
+		s.regular += 1 + uint64(min(bits.Len64(magnitude)/8+1, 8))
+	}
+
+	s.varint += uint64(varintSize(zigzag(value)))
+
+	complement := uint64(value)
+	if value < 0 {
+		complement = ^complement
+	}
+	if width := byte(min(bits.Len64(complement)/8+1, 8)); width > s.width {
+		s.width = width
+	}
+}
+
+// packing returns the packing for length elements, and whether it is smaller than a regular array
+func (s *sintStats) packing(length int) (byte, bool) {
+	return choosePacking(length, s.width, s.varint, s.regular)
+}
+
+// uintStats accumulates the encoded sizes of UInt elements to choose between packed and regular arrays
+type uintStats struct {
+	regular uint64
+	varint  uint64
+	width   byte
+}
+
+func (s *uintStats) add(value uint64) {
+	s.regular += uint64(uintSize(value))
+	s.varint += uint64(varintSize(value))
+	if width := byte((bits.Len64(value) + 7) / 8); width > s.width {
+		s.width = width
+	}
+}
+
+func (s *uintStats) packing(length int) (byte, bool) {
+	return choosePacking(length, max(s.width, 1), s.varint, s.regular)
+}
+
+// choosePacking picks fixed width or varint elements, whichever is smaller
+func choosePacking(length int, width byte, varint, regular uint64) (byte, bool) {
+	payload := uint64(length) * uint64(width)
+	if varint < payload {
+		width, payload = types.PackedVarint, varint
+	}
+	return width, length > 0 && packedIsSmaller(length, payload, regular)
+}
+
+// floatStats accumulates the encoded sizes of Float elements to choose between packed and regular arrays
+type floatStats struct {
+	regular uint64
+	width   byte // 4 while every element is exact as a float32, otherwise 8
+}
+
+func (s *floatStats) add(value float64) {
+	var scratch [9]byte
+	s.regular += uint64(len(appendFloat(scratch[:0], value)))
+	if s.width < 8 {
+		s.width = 4
+		if !fitsFloat32(value) {
+			s.width = 8
+		}
+	}
+}
+
+func (s *floatStats) packing(length int) (byte, bool) {
+	return s.width, length > 0 && packedIsSmaller(length, uint64(length)*uint64(s.width), s.regular)
+}
+
+// appendSintElements appends an SInt array of length elements given by at, packed if that is smaller
+func appendSintElements(dst []byte, length int, at func(i int) int64) []byte {
+	var stats sintStats
+	for i := 0; i < length; i++ {
+		stats.add(at(i))
+	}
+	width, packed := stats.packing(length)
+	if !packed {
+		dst = appendArrayHeader(dst, length, types.SInt)
+		for i := 0; i < length; i++ {
+			dst = appendSint(dst, at(i))
+		}
+		return dst
+	}
+
+	dst = appendPackedArrayHeader(dst, length, types.SInt, width)
+	for i := 0; i < length; i++ {
+		dst = appendPackedSint(dst, at(i), width)
+	}
+	return dst
+}
+
+// appendUintElements appends a UInt array of length elements given by at, packed if that is smaller
+func appendUintElements(dst []byte, length int, at func(i int) uint64) []byte {
+	var stats uintStats
+	for i := 0; i < length; i++ {
+		stats.add(at(i))
+	}
+	width, packed := stats.packing(length)
+	if !packed {
+		dst = appendArrayHeader(dst, length, types.UInt)
+		for i := 0; i < length; i++ {
+			dst = appendUint(dst, at(i))
+		}
+		return dst
+	}
+
+	dst = appendPackedArrayHeader(dst, length, types.UInt, width)
+	for i := 0; i < length; i++ {
+		dst = appendPackedUint(dst, at(i), width)
+	}
+	return dst
+}
+
+// appendFloatElements appends a Float array of length elements given by at, packed if that is smaller
+// A packed array is left for bulk to fill when it is given and the packed width is bulkWidth
+func appendFloatElements(dst []byte, length int, at func(i int) float64, bulkWidth byte, bulk func([]byte) []byte) []byte {
+	var stats floatStats
+	for i := 0; i < length; i++ {
+		stats.add(at(i))
+	}
+	width, packed := stats.packing(length)
+	if !packed {
+		dst = appendArrayHeader(dst, length, types.Float)
+		for i := 0; i < length; i++ {
+			dst = appendFloat(dst, at(i))
+		}
+		return dst
+	}
+
+	dst = appendPackedArrayHeader(dst, length, types.Float, width)
+	if bulk != nil && width == bulkWidth {
+		return bulk(dst)
+	}
+	for i := 0; i < length; i++ {
+		if width == 8 {
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(at(i)))
+		} else {
+			dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(at(i))))
+		}
+	}
+	return dst
+}
+
+// appendNumericElements appends an array of SInt, UInt, Float or Boolean elements whose bits are given by values,
+// as two's complement, unsigned or IEEE 754 double bits or 0 and 1, packed if that is smaller
+func appendNumericElements(dst []byte, elementType types.Types, values []uint64) []byte {
+	switch elementType {
+	case types.SInt:
+		return appendSintElements(dst, len(values), func(i int) int64 { return int64(values[i]) })
+	case types.UInt:
+		return appendUintElements(dst, len(values), func(i int) uint64 { return values[i] })
+	case types.Boolean:
+		return appendBoolElements(dst, len(values), func(i int) bool { return values[i] != 0 })
+	default:
+		return appendFloatElements(dst, len(values), func(i int) float64 { return math.Float64frombits(values[i]) }, 0, nil)
+	}
+}
+
+// appendPackedSint appends one element of a packed SInt array to dst
+func appendPackedSint(dst []byte, value int64, width byte) []byte {
+	if width == types.PackedVarint {
+		return appendVarint(dst, zigzag(value))
+	}
+	for i := byte(0); i < width; i++ {
+		dst = append(dst, byte(value>>(8*i)))
+	}
+	return dst
+}
+
+// appendPackedUint appends one element of a packed UInt array to dst
+func appendPackedUint(dst []byte, value uint64, width byte) []byte {
+	if width == types.PackedVarint {
+		return appendVarint(dst, value)
+	}
+	for i := byte(0); i < width; i++ {
+		dst = append(dst, byte(value>>(8*i)))
+	}
+	return dst
+}
+
+// appendFloat64s appends the little-endian bits of values to dst, copying them in bulk where memory has the same layout
+func appendFloat64s(dst []byte, values []float64) []byte {
+	if nativeLittleEndian {
+		return append(dst, float64Bytes(values)...)
+	}
+	for _, value := range values {
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(value))
+	}
+	return dst
+}
+
+// appendFloat32s appends the little-endian bits of values to dst, copying them in bulk where memory has the same layout
+func appendFloat32s(dst []byte, values []float32) []byte {
+	if nativeLittleEndian {
+		return append(dst, float32Bytes(values)...)
+	}
+	for _, value := range values {
+		dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(value))
+	}
+	return dst
+}
+
+// float64Bytes returns the memory of values as bytes
+func float64Bytes(values []float64) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(values))), 8*len(values))
+}
+
+// float32Bytes returns the memory of values as bytes
+func float32Bytes(values []float32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(values))), 4*len(values))
+}
+
+// appendVarint appends value as a LEB128 varint to dst
+func appendVarint(dst []byte, value uint64) []byte {
+	for value >= 0x80 {
+		dst = append(dst, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(dst, byte(value))
+}
+
+// zigzag maps signed values to unsigned ones so that small magnitudes of either sign stay small
+func zigzag(value int64) uint64 {
+	return uint64(value<<1) ^ uint64(value>>63)
+}
+
+// unzigzag reverses zigzag
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+// varintSize returns the number of bytes of value as a varint
+func varintSize(value uint64) int {
+	return max(1, (bits.Len64(value)+6)/7)
+}
+
+// uintSize returns the number of bytes appendUint writes for value
+func uintSize(value uint64) int {
+	if value <= 0x0f {
+		return 1
+	}
+	return 1 + (bits.Len64(value)+7)/8
+}
+
+// readPacking reads and validates the packing byte of a packed array with the given element type
+func readPacking(r io.Reader, elementType types.Types) (arrayPacking, error) {
+	width, err := utils.ReadByte(r)
+	if err != nil {
+		return arrayPacking{}, fmt.Errorf("failed to read array packing: %w", err)
+	}
+
+	var valid bool
+	switch {
+	case width == types.PackedDelta || width == types.PackedDeltaOfDelta:
+		valid = elementType == types.SInt || elementType == types.UInt || elementType == types.Extended
+	case elementType == types.Float:
+		valid = width == 4 || width == 8
+	case elementType == types.Boolean:
+		valid = width == types.PackedBits
+	default:
+		valid = isPackable(elementType) && width <= 8
+	}
+	if !valid {
+		return arrayPacking{}, fmt.Errorf("invalid packing %d for %s array elements", width, types.TypeName(elementType))
+	}
+	return arrayPacking{packed: true, width: width}, nil
+}
+
+// packedPayloadSize returns the number of bytes of length fixed width or bit elements, checking that the input can hold them
+func packedPayloadSize(r io.Reader, length uint64, width byte) (uint64, error) {
+	if length > math.MaxUint64/8 {
+		return 0, fmt.Errorf("packed array length %d is too large: %w", length, io.ErrUnexpectedEOF)
+	}
+	size := length * uint64(width)
+	if width == types.PackedBits {
+		size = (length + 7) / 8
+	}
+	if remaining, ok := remainingInput(r); ok && size > remaining {
+		return 0, fmt.Errorf("packed array of %d bytes exceeds the %d bytes of remaining input: %w", size, remaining, io.ErrUnexpectedEOF)
+	}
+	return size, nil
+}
+
+// checkPackedCount rejects packed arrays whose elements cannot fit in the rest of the input even at their smallest,
+// which is a byte for varints and deltas
+func checkPackedCount(r io.Reader, length uint64, packing arrayPacking) error {
+	if packing.fixedWidth() || packing.width == types.PackedBits {
+		_, err := packedPayloadSize(r, length, packing.width)
+		return err
+	}
+	return checkCount(r, length)
+}
+
+// packedReader reads the elements of a packed array one at a time
+type packedReader struct {
+	r       io.Reader
+	width   byte
+	payload []byte // Remaining fixed width elements or every bit, which are read up front
+	offset  int64  // Input offset of the next element
+	scratch []byte // The last element with its header, when elements are decoded one by one
+
+	// Elements of delta packed arrays depend on the ones before them
+	count    int    // Elements read so far
+	previous uint64 // Bits of the last element
+	delta    uint64 // Last difference between elements
+}
+
+// newPackedReader returns a reader for the length elements of a packed array whose header has been read
+func newPackedReader(r io.Reader, length uint64, packing arrayPacking) (*packedReader, error) {
+	p := &packedReader{r: r, width: packing.width, offset: inputOffset(r)}
+	if !packing.fixedWidth() && packing.width != types.PackedBits {
+		return p, nil
+	}
+
+	size, err := packedPayloadSize(r, length, packing.width)
+	if err != nil {
+		return nil, err
+	}
+	if err := reserve(r, size, 1); err != nil {
+		return nil, err
+	}
+	p.payload = make([]byte, size)
+	if _, err := io.ReadFull(r, p.payload); err != nil {
+		return nil, fmt.Errorf("failed to read packed array: %w", err)
+	}
+	return p, nil
+}
+
+// uint returns the next element of a packed UInt array
+func (p *packedReader) uint() (uint64, error) {
+	switch p.width {
+	case types.PackedVarint:
+		return p.varint()
+	case types.PackedDelta, types.PackedDeltaOfDelta:
+		return p.deltaElement(false)
+	}
+	var value uint64
+	for i := int(p.width) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(p.payload[i])
+	}
+	p.payload = p.payload[p.width:]
+	p.offset += int64(p.width)
+	return value, nil
+}
+
+// sint returns the next element of a packed SInt array
+func (p *packedReader) sint() (int64, error) {
+	switch p.width {
+	case types.PackedVarint:
+		value, err := p.varint()
+		return unzigzag(value), err
+	case types.PackedDelta, types.PackedDeltaOfDelta:
+		value, err := p.deltaElement(true)
+		return int64(value), err
+	}
+	value, _ := p.uint()
+
+	// Extend the sign bit of the top byte
+	shift := 64 - 8*uint(p.width)
+	return int64(value<<shift) >> shift, nil
+}
+
+// float returns the next element of a packed Float array
+func (p *packedReader) float() (float64, error) {
+	value, _ := p.uint()
+	if p.width == 4 {
+		return float64(math.Float32frombits(uint32(value))), nil
+	}
+	return math.Float64frombits(value), nil
+}
+
+// deltaElement returns the next element of a delta packed array, whose first element is zigzag encoded if signed
+func (p *packedReader) deltaElement(signed bool) (uint64, error) {
+	value, err := p.varint()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case p.count == 0 && signed:
+		p.previous = uint64(unzigzag(value))
+	case p.count == 0:
+		p.previous = value
+	case p.count == 1 || p.width == types.PackedDelta:
+		p.delta = uint64(unzigzag(value))
+		p.previous += p.delta
+	default:
+		p.delta += uint64(unzigzag(value))
+		p.previous += p.delta
+	}
+	p.count++
+	return p.previous, nil
+}
+
+// bool returns the next element of a packed Boolean array
+func (p *packedReader) bool() bool {
+	value := p.payload[p.count/8]>>(p.count%8)&1 != 0
+	p.count++
+	if p.count%8 == 0 {
+		p.offset++
+	}
+	return value
+}
+
+// time returns the next element of a packed array of times
+func (p *packedReader) time() (time.Time, error) {
+	nanoseconds, err := p.sint()
+	return time.Unix(0, nanoseconds).UTC(), err
+}
+
+// element returns the next element as the natural Go type for its wire type
+func (p *packedReader) element(elementType types.Types) (interface{}, error) {
+	switch elementType {
+	case types.SInt:
+		return p.sint()
+	case types.UInt:
+		return p.uint()
+	case types.Extended:
+		return p.time()
+	case types.Boolean:
+		return p.bool(), nil
+	default:
+		return p.float()
+	}
+}
+
+// bits returns the next element as an int64, float64 or time in nanoseconds converted bit for bit to a uint64,
+// as a uint64, or as 0 or 1 for a Boolean
+func (p *packedReader) bits(elementType types.Types) (uint64, error) {
+	switch elementType {
+	case types.SInt:
+		value, err := p.sint()
+		return uint64(value), err
+	case types.UInt:
+		return p.uint()
+	case types.Extended:
+		value, err := p.sint()
+		return uint64(value), err
+	case types.Boolean:
+		if p.bool() {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		value, err := p.float()
+		return math.Float64bits(value), err
+	}
+}
+
+// varint reads a LEB128 varint from the input
+func (p *packedReader) varint() (uint64, error) {
+	var value uint64
+	for shift := uint(0); ; shift += 7 {
+		b, err := utils.ReadByte(p.r)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read packed varint: %w", err)
+		}
+		p.offset++
+		if shift == 63 && b > 1 {
+			return 0, fmt.Errorf("packed varint overflows 64 bits")
+		}
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value, nil
+		}
+	}
+}
+
+// appendRegular appends the next element to dst as a value with its own header
+func (p *packedReader) appendRegular(dst []byte, elementType types.Types) ([]byte, error) {
+	switch elementType {
+	case types.SInt:
+		value, err := p.sint()
+		return appendSint(dst, value), err
+	case types.UInt:
+		value, err := p.uint()
+		return appendUint(dst, value), err
+	case types.Extended:
+		value, err := p.time()
+		return appendTime(dst, value), err
+	case types.Boolean:
+		return appendBoolean(dst, p.bool()), nil
+	default:
+		value, err := p.float()
+		return appendFloat(dst, value), err
+	}
+}
+
+// deserializeElement decodes the next element into out as if it had its own header
+// The element is decoded with the options, limits and offsets of the array it belongs to
+func (p *packedReader) deserializeElement(elementType types.Types, out interface{}) error {
+	at := p.offset
+	var err error
+	if p.scratch, err = p.appendRegular(p.scratch[:0], elementType); err != nil {
+		return err
+	}
+
+	element := decodeState{lenient: true}
+	d, tracked := p.r.(*decodeState)
+	if tracked {
+		element = *d
+	}
+	element.setReader(bytes.NewReader(p.scratch))
+	element.offset, element.canonical = at, false
+	err = Deserialize(&element, out)
+	if tracked {
+		d.allocated = element.allocated
+	}
+	return err
+}
+
+// skipPacked reads past the elements of a packed array whose header has been read
+func skipPacked(r io.Reader, length uint64, packing arrayPacking) error {
+	if packing.fixedWidth() || packing.width == types.PackedBits {
+		size, err := packedPayloadSize(r, length, packing.width)
+		if err != nil {
+			return err
+		}
+		return skipBytes(r, size)
+	}
+
+	p := &packedReader{r: r}
+	for i := uint64(0); i < length; i++ {
+		if _, err := p.varint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFloat64s reads length packed float64 elements straight into the memory of a new slice
+func readFloat64s(r io.Reader, length uint64) ([]float64, error) {
+	if _, err := packedPayloadSize(r, length, 8); err != nil {
+		return nil, err
+	}
+	values := make([]float64, length)
+	data := float64Bytes(values)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read packed array: %w", err)
+	}
+	if !nativeLittleEndian {
+		for i := range values {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+		}
+	}
+	return values, nil
+}
+
+// readFloat32s reads length packed float32 elements straight into the memory of a new slice
+func readFloat32s(r io.Reader, length uint64) ([]float32, error) {
+	if _, err := packedPayloadSize(r, length, 4); err != nil {
+		return nil, err
+	}
+	values := make([]float32, length)
+	data := float32Bytes(values)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read packed array: %w", err)
+	}
+	if !nativeLittleEndian {
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+		}
+	}
+	return values, nil
+}
+
+// deserializePackedIntArray fills an integer slice from the elements of a packed SInt array
+func deserializePackedIntArray(r io.Reader, length uint64, packing arrayPacking, out interface{}) error {
+	p, err := newPackedReader(r, length, packing)
+	if err != nil {
+		return err
+	}
+
+	var bitSize uint
+	var set func(i int, value int64)
+	switch ptr := out.(type) {
+	case *[]int:
+		*ptr = make([]int, length)
+		bitSize, set = bits.UintSize, func(i int, value int64) { (*ptr)[i] = int(value) }
+	case *[]int32:
+		*ptr = make([]int32, length)
+		bitSize, set = 32, func(i int, value int64) { (*ptr)[i] = int32(value) }
+	case *[]int64:
+		*ptr = make([]int64, length)
+		bitSize, set = 64, func(i int, value int64) { (*ptr)[i] = value }
+	case *[]int8:
+		*ptr = make([]int8, length)
+		bitSize, set = 8, func(i int, value int64) { (*ptr)[i] = int8(value) }
+	case *[]int16:
+		*ptr = make([]int16, length)
+		bitSize, set = 16, func(i int, value int64) { (*ptr)[i] = int16(value) }
+	default:
+		return fmt.Errorf("unsupported integer array type: %T", out)
+	}
+
+	strict := !isLenient(r)
+	goType := reflect.TypeOf(out).Elem().Elem()
+	for i := 0; i < int(length); i++ {
+		at := p.offset
+		elem, err := p.sint()
+		if err != nil {
+			return fmt.Errorf("failed to deserialize packed int element %d: %w", i, err)
+		}
+		if strict && overflowsInt(elem, bitSize) {
+			return elementOverflow(elem, goType, i, at)
+		}
+		set(i, elem)
+	}
+	return nil
+}
+
+// deserializePackedUintArray fills an unsigned integer slice from the elements of a packed UInt array
+func deserializePackedUintArray(r io.Reader, length uint64, packing arrayPacking, out interface{}) error {
+	p, err := newPackedReader(r, length, packing)
+	if err != nil {
+		return err
+	}
+
+	var bitSize uint
+	var set func(i int, value uint64)
+	switch ptr := out.(type) {
+	case *[]uint:
+		*ptr = make([]uint, length)
+		bitSize, set = bits.UintSize, func(i int, value uint64) { (*ptr)[i] = uint(value) }
+	case *[]uint32:
+		*ptr = make([]uint32, length)
+		bitSize, set = 32, func(i int, value uint64) { (*ptr)[i] = uint32(value) }
+	case *[]uint64:
+		*ptr = make([]uint64, length)
+		bitSize, set = 64, func(i int, value uint64) { (*ptr)[i] = value }
+	case *[]uint16:
+		*ptr = make([]uint16, length)
+		bitSize, set = 16, func(i int, value uint64) { (*ptr)[i] = uint16(value) }
+	default:
+		return fmt.Errorf("unsupported unsigned integer array type: %T", out)
+	}
+
+	strict := !isLenient(r)
+	goType := reflect.TypeOf(out).Elem().Elem()
+	for i := 0; i < int(length); i++ {
+		at := p.offset
+		elem, err := p.uint()
+		if err != nil {
+			return fmt.Errorf("failed to deserialize packed uint element %d: %w", i, err)
+		}
+		if strict && overflowsUint(elem, bitSize) {
+			return elementOverflow(elem, goType, i, at)
+		}
+		set(i, elem)
+	}
+	return nil
+}
+
+// deserializePackedFloatArray fills a float slice from the elements of a packed Float array
+// Elements that already have the width of the slice's elements are read straight into its memory
+func deserializePackedFloatArray(r io.Reader, length uint64, packing arrayPacking, out interface{}) error {
+	var err error
+	switch ptr := out.(type) {
+	case *[]float64:
+		if packing.width == 8 {
+			*ptr, err = readFloat64s(r, length)
+			return err
+		}
+	case *[]float32:
+		if packing.width == 4 {
+			*ptr, err = readFloat32s(r, length)
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported float array type: %T", out)
+	}
+
+	p, err := newPackedReader(r, length, packing)
+	if err != nil {
+		return err
+	}
+	strict := !isLenient(r)
+	switch ptr := out.(type) {
+	case *[]float64:
+		*ptr = make([]float64, length)
+		for i := range *ptr {
+			(*ptr)[i], _ = p.float()
+		}
+	case *[]float32:
+		*ptr = make([]float32, length)
+		for i := range *ptr {
+			at := p.offset
+			elem, _ := p.float()
+			if strict && overflowsFloat32(elem) {
+				return elementOverflow(elem, reflect.TypeOf(float32(0)), i, at)
+			}
+			(*ptr)[i] = float32(elem)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package serialize
+
+import (
+	"ebe/types"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// registeredType is a concrete type that can be decoded into interface-typed locations
+type registeredType struct {
+	name string
+	id   uint64
+	t    reflect.Type
+}
+
+// registry holds the types recorded by RegisterType
+// Lookups happen on every interface-typed value, so they are lock-free; registration is serialized
+var registry = struct {
+	sync.Mutex
+	byType sync.Map // reflect.Type -> *registeredType
+	byID   sync.Map // uint64 -> *registeredType
+}{}
+
+// RegisterType records the concrete type of prototype under name so values of that type stored in
+// interface-typed struct fields, slice elements and map entries decode back to their concrete type
+// Such values are written as a typed value carrying a compact id derived from name, so every program
+// that exchanges them must register the type under the same name
+// Registering the same type under the same name again is a no-op; any other conflict panics, as with gob.Register
+func RegisterType(name string, prototype interface{}) {
+	if name == "" {
+		panic("ebe: RegisterType with empty name")
+	}
+	if prototype == nil {
+		panic("ebe: RegisterType with nil prototype")
+	}
+
+	t := reflect.TypeOf(prototype)
+	id := typeID(name)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if existing, found := registry.byType.Load(t); found {
+		if existing.(*registeredType).name == name {
+			return
+		}
+		panic(fmt.Sprintf("ebe: registering duplicate types for %v: %q != %q", t, existing.(*registeredType).name, name))
+	}
+	if existing, found := registry.byID.Load(id); found {
+		registered := existing.(*registeredType)
+		if registered.name == name {
+			panic(fmt.Sprintf("ebe: registering duplicate names for %q: %v != %v", name, registered.t, t))
+		}
+		panic(fmt.Sprintf("ebe: type names %q and %q have the same id %d", registered.name, name, id))
+	}
+
+	registered := &registeredType{name: name, id: id, t: t}
+	registry.byType.Store(t, registered)
+	registry.byID.Store(id, registered)
+}
+
+// typeID derives the wire id of a registered type from its name
+func typeID(name string) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return uint64(h.Sum32())
+}
+
+// lookupRegisteredType returns the registration of a concrete type
+func lookupRegisteredType(t reflect.Type) (*registeredType, bool) {
+	registered, found := registry.byType.Load(t)
+	if !found {
+		return nil, false
+	}
+	return registered.(*registeredType), true
+}
+
+// lookupRegisteredID returns the registration for a wire type id
+func lookupRegisteredID(id uint64) (*registeredType, bool) {
+	registered, found := registry.byID.Load(id)
+	if !found {
+		return nil, false
+	}
+	return registered.(*registeredType), true
+}
+
+// appendDeclaredValue appends a value read from a location whose Go type is declared
+// Interface-typed locations hold values whose concrete type would otherwise be lost
+func appendDeclaredValue(dst []byte, value interface{}, declared reflect.Type) ([]byte, error) {
+	if declared.Kind() == reflect.Interface {
+		return appendInterfaceValue(dst, value)
+	}
+	return appendValue(dst, value)
+}
+
+// appendInterfaceValue appends a value held in an interface, as a typed value if its concrete type is registered
+// Format: [Extended Header: Typed] [UInt type id] [Value]
+func appendInterfaceValue(dst []byte, value interface{}) ([]byte, error) {
+	if value != nil {
+		if registered, found := lookupRegisteredType(reflect.TypeOf(value)); found {
+			dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedTyped))
+			dst = appendUint(dst, registered.id)
+		}
+	}
+	return appendValue(dst, value)
+}
+
+// readTyped reads the type id and value of a typed value and returns the value as its registered concrete type
+func readTyped(r io.Reader) (interface{}, error) {
+	id, err := deserializeUintWithHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read type id: %w", err)
+	}
+
+	registered, found := lookupRegisteredID(id)
+	if !found {
+		return nil, fmt.Errorf("no type registered with id %d", id)
+	}
+
+	ptr := reflect.New(registered.t)
+	if err := Deserialize(r, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to deserialize %s: %w", registered.name, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
@@ -2,165 +2,256 @@ package serialize
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
+	"sync"
+	"time"
 )
 
+// maxPooledBufferSize caps the capacity of buffers returned to the pool so that one very large
+// value does not pin its memory for the lifetime of the process
+const maxPooledBufferSize = 64 * 1024
+
+// bufferPool holds scratch buffers used by Serialize so that writing to an io.Writer
+// does not allocate a new encoding buffer per call
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
 // Serialize takes any supported value and serializes it to the writer
+// The value is encoded into a pooled buffer first, so the writer receives a single Write call
 func Serialize(value interface{}, w io.Writer) error {
+	bufPtr := bufferPool.Get().(*[]byte)
+	data, err := appendValue((*bufPtr)[:0], value)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+
+	if cap(data) <= maxPooledBufferSize {
+		*bufPtr = data[:0]
+		bufferPool.Put(bufPtr)
+	}
+	return err
+}
+
+// Marshal returns the serialized form of value as a new byte slice
+func Marshal(value interface{}) ([]byte, error) {
+	return appendValue(nil, value)
+}
+
+// AppendValue appends the serialized form of value to dst and returns the extended slice
+// Reusing dst across calls makes encoding of primitives and fast-path collections allocation-free
+// On error the returned slice is dst truncated to its original length
+func AppendValue(dst []byte, value interface{}) ([]byte, error) {
+	data, err := appendValue(dst, value)
+	if err != nil {
+		return dst, err
+	}
+	return data, nil
+}
+
+// appendValue appends the serialized form of any supported value to dst
+func appendValue(dst []byte, value interface{}) ([]byte, error) {
 
 	// Fast path type assertions - handle ALL common types before any reflection
 	switch v := value.(type) {
 
+	// A nil interface has no type to encode, so it is written as Null
+	case nil:
+		return appendNull(dst), nil
+
+	// Types that define their own representation take precedence over everything else
+	case Marshaler:
+		return appendMarshaler(dst, v)
+
 	// Primitive types (non-pointer)
 	case json.RawMessage:
-		return serializeJson(v, w)
+		return appendJson(dst, v), nil
 	case uint64:
-		return serializeUint(v, w)
+		return appendUint(dst, v), nil
 	case uint32:
-		return serializeUint(uint64(v), w)
+		return appendUint(dst, uint64(v)), nil
 	case uint16:
-		return serializeUint(uint64(v), w)
+		return appendUint(dst, uint64(v)), nil
 	case uint8:
-		return serializeUint(uint64(v), w)
+		return appendUint(dst, uint64(v)), nil
 	case uint:
-		return serializeUint(uint64(v), w)
+		return appendUint(dst, uint64(v)), nil
 	case int64:
-		return serializeSint(v, w)
+		return appendSint(dst, v), nil
 	case int32:
-		return serializeSint(int64(v), w)
+		return appendSint(dst, int64(v)), nil
 	case int16:
-		return serializeSint(int64(v), w)
+		return appendSint(dst, int64(v)), nil
 	case int8:
-		return serializeSint(int64(v), w)
+		return appendSint(dst, int64(v)), nil
 	case int:
-		return serializeSint(int64(v), w)
+		return appendSint(dst, int64(v)), nil
 	case float64:
-		return serializeFloat(v, w)
+		return appendFloat(dst, v), nil
 	case float32:
-		return serializeFloat(float64(v), w)
+		return appendFloat(dst, float64(v)), nil
+	case complex128:
+		return appendComplex(dst, v), nil
+	case complex64:
+		return appendComplex(dst, complex128(v)), nil
 	case bool:
-		return serializeBoolean(v, w)
+		return appendBoolean(dst, v), nil
 	case string:
-		return serializeString(v, w)
+		return appendString(dst, v), nil
+	case time.Time:
+		return appendTime(dst, v), nil
+	case time.Duration:
+		return appendDuration(dst, v), nil
 	case []byte:
-		return serializeBuffer(v, w)
+		if v == nil {
+			return appendNull(dst), nil
+		}
+		return appendBuffer(dst, v), nil
 	case *bytes.Buffer:
-		return serializeBuffer(v.Bytes(), w)
+		if v == nil {
+			return appendNull(dst), nil
+		}
+		return appendBuffer(dst, v.Bytes()), nil
 
 	// Array types (non-pointer)
 	case []int, []int32, []int64, []int8, []int16:
-		return serializeIntArray(v, w)
+		return appendIntArray(dst, v)
 	case []uint, []uint32, []uint64, []uint16:
-		return serializeUintArray(v, w)
+		return appendUintArray(dst, v)
 	case []float32, []float64:
-		return serializeFloatArray(v, w)
+		return appendFloatArray(dst, v)
+	case []complex64, []complex128:
+		return appendComplexArray(dst, v)
 	case []string:
-		return serializeStringArray(v, w)
+		return appendStringArray(dst, v), nil
 	case []bool:
-		return serializeBoolArray(v, w)
+		return appendBoolArray(dst, v), nil
 
 	// Map types (non-pointer)
 	case map[string]int:
-		return serializeMap(v, w)
+		return appendMap(dst, v)
 	case map[string]string:
-		return serializeMap(v, w)
+		return appendMap(dst, v)
 	case map[string]interface{}:
-		return serializeMap(v, w)
+		return appendMap(dst, v)
 	case map[int]string:
-		return serializeMap(v, w)
+		return appendMap(dst, v)
 	case map[int]int:
-		return serializeMap(v, w)
+		return appendMap(dst, v)
 
-	// Pointer types - fast paths
+	// Pointer types - fast paths, nil pointers are written as Null
 	case *int:
 		if v != nil {
-			return serializeSint(int64(*v), w)
+			return appendSint(dst, int64(*v)), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *int32:
 		if v != nil {
-			return serializeSint(int64(*v), w)
+			return appendSint(dst, int64(*v)), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *int64:
 		if v != nil {
-			return serializeSint(*v, w)
+			return appendSint(dst, *v), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *uint:
 		if v != nil {
-			return serializeUint(uint64(*v), w)
+			return appendUint(dst, uint64(*v)), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *uint32:
 		if v != nil {
-			return serializeUint(uint64(*v), w)
+			return appendUint(dst, uint64(*v)), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *uint64:
 		if v != nil {
-			return serializeUint(*v, w)
+			return appendUint(dst, *v), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *float32:
 		if v != nil {
-			return serializeFloat(float64(*v), w)
+			return appendFloat(dst, float64(*v)), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *float64:
 		if v != nil {
-			return serializeFloat(*v, w)
+			return appendFloat(dst, *v), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *bool:
 		if v != nil {
-			return serializeBoolean(*v, w)
+			return appendBoolean(dst, *v), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
 	case *string:
 		if v != nil {
-			return serializeString(*v, w)
+			return appendString(dst, *v), nil
 		}
-		return fmt.Errorf("cannot serialize nil pointer")
+		return appendNull(dst), nil
+	case *time.Time:
+		if v != nil {
+			return appendTime(dst, *v), nil
+		}
+		return appendNull(dst), nil
+
+	// Standard library encodings for types without an EBE representation of their own
+	case encoding.BinaryMarshaler:
+		return appendBinaryMarshaler(dst, v)
+	case encoding.TextMarshaler:
+		return appendTextMarshaler(dst, v)
 
 	default:
 		// Only use reflection as last resort for unknown types
-		return serializeWithReflection(value, w)
+		return appendWithReflection(dst, value)
 	}
 }
 
-// serializeWithReflection handles types that couldn't be handled by fast path type assertions
-func serializeWithReflection(value interface{}, w io.Writer) error {
+// appendWithReflection handles types that couldn't be handled by fast path type assertions
+func appendWithReflection(dst []byte, value interface{}) ([]byte, error) {
 	rv := reflect.ValueOf(value)
+
+	// Values whose custom encoding is implemented with a pointer receiver
+	if rv.IsValid() && typeCache.GetMarshalerInfo(rv.Type()).ViaPointer {
+		return appendViaPointer(dst, rv)
+	}
 	
 	// Handle other pointer types with reflection
 	if rv.Kind() == reflect.Ptr {
 		if rv.IsNil() {
-			return fmt.Errorf("cannot serialize nil pointer")
+			return appendNull(dst), nil
 		}
 		rv = rv.Elem()
 		value = rv.Interface() // Update value to the dereferenced value
 		// Try fast path again after dereferencing
-		return Serialize(value, w)
+		return appendValue(dst, value)
 	}
 
 	// Handle structs by serializing each exported field in order
 	if rv.Kind() == reflect.Struct {
-		return serializeStruct(value, w)
+		return appendStruct(dst, value)
 	}
 
-	// Check if it's an array or slice
+	// Check if it's an array or slice, a nil slice is written as Null so it decodes back to nil
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return appendNull(dst), nil
+	}
 	if rv.Kind() == reflect.Array || rv.Kind() == reflect.Slice {
-		return serializeArray(rv, w)
+		return appendArray(dst, rv)
 	}
 
 	// Check if it's a map
 	if rv.Kind() == reflect.Map {
-		return serializeMap(value, w)
+		return appendMap(dst, value)
 	}
 
-	return fmt.Errorf("unsupported type for serialization: %T", value)
+	return dst, fmt.Errorf("unsupported type for serialization: %T", value)
 }
\ No newline at end of file
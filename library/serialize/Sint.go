@@ -7,7 +7,8 @@ import (
 	"io"
 )
 
-func serializeSint(value int64, writer io.Writer) error {
+// appendSint appends the serialized signed integer to dst
+func appendSint(dst []byte, value int64) []byte {
 
 	// Get the negative sign and the abs of the data since we will store the value as
 	// an unsigned integer with the high bit used as the negative sign
@@ -29,7 +30,7 @@ func serializeSint(value int64, writer io.Writer) error {
 		} else {
 			nibble = byte(v) // Just use the magnitude for positive values
 		}
-		return utils.WriteByte(writer, types.CreateHeader(types.SNibble, nibble))
+		return append(dst, types.CreateHeader(types.SNibble, nibble))
 
 	case v <= 0x7f:
 		length = 1
@@ -57,15 +58,12 @@ func serializeSint(value int64, writer io.Writer) error {
 	}
 
 	// Set the header for the type
-	if err := utils.WriteByte(writer, types.CreateHeader(types.SInt, length)); err != nil {
-		return err
-	}
+	dst = append(dst, types.CreateHeader(types.SInt, length))
 
 	// Write the data bytes
-	return writeValueBytes(writer, v, length, negative)
+	return appendValueBytes(dst, v, length, negative)
 }
 
-
 // deserializeSint deserializes a signed integer with a pre-read header byte
 func deserializeSint(r io.Reader, header byte) (int64, error) {
 	headerType := types.TypeFromHeader(header)
@@ -87,7 +85,7 @@ func deserializeSint(r io.Reader, header byte) (int64, error) {
 	}
 
 	if headerType != types.SInt {
-		return 0, fmt.Errorf("expected SInt type, got %v", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, int64Type)
 	}
 
 	// Read the data bytes
@@ -117,20 +115,15 @@ func deserializeSint(r io.Reader, header byte) (int64, error) {
 	return value, nil
 }
 
-// Helper function to write value bytes in reverse order (big-endian)
+// Helper function to append value bytes in reverse order (big-endian)
 // Sets the high bit of the first byte if negative is true
-func writeValueBytes(writer io.Writer, value uint64, length uint8, negative bool) error {
-	for i := uint8(length - 1); ; i-- {
-		var byteValue = byte(value >> (i * 8))
-		if i == uint8(length-1) && negative {
+func appendValueBytes(dst []byte, value uint64, length uint8, negative bool) []byte {
+	for i := length; i > 0; i-- {
+		var byteValue = byte(value >> ((i - 1) * 8))
+		if i == length && negative {
 			byteValue = byteValue | 0x80
 		}
-		if err := utils.WriteByte(writer, byteValue); err != nil {
-			return err
-		}
-		if i == 0 {
-			break
-		}
+		dst = append(dst, byteValue)
 	}
-	return nil
+	return dst
 }
@@ -0,0 +1,177 @@
+package serialize
+
+import (
+	"bytes"
+	"ebe/types"
+	"ebe/utils"
+	"fmt"
+	"io"
+	"math"
+)
+
+// SkipValue reads past one complete encoded value without decoding it
+// Containers are walked recursively, so the reader is left at the start of the next value
+func SkipValue(r io.Reader) error {
+	header, err := utils.ReadByte(r)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	return skipValueWithHeader(r, header)
+}
+
+// SkipValueBytes returns the number of bytes taken by the encoded value at the start of data
+// Decoders can use it to step over values they don't understand and tools to index a stream of values
+func SkipValueBytes(data []byte) (int, error) {
+	r := bytes.NewReader(data)
+	if err := SkipValue(r); err != nil {
+		return 0, err
+	}
+	return len(data) - r.Len(), nil
+}
+
+// skipValueWithHeader reads past the remainder of a value whose header byte has already been read
+func skipValueWithHeader(r io.Reader, header byte) error {
+	headerType := types.TypeFromHeader(header)
+	headerValue := types.ValueFromHeader(header)
+
+	if isNestedHeader(header) {
+		if err := enterNested(r); err != nil {
+			return err
+		}
+		defer leaveNested(r)
+	}
+
+	switch headerType {
+
+	case types.UNibble, types.SNibble, types.Boolean, types.Null:
+		// The whole value is stored in the header
+		return nil
+
+	case types.UInt, types.SInt:
+		// The header value is the number of data bytes
+		return skipBytes(r, uint64(headerValue))
+
+	case types.Float:
+		// Only some float forms have data bytes
+		return skipBytes(r, uint64(types.FloatDataSize(headerValue)))
+
+	case types.Complex:
+		// The header value is the width of each of the two parts
+		return skipBytes(r, 2*uint64(headerValue))
+
+	case types.Extended:
+		switch headerValue {
+		case types.ExtendedTime:
+			return skipValues(r, 2)
+		case types.ExtendedTimeOffset:
+			return skipValues(r, 3)
+		case types.ExtendedDuration:
+			return SkipValue(r)
+		case types.ExtendedTyped:
+			return skipValues(r, 2)
+		default:
+			return fmt.Errorf("cannot skip unsupported extended kind: %d", headerValue)
+		}
+
+	case types.String, types.Buffer:
+		// Definitions are read rather than skipped, since later references need them
+		if headerType == types.String && headerValue == types.StringDefine {
+			_, err := deserializeString(r, header)
+			return err
+		}
+		if headerType == types.String && headerValue == types.StringReference {
+			_, err := readStringPosition(r)
+			return err
+		}
+		length := uint64(headerValue)
+		if length&0x08 != 0 {
+			actualLength, err := deserializeUintWithHeader(r)
+			if err != nil {
+				return fmt.Errorf("failed to read %s length: %w", types.TypeName(headerType), err)
+			}
+			length = actualLength
+		}
+		if err := checkPayload(r, length); err != nil {
+			return err
+		}
+		return skipBytes(r, length)
+
+	case types.Json:
+		length, err := deserializeUintWithHeader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read JSON length: %w", err)
+		}
+		if err := checkPayload(r, length); err != nil {
+			return err
+		}
+		return skipBytes(r, length)
+
+	case types.Array:
+		length, _, packing, err := readArrayHeader(r, header, nil)
+		if err != nil {
+			return err
+		}
+		if packing.packed {
+			return skipPacked(r, length, packing)
+		}
+		return skipValues(r, length)
+
+	case types.Map:
+		entryCount, err := readMapHeader(r, header, nil)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < entryCount; i++ {
+			if err := skipValues(r, 2); err != nil {
+				return fmt.Errorf("failed to skip map entry %d: %w", i, err)
+			}
+		}
+		return nil
+
+	case types.Struct:
+		fieldCount, tagged, err := readStructHeader(r, header, nil)
+		if err != nil {
+			return err
+		}
+		if !tagged {
+			return skipValues(r, fieldCount)
+		}
+		for i := uint64(0); i < fieldCount; i++ {
+			if _, err := deserializeUintWithHeader(r); err != nil {
+				return fmt.Errorf("failed to read struct field id: %w", err)
+			}
+			if err := SkipValue(r); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("cannot skip unsupported type: %s", types.TypeName(headerType))
+	}
+}
+
+// skipValues skips count consecutive encoded values
+func skipValues(r io.Reader, count uint64) error {
+	for i := uint64(0); i < count; i++ {
+		if err := SkipValue(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipBytes discards exactly n bytes from the reader
+func skipBytes(r io.Reader, n uint64) error {
+	if n > math.MaxInt64 {
+		return fmt.Errorf("cannot skip %d bytes: %w", n, io.ErrUnexpectedEOF)
+	}
+	skipped, err := io.CopyN(io.Discard, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("failed to skip %d bytes (skipped %d): %w", n, skipped, err)
+	}
+	return nil
+}
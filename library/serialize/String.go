@@ -2,30 +2,26 @@ package serialize
 
 import (
 	"ebe/types"
-	"ebe/utils"
 	"fmt"
 	"io"
 )
 
-// serializeString serializes a string value to the writer
-func serializeString(value string, w io.Writer) error {
+// appendString appends the serialized string to dst
+func appendString(dst []byte, value string) []byte {
 
 	// Write the string length header
 	var length = len(value)
 
 	// Strings under a certain length can use the shorter format
 	if length <= 0x07 {
-		utils.WriteByte(w, types.CreateHeader(types.String, byte(length)))
+		dst = append(dst, types.CreateHeader(types.String, byte(length)))
 	} else {
-		utils.WriteByte(w, types.CreateHeader(types.String, 0x08))
-		if err := serializeUint(uint64(length), w); err != nil {
-			return err
-		}
+		dst = append(dst, types.CreateHeader(types.String, 0x08))
+		dst = appendUint(dst, uint64(length))
 	}
 
 	// Write the raw string data
-	_, err := w.Write([]byte(value))
-	return err
+	return append(dst, value...)
 }
 
 // deserializeString deserializes a string with a pre-read header byte
@@ -34,7 +30,12 @@ func deserializeString(r io.Reader, header byte) (string, error) {
 	headerValue := types.ValueFromHeader(header)
 
 	if headerType != types.String {
-		return "", fmt.Errorf("expected String type, got %v", types.TypeName(headerType))
+		return "", newTypeMismatch(r, header, stringType)
+	}
+
+	// Interned strings are looked up in the table of strings defined earlier
+	if headerValue == types.StringReference {
+		return readStringReference(r)
 	}
 
 	length := uint64(headerValue)
@@ -49,6 +50,9 @@ func deserializeString(r io.Reader, header byte) (string, error) {
 	}
 
 	// Read the actual string data
+	if err := checkPayload(r, length); err != nil {
+		return "", err
+	}
 	data := make([]byte, length)
 	n, err := io.ReadFull(r, data)
 	if err != nil {
@@ -58,5 +62,11 @@ func deserializeString(r io.Reader, header byte) (string, error) {
 		return "", fmt.Errorf("expected to read %d bytes, got %d", length, n)
 	}
 
-	return string(data), nil
+	value := string(data)
+	if headerValue == types.StringDefine {
+		if err := defineString(r, value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
 }
@@ -0,0 +1,199 @@
+package serialize
+
+import (
+	"ebe/types"
+	"ebe/utils"
+	"fmt"
+	"io"
+)
+
+// StringTableScope selects whether strings are interned, so that a repeated string is written once and
+// referred to by its position in a table afterwards, and how long the table lasts
+// Decoders rebuild the table from the definitions as they read them, so any decoder reads values with
+// a table per value; values that share one table across a stream need a Decoder with the same scope.
+type StringTableScope int
+
+const (
+	StringTableNone     StringTableScope = iota // Strings are written in full every time
+	StringTablePerValue                         // Each top-level value has its own table, and only strings it repeats are defined
+	StringTableStream                           // Every value written by an Encoder adds to the same table
+)
+
+// The table holds at most this many strings taking at most this many bytes altogether
+// Encoders write further strings in full, and decoders reject definitions beyond the limits
+const (
+	maxStringTableEntries = 1 << 16
+	maxStringTableBytes   = 1 << 24
+)
+
+// stringTable is the table of strings defined so far by an encoder
+type stringTable struct {
+	stream    bool
+	positions map[string]int // Position of each defined string
+	strings   []string       // Defined strings in order, so that the definitions of a failed value can be undone
+	bytes     int
+
+	// Per-value tables only define strings that the value repeats, which are counted before it is written
+	counting bool
+	counts   map[string]int
+}
+
+// newStringTable returns an empty table that lasts for one value or for a whole stream
+func newStringTable(stream bool) *stringTable {
+	return &stringTable{stream: stream, positions: make(map[string]int)}
+}
+
+// truncate removes the strings defined after the first n
+func (t *stringTable) truncate(n int) {
+	for _, value := range t.strings[n:] {
+		delete(t.positions, value)
+		t.bytes -= len(value)
+	}
+	t.strings = t.strings[:n]
+}
+
+// appendString appends value to dst as a reference to the table, a definition or in full, whichever is smallest
+// over all the occurrences of the string that are expected
+func (t *stringTable) appendString(dst []byte, value string) []byte {
+	if t.counting {
+		t.counts[value]++
+		return appendString(dst, value)
+	}
+
+	full := stringSize(value)
+	if position, defined := t.positions[value]; defined {
+		if referenceSize(position) < full {
+			return appendStringReference(dst, position)
+		}
+		return appendString(dst, value)
+	}
+
+	// A definition takes a byte more than a short string written in full, which later references have to make up for
+	position := len(t.strings)
+	saving := full - referenceSize(position)
+	if saving <= 0 || position >= maxStringTableEntries || t.bytes+len(value) > maxStringTableBytes {
+		return appendString(dst, value)
+	}
+	if !t.stream && (t.counts[value]-1)*saving <= definitionSize(value)-full {
+		return appendString(dst, value)
+	}
+
+	t.positions[value] = position
+	t.strings = append(t.strings, value)
+	t.bytes += len(value)
+	return appendStringDefinition(dst, value)
+}
+
+// stringSize returns the number of bytes appendString writes for value
+func stringSize(value string) int {
+	if len(value) <= 0x07 {
+		return 1 + len(value)
+	}
+	return definitionSize(value)
+}
+
+// definitionSize returns the number of bytes appendStringDefinition writes for value
+func definitionSize(value string) int {
+	return 1 + uintSize(uint64(len(value))) + len(value)
+}
+
+// referenceSize returns the number of bytes appendStringReference writes for position
+func referenceSize(position int) int {
+	return 1 + uintSize(uint64(position))
+}
+
+// appendStringDefinition appends a string that the decoder adds to its table
+func appendStringDefinition(dst []byte, value string) []byte {
+	dst = append(dst, types.CreateHeader(types.String, types.StringDefine))
+	dst = appendUint(dst, uint64(len(value)))
+	return append(dst, value...)
+}
+
+// appendStringReference appends a reference to the string at position in the table
+func appendStringReference(dst []byte, position int) []byte {
+	dst = append(dst, types.CreateHeader(types.String, types.StringReference))
+	return appendUint(dst, uint64(position))
+}
+
+// appendInterned appends the single value encoded in data to dst rewritten as rw selects, with its strings
+// interned through the string table of rw
+// Per-value tables start empty, and the value is read twice to count its strings first
+func appendInterned(dst []byte, data []byte, rw rewriting) ([]byte, error) {
+	table := rw.strings
+	if !table.stream {
+		table.truncate(0)
+		table.counting, table.counts = true, make(map[string]int)
+		_, err := appendRewritten(nil, data, rewriting{strings: table})
+		table.counting = false
+		if err != nil {
+			return dst, err
+		}
+	}
+
+	// Definitions are undone if the value cannot be written, so that the table matches what decoders have read
+	defined := len(table.strings)
+	out, err := appendRewritten(dst, data, rw)
+	if err != nil {
+		table.truncate(defined)
+	}
+	return out, err
+}
+
+// MarshalInterned returns the encoding of value with every string it repeats written once and referred to afterwards
+// Repetitive values, such as arrays of maps with the same keys, take far fewer bytes. Any decoder reads the result.
+func MarshalInterned(value interface{}) ([]byte, error) {
+	data, err := appendValue(nil, value)
+	if err != nil {
+		return nil, err
+	}
+	return appendInterned(nil, data, rewriting{strings: newStringTable(false)})
+}
+
+// defineString adds a string that has been read from a definition to the decoder's table
+// Definitions read without a decode state have no later references to resolve and are not kept
+func defineString(r io.Reader, value string) error {
+	d, ok := r.(*decodeState)
+	if !ok {
+		return nil
+	}
+	if len(d.strings) >= maxStringTableEntries || d.stringBytes+len(value) > maxStringTableBytes {
+		return fmt.Errorf("string definition at offset %d exceeds the string table limits", d.offset)
+	}
+	d.strings = append(d.strings, value)
+	d.stringBytes += len(value)
+	return nil
+}
+
+// readStringReference reads the position of a string reference and returns the string from the decoder's table
+func readStringReference(r io.Reader) (string, error) {
+	start := headerOffset(r)
+	position, err := readStringPosition(r)
+	if err != nil {
+		return "", err
+	}
+	d, ok := r.(*decodeState)
+	if !ok || position >= uint64(len(d.strings)) {
+		var count int
+		if ok {
+			count = len(d.strings)
+		}
+		return "", &StringReferenceError{Position: position, Defined: count, Offset: start}
+	}
+	return d.strings[position], nil
+}
+
+// readStringPosition reads the position of a string reference, which appendUint writes as an SNibble when it is 0
+func readStringPosition(r io.Reader) (uint64, error) {
+	header, err := utils.ReadByte(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read string reference: %w", err)
+	}
+	if header == types.CreateHeader(types.SNibble, 0) {
+		return 0, nil
+	}
+	position, err := deserializeUint(r, header)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read string reference: %w", err)
+	}
+	return position, nil
+}
@@ -2,69 +2,111 @@ package serialize
 
 import (
 	"ebe/types"
-	"ebe/utils"
 	"fmt"
 	"io"
 	"reflect"
 )
 
-// SerializeStruct serializes a struct by writing a struct header followed by each exported field
+// appendStruct appends a struct to dst by writing a struct header followed by each exported field
 // Format: [Struct Header] [Optional Field Count] [Field Values...]
-// Unexported fields are skipped
-func serializeStruct(value interface{}, w io.Writer) error {
+// Unexported fields and fields tagged `ebe:"-"` are skipped, and zero values of
+// fields tagged omitempty are written as a single Null marker
+func appendStruct(dst []byte, value interface{}) ([]byte, error) {
 	rv := reflect.ValueOf(value)
 
 	// Ensure we have a struct
 	if rv.Kind() != reflect.Struct {
-		return fmt.Errorf("expected struct, got %v", rv.Kind())
+		return dst, fmt.Errorf("expected struct, got %v", rv.Kind())
 	}
 
 	// Use cached struct information for performance
 	structInfo, err := typeCache.GetStructInfo(rv.Type())
 	if err != nil {
-		return fmt.Errorf("failed to get struct info: %w", err)
+		return dst, fmt.Errorf("failed to get struct info: %w", err)
 	}
 
 	// Special case: empty structs serialize to 0 bytes (no header)
 	if structInfo.Empty {
-		return nil
+		return dst, nil
+	}
+
+	// Structs with field IDs use the tagged encoding
+	if structInfo.Tagged {
+		return appendTaggedStruct(dst, rv, structInfo)
+	}
+
+	// Write struct header with field count optimization
+	dst = appendStructHeader(dst, len(structInfo.Fields))
+
+	// Serialize each field in order using cached field information
+	for _, fieldInfo := range structInfo.Fields {
+
+		// Get the field value
+		fieldValue := rv.FieldByIndex(fieldInfo.Index)
+
+		// Zero values of optional fields are replaced by the Null marker
+		if fieldInfo.OmitEmpty && fieldValue.IsZero() {
+			dst = appendNull(dst)
+			continue
+		}
+
+		// Recursively serialize the field value
+		if dst, err = appendField(dst, fieldValue, fieldInfo); err != nil {
+			return dst, fmt.Errorf("error serializing field %s: %w", fieldInfo.Name, err)
+		}
 	}
 
-	// Count exported fields using cached information
+	return dst, nil
+}
+
+// appendTaggedStruct appends a struct using the tagged encoding for schema evolution
+// Format: [Struct Header (nibble 9)] [Field Count] [Field ID, Field Value]...
+// Each field is prefixed with its stable ID, and omitempty fields with zero values are left out entirely
+func appendTaggedStruct(dst []byte, rv reflect.Value, structInfo *StructInfo) ([]byte, error) {
+
+	// Count the fields that will be present so the header can be written first
 	fieldCount := 0
 	for _, fieldInfo := range structInfo.Fields {
-		if fieldInfo.Exported {
+		if !fieldInfo.OmitEmpty || !rv.FieldByIndex(fieldInfo.Index).IsZero() {
 			fieldCount++
 		}
 	}
 
-	// Write struct header with field count optimization
-	if err := writeStructHeader(fieldCount, w); err != nil {
-		return err
-	}
+	dst = appendTaggedStructHeader(dst, fieldCount)
 
-	// Serialize each exported field in order using cached field information
+	var err error
 	for _, fieldInfo := range structInfo.Fields {
-		if !fieldInfo.Exported {
+		fieldValue := rv.FieldByIndex(fieldInfo.Index)
+		if fieldInfo.OmitEmpty && fieldValue.IsZero() {
 			continue
 		}
 
-		// Get the field value
-		fieldValue := rv.Field(fieldInfo.Index)
-
-		// Recursively call Serialize to serialize the field value
-		if err := Serialize(fieldValue.Interface(), w); err != nil {
-			return fmt.Errorf("error serializing field %s: %w", fieldInfo.Name, err)
+		dst = appendUint(dst, fieldInfo.ID)
+		if dst, err = appendField(dst, fieldValue, fieldInfo); err != nil {
+			return dst, fmt.Errorf("error serializing field %s: %w", fieldInfo.Name, err)
 		}
 	}
 
-	return nil
+	return dst, nil
+}
+
+// appendField appends the value of a struct field, with the encoding chosen by its tag
+func appendField(dst []byte, fieldValue reflect.Value, fieldInfo StructFieldInfo) ([]byte, error) {
+	if fieldInfo.Delta != DeltaNone {
+		return appendDeltaField(dst, fieldValue, fieldInfo.Delta)
+	}
+	return appendDeclaredValue(dst, fieldValue.Interface(), fieldInfo.Type)
 }
 
 // deserializeStruct deserializes data from a stream into a struct with a pre-read struct header
 func deserializeStruct(r io.Reader, header byte, structValue reflect.Value) error {
+	if structValue.Kind() != reflect.Struct {
+		return newTypeMismatch(r, header, structValue.Type())
+	}
+
 	// Read and parse struct header
-	expectedFieldCount, err := readStructHeader(r, header)
+	start := headerOffset(r)
+	expectedFieldCount, tagged, err := readStructHeader(r, header, structValue.Type())
 	if err != nil {
 		return err
 	}
@@ -75,27 +117,20 @@ func deserializeStruct(r io.Reader, header byte, structValue reflect.Value) erro
 		return fmt.Errorf("failed to get struct info: %w", err)
 	}
 
-	// Count actual exported fields using cached information
-	actualFieldCount := 0
-	for _, fieldInfo := range structInfo.Fields {
-		if fieldInfo.Exported {
-			actualFieldCount++
-		}
+	if tagged {
+		return deserializeTaggedStruct(r, expectedFieldCount, structValue, structInfo)
 	}
 
 	// Validate field count matches
-	if uint64(actualFieldCount) != expectedFieldCount {
-		return fmt.Errorf("struct field count mismatch: expected %d, struct has %d exported fields", expectedFieldCount, actualFieldCount)
+	if uint64(len(structInfo.Fields)) != expectedFieldCount {
+		return typeMismatchAt(start, header, structValue.Type())
 	}
 
-	// Deserialize each exported field in order using cached field information
+	// Deserialize each field in order using cached field information
 	for _, fieldInfo := range structInfo.Fields {
-		if !fieldInfo.Exported {
-			continue
-		}
 
 		// Get the field value
-		field := structValue.Field(fieldInfo.Index)
+		field := structValue.FieldByIndex(fieldInfo.Index)
 
 		// Create a pointer to the field for deserialization
 		fieldPtr := field.Addr().Interface()
@@ -103,43 +138,84 @@ func deserializeStruct(r io.Reader, header byte, structValue reflect.Value) erro
 		// Each field reads its own header
 		err = Deserialize(r, fieldPtr)
 		if err != nil {
-			return fmt.Errorf("failed to deserialize field '%s': %w", fieldInfo.Name, err)
+			return withPath(r, fmt.Errorf("failed to deserialize field '%s': %w", fieldInfo.Name, err), fieldInfo.Name)
 		}
 	}
 
 	return nil
 }
 
-// writeStructHeader writes the struct header with field count optimization
-func writeStructHeader(fieldCount int, w io.Writer) error {
-	if fieldCount <= 7 {
-		// Small structs: store count directly in header nibble
-		header := types.CreateHeader(types.Struct, byte(fieldCount))
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write struct header: %w", err)
+// deserializeTaggedStruct reads the ID-prefixed fields of a tagged struct
+// Fields with unknown IDs are skipped, and fields missing from the data are reset to their zero values
+func deserializeTaggedStruct(r io.Reader, fieldCount uint64, structValue reflect.Value, structInfo *StructInfo) error {
+	if !structInfo.Tagged {
+		return fmt.Errorf("cannot deserialize tagged struct into %v: fields have no ebe id tags", structValue.Type())
+	}
+
+	seen := make([]bool, len(structInfo.Fields))
+	for i := uint64(0); i < fieldCount; i++ {
+		id, err := deserializeUintWithHeader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read struct field id: %w", err)
 		}
-	} else {
-		// Large structs: use overflow indicator (8) in header, then UInt for actual count
-		header := types.CreateHeader(types.Struct, 8)
-		if err := utils.WriteByte(w, header); err != nil {
-			return fmt.Errorf("failed to write struct header: %w", err)
+
+		// Fields added by a newer producer are ignored
+		index, found := structInfo.ByID[id]
+		if !found {
+			if err := SkipValue(r); err != nil {
+				return fmt.Errorf("failed to skip unknown struct field id %d: %w", id, err)
+			}
+			continue
 		}
-		
-		// Write actual count as standard EBE UInt
-		if err := serializeUint(uint64(fieldCount), w); err != nil {
-			return fmt.Errorf("failed to write struct field count: %w", err)
+
+		fieldInfo := structInfo.Fields[index]
+		fieldPtr := structValue.FieldByIndex(fieldInfo.Index).Addr().Interface()
+		if err := Deserialize(r, fieldPtr); err != nil {
+			return withPath(r, fmt.Errorf("failed to deserialize field '%s': %w", fieldInfo.Name, err), fieldInfo.Name)
 		}
+		seen[index] = true
 	}
+
+	// Fields unknown to an older producer keep their zero values
+	for index, fieldInfo := range structInfo.Fields {
+		if !seen[index] {
+			field := structValue.FieldByIndex(fieldInfo.Index)
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
 	return nil
 }
 
-// readStructHeader reads and parses the struct header, returning field count
-func readStructHeader(r io.Reader, header byte) (uint64, error) {
+// appendStructHeader appends the struct header with field count optimization to dst
+func appendStructHeader(dst []byte, fieldCount int) []byte {
+	if fieldCount <= 7 {
+		// Small structs: store count directly in header nibble
+		return append(dst, types.CreateHeader(types.Struct, byte(fieldCount)))
+	}
+
+	// Large structs: use overflow indicator (8) in header, then UInt for actual count
+	dst = append(dst, types.CreateHeader(types.Struct, 8))
+
+	// Write actual count as standard EBE UInt
+	return appendUint(dst, uint64(fieldCount))
+}
+
+// appendTaggedStructHeader appends the header of a tagged struct to dst
+// The tagged form is marked by nibble 9 and always carries its field count as a following UInt
+func appendTaggedStructHeader(dst []byte, fieldCount int) []byte {
+	dst = append(dst, types.CreateHeader(types.Struct, 9))
+	return appendUint(dst, uint64(fieldCount))
+}
+
+// readStructHeader reads and parses the struct header, returning field count and whether the struct is tagged
+// Headers of other types are reported as a mismatch with goType, the type being decoded into
+func readStructHeader(r io.Reader, header byte, goType reflect.Type) (uint64, bool, error) {
 	headerType := types.TypeFromHeader(header)
 	headerValue := types.ValueFromHeader(header)
 
 	if headerType != types.Struct {
-		return 0, fmt.Errorf("expected Struct type, got %v", types.TypeName(headerType))
+		return 0, false, newTypeMismatch(r, header, goType)
 	}
 
 	// Determine field count
@@ -148,15 +224,21 @@ func readStructHeader(r io.Reader, header byte) (uint64, error) {
 	if headerValue <= 7 {
 		// Small struct: count stored in header
 		fieldCount = uint64(headerValue)
-	} else if headerValue == 8 {
-		// Large struct: read count as UInt
+	} else if headerValue == 8 || headerValue == 9 {
+		// Large or tagged struct: read count as UInt
 		fieldCount, err = deserializeUintWithHeader(r)
 		if err != nil {
-			return 0, fmt.Errorf("failed to read struct field count: %w", err)
+			return 0, false, fmt.Errorf("failed to read struct field count: %w", err)
 		}
 	} else {
-		return 0, fmt.Errorf("invalid struct header value: %d", headerValue)
+		return 0, false, fmt.Errorf("invalid struct header value: %d", headerValue)
+	}
+	if err := checkLength(r, fieldCount); err != nil {
+		return 0, false, err
+	}
+	if err := checkCount(r, fieldCount); err != nil {
+		return 0, false, err
 	}
 
-	return fieldCount, nil
+	return fieldCount, headerValue == 9, nil
 }
@@ -0,0 +1,104 @@
+package serialize
+
+import (
+	"ebe/types"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// appendTime appends a time.Time to dst as an Extended value
+// Format: [Extended Header: Time or TimeOffset] [SInt seconds] [UInt nanoseconds] [SInt zone offset, TimeOffset only]
+// The instant is preserved exactly; a location other than UTC is kept as its offset from UTC
+func appendTime(dst []byte, value time.Time) []byte {
+	if value.Location() == time.UTC {
+		dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedTime))
+		dst = appendSint(dst, value.Unix())
+		return appendUint(dst, uint64(value.Nanosecond()))
+	}
+
+	_, offset := value.Zone()
+	dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedTimeOffset))
+	dst = appendSint(dst, value.Unix())
+	dst = appendUint(dst, uint64(value.Nanosecond()))
+	return appendSint(dst, int64(offset))
+}
+
+// appendDuration appends a time.Duration to dst as an Extended value holding the SInt nanosecond count
+func appendDuration(dst []byte, value time.Duration) []byte {
+	dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedDuration))
+	return appendSint(dst, int64(value))
+}
+
+// deserializeExtended decodes an Extended value with a pre-read header into the output value
+func deserializeExtended(r io.Reader, header byte, outValue reflect.Value) error {
+	start := headerOffset(r)
+	value, err := readExtended(r, header, outValue.Type())
+	if err != nil {
+		return err
+	}
+	return setDecodedValue(r, start, header, outValue, value)
+}
+
+// readExtended reads the remainder of an Extended value and returns it as its Go type
+// Headers of other types are reported as a mismatch with goType, the type being decoded into
+func readExtended(r io.Reader, header byte, goType reflect.Type) (interface{}, error) {
+	headerType := types.TypeFromHeader(header)
+	kind := types.ValueFromHeader(header)
+
+	if headerType != types.Extended {
+		return nil, newTypeMismatch(r, header, goType)
+	}
+
+	switch kind {
+	case types.ExtendedTime, types.ExtendedTimeOffset:
+		return deserializeTime(r, kind)
+	case types.ExtendedDuration:
+		nanoseconds, err := deserializeInt64(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read duration: %w", err)
+		}
+		return time.Duration(nanoseconds), nil
+	case types.ExtendedTyped:
+		return readTyped(r)
+	default:
+		return nil, fmt.Errorf("unsupported extended kind: %d", kind)
+	}
+}
+
+// deserializeTime reads the seconds, nanoseconds and optional zone offset of a time.Time
+func deserializeTime(r io.Reader, kind byte) (time.Time, error) {
+	seconds, err := deserializeInt64(r)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read time seconds: %w", err)
+	}
+
+	nanoseconds, err := deserializeUint64(r)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read time nanoseconds: %w", err)
+	}
+	if nanoseconds >= uint64(time.Second) {
+		return time.Time{}, fmt.Errorf("invalid time nanoseconds: %d", nanoseconds)
+	}
+
+	value := time.Unix(seconds, int64(nanoseconds))
+	if kind == types.ExtendedTime {
+		return value.UTC(), nil
+	}
+
+	offset, err := deserializeInt64(r)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read time zone offset: %w", err)
+	}
+	if offset <= -86400 || offset >= 86400 {
+		return time.Time{}, fmt.Errorf("invalid time zone offset: %d", offset)
+	}
+
+	return value.In(time.FixedZone("", int(offset))), nil
+}
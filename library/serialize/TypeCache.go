@@ -4,6 +4,8 @@ import (
 	"ebe/types"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -13,6 +15,7 @@ var typeCache = &TypeCache{
 	structFields:     &sync.Map{},
 	elementTypes:     &sync.Map{},
 	outputValidation: &sync.Map{},
+	marshalers:       &sync.Map{},
 }
 
 // TypeCache holds cached reflection metadata to avoid repeated expensive operations
@@ -28,20 +31,29 @@ type TypeCache struct {
 	
 	// outputValidation caches validation results for deserialization output parameters
 	outputValidation *sync.Map
+
+	// marshalers caches which custom encoding interfaces a type implements
+	marshalers *sync.Map
 }
 
-// StructFieldInfo contains cached information about a struct field
+// StructFieldInfo contains cached information about a serialized struct field
 type StructFieldInfo struct {
-	Name     string
-	Type     reflect.Type
-	Index    int
-	Exported bool
+	Name      string       // Field name, or the name given in the ebe tag
+	Type      reflect.Type
+	Index     []int        // Index sequence for reflect.Value.FieldByIndex (longer than one for inlined fields)
+	OmitEmpty bool         // Zero values are written as a Null marker (or left out of tagged structs)
+	ID        uint64       // Stable field ID from an `ebe:"id=N"` tag, used by tagged structs
+	Delta     DeltaMode    // Integer or time elements are delta encoded, from a delta or deltaofdelta tag option
 }
 
 // StructInfo contains cached information about a struct type
+// Fields lists the serialized fields in wire order: exported fields that are not skipped by
+// an `ebe:"-"` tag, with the fields of inlined structs expanded in place
 type StructInfo struct {
 	Fields []StructFieldInfo
-	Empty  bool // True if struct has no exported fields
+	Empty  bool           // True if struct has no serialized fields
+	Tagged bool           // True if every field has an ID and the struct uses the tagged encoding
+	ByID   map[uint64]int // Index into Fields for each field ID of a tagged struct
 }
 
 // OutputValidationInfo contains cached validation results for output parameters
@@ -52,6 +64,20 @@ type OutputValidationInfo struct {
 	Error          error
 }
 
+// MarshalerInfo records which custom encoding interfaces a type implements
+// When ViaPointer is set the interfaces are implemented by a pointer to the type rather than the type itself
+type MarshalerInfo struct {
+	Marshaler       bool // Implements Marshaler
+	BinaryMarshaler bool // Implements encoding.BinaryMarshaler
+	TextMarshaler   bool // Implements encoding.TextMarshaler
+	ViaPointer      bool // Only a pointer to the type implements the interfaces above
+}
+
+// Custom reports whether the type has any custom encoding
+func (info *MarshalerInfo) Custom() bool {
+	return info.Marshaler || info.BinaryMarshaler || info.TextMarshaler
+}
+
 // GetEBEType returns the cached EBE type for a reflect.Type, computing and caching if not found
 func (tc *TypeCache) GetEBEType(t reflect.Type) (types.Types, error) {
 	// Try to get from cache first
@@ -108,6 +134,25 @@ func (tc *TypeCache) GetElementType(t reflect.Type) (types.Types, error) {
 
 // computeEBEType computes the EBE type for a reflect.Type (internal function)
 func computeEBEType(t reflect.Type) (types.Types, error) {
+
+	// Time values have a native encoding that takes precedence over their standard library marshalers
+	if t == timeType || t == durationType {
+		return types.Extended, nil
+	}
+
+	// Standard library marshalers have a fixed wire type regardless of the Go kind
+	// A Marshaler takes precedence over them and writes any type it chooses, so arrays of them are Mixed
+	info := typeCache.GetMarshalerInfo(t)
+	if info.Marshaler {
+		return types.Mixed, nil
+	}
+	if info.BinaryMarshaler {
+		return types.Buffer, nil
+	}
+	if info.TextMarshaler {
+		return types.String, nil
+	}
+
 	switch t.Kind() {
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
 		return types.UInt, nil
@@ -115,6 +160,8 @@ func computeEBEType(t reflect.Type) (types.Types, error) {
 		return types.SInt, nil
 	case reflect.Float32, reflect.Float64:
 		return types.Float, nil
+	case reflect.Complex64, reflect.Complex128:
+		return types.Complex, nil
 	case reflect.Bool:
 		return types.Boolean, nil
 	case reflect.String:
@@ -130,6 +177,12 @@ func computeEBEType(t reflect.Type) (types.Types, error) {
 		return types.Map, nil
 	case reflect.Struct:
 		return types.Struct, nil
+	case reflect.Ptr:
+		// Non-nil pointers are written as the value they point to
+		return typeCache.GetEBEType(t.Elem())
+	case reflect.Interface:
+		// Interfaces hold values of any type, typed or not, so arrays of them have no single element type
+		return types.Mixed, nil
 	case reflect.Chan:
 		return 0, fmt.Errorf("channels not supported")
 	default:
@@ -145,64 +198,200 @@ func computeStructInfo(t reflect.Type) (*StructInfo, error) {
 	
 	info := &StructInfo{
 		Fields: make([]StructFieldInfo, 0, t.NumField()),
-		Empty:  true,
 	}
 	
-	// Analyze each field
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		exported := field.PkgPath == "" // Exported field
-		
-		if exported {
-			info.Empty = false
+	tagged := 0
+	if err := appendStructFields(info, t, nil, &tagged); err != nil {
+		return nil, err
+	}
+	info.Empty = len(info.Fields) == 0
+
+	// Field IDs opt the struct into the tagged encoding, which needs an ID on every field
+	if tagged > 0 {
+		if tagged != len(info.Fields) {
+			return nil, fmt.Errorf("struct %v mixes fields with and without ebe id tags", t)
 		}
-		
-		fieldInfo := StructFieldInfo{
-			Name:     field.Name,
-			Type:     field.Type,
-			Index:    i,
-			Exported: exported,
+		info.Tagged = true
+		info.ByID = make(map[uint64]int, len(info.Fields))
+		for i, fieldInfo := range info.Fields {
+			if other, found := info.ByID[fieldInfo.ID]; found {
+				return nil, fmt.Errorf("struct %v has duplicate ebe id %d on fields %s and %s", t, fieldInfo.ID, info.Fields[other].Name, fieldInfo.Name)
+			}
+			info.ByID[fieldInfo.ID] = i
 		}
-		
-		info.Fields = append(info.Fields, fieldInfo)
 	}
 	
 	return info, nil
 }
 
+// appendStructFields adds the serialized fields of t to info, expanding inlined structs recursively
+// The parent index is the index sequence of t within the outermost struct, and tagged counts the fields with IDs
+func appendStructFields(info *StructInfo, t reflect.Type, parent []int, tagged *int) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Unexported fields are never serialized, whatever their tags say
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			return err
+		}
+		if tag.Skip {
+			continue
+		}
+
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		// Inlined structs contribute their own fields in place of a nested struct value
+		if tag.Inline {
+			if field.Type.Kind() != reflect.Struct {
+				return fmt.Errorf("ebe tag option inline on field %s requires a struct, got %v", field.Name, field.Type)
+			}
+			if err := appendStructFields(info, field.Type, index, tagged); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Name
+		if tag.Name != "" {
+			name = tag.Name
+		}
+
+		if tag.HasID {
+			*tagged++
+		}
+
+		info.Fields = append(info.Fields, StructFieldInfo{
+			Name:      name,
+			Type:      field.Type,
+			Index:     index,
+			OmitEmpty: tag.OmitEmpty && !encodesToNothing(field.Type),
+			ID:        tag.ID,
+			Delta:     tag.Delta,
+		})
+	}
+
+	return nil
+}
+
+// fieldTag holds the options parsed from an `ebe:"name,opt,..."` struct tag
+type fieldTag struct {
+	Name      string
+	Skip      bool
+	OmitEmpty bool
+	Inline    bool
+	HasID     bool
+	ID        uint64
+	Delta     DeltaMode
+}
+
+// parseFieldTag parses the ebe struct tag of a field
+// Supported forms: `ebe:"-"` to skip the field, and an optional name followed by the options omitempty,
+// inline, id=N, delta and deltaofdelta, e.g. `ebe:"user,omitempty"`, `ebe:",inline"` or `ebe:",id=3"`
+func parseFieldTag(field reflect.StructField) (fieldTag, error) {
+	var tag fieldTag
+
+	value, ok := field.Tag.Lookup("ebe")
+	if !ok {
+		return tag, nil
+	}
+	if value == "-" {
+		tag.Skip = true
+		return tag, nil
+	}
+
+	parts := strings.Split(value, ",")
+	tag.Name = parts[0]
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			tag.OmitEmpty = true
+		case "inline":
+			tag.Inline = true
+		case "delta", "deltaofdelta":
+			if _, ok := deltaElementType(field.Type); !ok {
+				return tag, fmt.Errorf("ebe tag option %s on field %s requires a slice of integers or times, got %v", option, field.Name, field.Type)
+			}
+			tag.Delta = Delta
+			if option == "deltaofdelta" {
+				tag.Delta = DeltaOfDelta
+			}
+		case "":
+			// Tolerate stray commas such as `ebe:"name,"`
+		default:
+			if idValue, found := strings.CutPrefix(option, "id="); found {
+				id, err := strconv.ParseUint(idValue, 10, 64)
+				if err != nil {
+					return tag, fmt.Errorf("invalid ebe id %q on field %s: %w", idValue, field.Name, err)
+				}
+				tag.HasID = true
+				tag.ID = id
+				continue
+			}
+			return tag, fmt.Errorf("unknown ebe tag option %q on field %s", option, field.Name)
+		}
+	}
+
+	return tag, nil
+}
+
+// encodesToNothing reports whether values of t serialize to zero bytes
+// Empty structs have no header, so they cannot be replaced by a Null marker
+func encodesToNothing(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || typeCache.GetMarshalerInfo(t).Custom() {
+		return false
+	}
+	structInfo, err := typeCache.GetStructInfo(t)
+	return err == nil && structInfo.Empty
+}
+
 // computeElementType computes the EBE type for array/slice elements (internal function)
+// Elements are typed exactly as standalone values, so nested slices and arrays declare Array at every level
 func computeElementType(t reflect.Type) (types.Types, error) {
 	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
 		return 0, fmt.Errorf("expected slice or array type, got %v", t.Kind())
 	}
-	
-	elemType := t.Elem()
-	
-	// Apply original logic restrictions for array elements
-	switch elemType.Kind() {
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
-		return types.UInt, nil
-	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-		return types.SInt, nil
-	case reflect.Float32, reflect.Float64:
-		return types.Float, nil
-	case reflect.Bool:
-		return types.Boolean, nil
-	case reflect.String:
-		return types.String, nil
-	case reflect.Slice:
-		if elemType.Elem().Kind() == reflect.Uint8 {
-			return types.Buffer, nil
-		}
-		return 0, fmt.Errorf("nested slices not yet supported")
-	case reflect.Struct:
-		return types.Struct, nil
-	case reflect.Map:
-		return types.Map, nil
-	case reflect.Chan:
-		return 0, fmt.Errorf("channels not supported")
-	default:
-		return 0, fmt.Errorf("unsupported type: %v", elemType)
+
+	return typeCache.GetEBEType(t.Elem())
+}
+
+// GetMarshalerInfo returns cached custom encoding interface information for a type
+func (tc *TypeCache) GetMarshalerInfo(t reflect.Type) *MarshalerInfo {
+	// Try to get from cache first
+	if cached, found := tc.marshalers.Load(t); found {
+		return cached.(*MarshalerInfo)
+	}
+
+	// Compute marshaler info
+	info := computeMarshalerInfo(t)
+
+	// Cache the result
+	tc.marshalers.Store(t, info)
+	return info
+}
+
+// computeMarshalerInfo computes which custom encoding interfaces a type implements
+func computeMarshalerInfo(t reflect.Type) *MarshalerInfo {
+	info := implementedMarshalers(t)
+	if !info.Custom() && t.Kind() != reflect.Ptr {
+		info = implementedMarshalers(reflect.PointerTo(t))
+		info.ViaPointer = info.Custom()
+	}
+	return info
+}
+
+// implementedMarshalers checks a type against each custom encoding interface
+func implementedMarshalers(t reflect.Type) *MarshalerInfo {
+	return &MarshalerInfo{
+		Marshaler:       t.Implements(marshalerType),
+		BinaryMarshaler: t.Implements(binaryMarshalerType),
+		TextMarshaler:   t.Implements(textMarshalerType),
 	}
 }
 
@@ -259,4 +448,5 @@ func (tc *TypeCache) ClearCache() {
 	tc.structFields = &sync.Map{}
 	tc.elementTypes = &sync.Map{}
 	tc.outputValidation = &sync.Map{}
+	tc.marshalers = &sync.Map{}
 }
\ No newline at end of file
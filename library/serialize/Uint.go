@@ -8,7 +8,8 @@ import (
 	"math"
 )
 
-func serializeUint(value uint64, writer io.Writer) error {
+// appendUint appends the serialized unsigned integer to dst
+func appendUint(dst []byte, value uint64) []byte {
 
 	// Figure out what size of integer is needed for the data
 	var length uint8 = 0
@@ -19,9 +20,9 @@ func serializeUint(value uint64, writer io.Writer) error {
 	// put the value in the lsb nibble of the header
 	case value <= 0x0f:
 		if value == 0x00 {
-			return utils.WriteByte(writer, types.CreateHeader(types.SNibble, byte(value)))
+			return append(dst, types.CreateHeader(types.SNibble, byte(value)))
 		} else {
-			return utils.WriteByte(writer, types.CreateHeader(types.UNibble, byte(value)))
+			return append(dst, types.CreateHeader(types.UNibble, byte(value)))
 		}
 
 	case value <= math.MaxUint8:
@@ -50,21 +51,14 @@ func serializeUint(value uint64, writer io.Writer) error {
 	}
 
 	// Set the header for the type
-	if err := utils.WriteByte(writer, types.CreateHeader(types.UInt, length)); err != nil {
-		return err
-	}
+	dst = append(dst, types.CreateHeader(types.UInt, length))
 
 	// Write the data bytes
-	for i := uint8(length - 1); ; i-- {
-		if err := utils.WriteByte(writer, byte(value>>(i*8))); err != nil {
-			return err
-		}
-		if i == 0 {
-			break
-		}
+	for i := length; i > 0; i-- {
+		dst = append(dst, byte(value>>((i-1)*8)))
 	}
 
-	return nil
+	return dst
 }
 
 // deserializeUint deserializes an unsigned integer with a pre-read header byte
@@ -81,7 +75,7 @@ func deserializeUint(r io.Reader, header byte) (uint64, error) {
 
 	// Make sure the data is a valid integer value
 	if headerType != types.UInt {
-		return 0, fmt.Errorf("expected UInt type, got %v", types.TypeName(headerType))
+		return 0, newTypeMismatch(r, header, uint64Type)
 	}
 
 	// Read the data bytes
@@ -102,10 +96,14 @@ func deserializeUint(r io.Reader, header byte) (uint64, error) {
 }
 
 // deserializeUintWithHeader reads the header byte and delegates to deserializeUint
+// It reads the lengths, counts and ids that follow other headers, so it also accepts the SNibble 0 that appendUint writes for 0
 func deserializeUintWithHeader(r io.Reader) (uint64, error) {
 	header, err := utils.ReadByte(r)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read header: %w", err)
 	}
+	if header == types.CreateHeader(types.SNibble, 0) {
+		return 0, nil
+	}
 	return deserializeUint(r, header)
 }
@@ -0,0 +1,861 @@
+package serialize
+
+import (
+	"bytes"
+	"ebe/types"
+	"ebe/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Value is a dynamically typed EBE value that keeps the exact wire type of what it holds
+// Unlike decoding into interface{}, a Value tells UInt from SInt and Buffer from String, remembers the
+// declared element type of arrays and the field ids of tagged structs, and re-encodes to the same kinds
+// The zero Value is Null
+//
+// Accessors panic when called on a Value of the wrong kind, in the same way as reflect.Value
+type Value struct {
+	kind        types.Types
+	valid       bool
+	bits        uint64      // UInt, SInt (two's complement), Float (IEEE 754), Boolean and Duration payloads, and the id of a typed value
+	cplx        complex128  // Complex payload
+	str         string      // String payload
+	buf         []byte      // Buffer and Json payloads
+	time        time.Time   // Time payload
+	extended    byte        // Extended kind
+	elementType types.Types // Declared element type of an Array
+	items       []Value     // Array elements, Struct fields, Map values and the value of a typed value
+	keys        []Value     // Map keys, parallel to items
+	ids         []uint64    // Field ids of a tagged Struct, parallel to items
+	tagged      bool        // Struct uses the tagged encoding
+	index       *keyIndex   // Positions of Map keys, shared by copies of the Value
+}
+
+// keyIndex finds the entries of a Map Value by the encoding of their keys
+// Copies of a Value share it, so it records which keys it was built from and is rebuilt for any others
+type keyIndex struct {
+	keys      []Value
+	positions map[string]int
+}
+
+// valueType is the Value type, the element type of decoded Value collections
+var valueType = reflect.TypeOf(Value{})
+
+// TaggedField is one field of a tagged struct Value
+type TaggedField struct {
+	ID    uint64
+	Value Value
+}
+
+// NullValue returns a Null Value
+func NullValue() Value {
+	return Value{}
+}
+
+// UintValue returns a UInt Value
+func UintValue(value uint64) Value {
+	return Value{kind: types.UInt, valid: true, bits: value}
+}
+
+// IntValue returns an SInt Value
+func IntValue(value int64) Value {
+	return Value{kind: types.SInt, valid: true, bits: uint64(value)}
+}
+
+// FloatValue returns a Float Value
+func FloatValue(value float64) Value {
+	return Value{kind: types.Float, valid: true, bits: math.Float64bits(value)}
+}
+
+// ComplexValue returns a Complex Value
+func ComplexValue(value complex128) Value {
+	return Value{kind: types.Complex, valid: true, cplx: value}
+}
+
+// BoolValue returns a Boolean Value
+func BoolValue(value bool) Value {
+	v := Value{kind: types.Boolean, valid: true}
+	if value {
+		v.bits = 1
+	}
+	return v
+}
+
+// StringValue returns a String Value
+func StringValue(value string) Value {
+	return Value{kind: types.String, valid: true, str: value}
+}
+
+// BytesValue returns a Buffer Value
+func BytesValue(value []byte) Value {
+	return Value{kind: types.Buffer, valid: true, buf: value}
+}
+
+// JsonValue returns a Json Value holding the raw JSON text
+func JsonValue(value json.RawMessage) Value {
+	return Value{kind: types.Json, valid: true, buf: value}
+}
+
+// TimeValue returns an Extended Value holding a time.Time
+func TimeValue(value time.Time) Value {
+	return Value{kind: types.Extended, valid: true, extended: types.ExtendedTime, time: value}
+}
+
+// DurationValue returns an Extended Value holding a time.Duration
+func DurationValue(value time.Duration) Value {
+	return Value{kind: types.Extended, valid: true, extended: types.ExtendedDuration, bits: uint64(value)}
+}
+
+// TypedValue returns an Extended Value holding value tagged with the id of the type registered under name
+// The type does not need to be registered to build or encode the Value
+func TypedValue(name string, value Value) Value {
+	return Value{kind: types.Extended, valid: true, extended: types.ExtendedTyped, bits: typeID(name), items: []Value{value}}
+}
+
+// ArrayValue returns an Array Value with the declared element type and elements
+func ArrayValue(elementType types.Types, elements ...Value) Value {
+	return Value{kind: types.Array, valid: true, elementType: elementType, items: elements}
+}
+
+// MapValue returns an empty Map Value, entries are added with SetMapIndex
+func MapValue() Value {
+	return Value{kind: types.Map, valid: true, index: &keyIndex{}}
+}
+
+// StructValue returns a positional Struct Value with the fields in order
+func StructValue(fields ...Value) Value {
+	return Value{kind: types.Struct, valid: true, items: fields}
+}
+
+// TaggedStructValue returns a tagged Struct Value whose fields are identified by id
+func TaggedStructValue(fields ...TaggedField) Value {
+	v := Value{kind: types.Struct, valid: true, tagged: true}
+	for _, field := range fields {
+		v.ids = append(v.ids, field.ID)
+		v.items = append(v.items, field.Value)
+	}
+	return v
+}
+
+// ValueOf returns the Value for any serializable Go value
+// The Value has exactly the kinds that Serialize would write for x
+func ValueOf(x interface{}) (Value, error) {
+	data, err := Marshal(x)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var v Value
+	if err := Unmarshal(data, &v); err != nil {
+		return Value{}, err
+	}
+	return v, nil
+}
+
+// Kind returns the wire type of the value
+// Nibble encodings are reported as the integer type they belong to, UNibble as UInt and SNibble as SInt
+func (v Value) Kind() types.Types {
+	if !v.valid {
+		return types.Null
+	}
+	return v.kind
+}
+
+// IsNull reports whether v is Null
+func (v Value) IsNull() bool {
+	return !v.valid
+}
+
+// ExtendedKind returns the kind of an Extended value, such as types.ExtendedTime
+func (v Value) ExtendedKind() byte {
+	v.mustBe(types.Extended, "ExtendedKind")
+	return v.extended
+}
+
+// Uint returns the value of a UInt
+func (v Value) Uint() uint64 {
+	v.mustBe(types.UInt, "Uint")
+	return v.bits
+}
+
+// Int returns the value of an SInt
+func (v Value) Int() int64 {
+	v.mustBe(types.SInt, "Int")
+	return int64(v.bits)
+}
+
+// Float returns the value of a Float
+func (v Value) Float() float64 {
+	v.mustBe(types.Float, "Float")
+	return math.Float64frombits(v.bits)
+}
+
+// Complex returns the value of a Complex
+func (v Value) Complex() complex128 {
+	v.mustBe(types.Complex, "Complex")
+	return v.cplx
+}
+
+// Bool returns the value of a Boolean
+func (v Value) Bool() bool {
+	v.mustBe(types.Boolean, "Bool")
+	return v.bits != 0
+}
+
+// Str returns the value of a String
+func (v Value) Str() string {
+	v.mustBe(types.String, "Str")
+	return v.str
+}
+
+// Bytes returns the contents of a Buffer or the raw text of a Json value
+func (v Value) Bytes() []byte {
+	if v.Kind() != types.Json {
+		v.mustBe(types.Buffer, "Bytes")
+	}
+	return v.buf
+}
+
+// Time returns the value of an Extended time
+func (v Value) Time() time.Time {
+	v.mustBe(types.Extended, "Time")
+	if v.extended != types.ExtendedTime && v.extended != types.ExtendedTimeOffset {
+		panic(fmt.Sprintf("ebe: call of Value.Time on Extended %s Value", types.ExtendedName(v.extended)))
+	}
+	return v.time
+}
+
+// Duration returns the value of an Extended duration
+func (v Value) Duration() time.Duration {
+	v.mustBe(types.Extended, "Duration")
+	if v.extended != types.ExtendedDuration {
+		panic(fmt.Sprintf("ebe: call of Value.Duration on Extended %s Value", types.ExtendedName(v.extended)))
+	}
+	return time.Duration(v.bits)
+}
+
+// TypeID returns the registered type id of an Extended typed value
+func (v Value) TypeID() uint64 {
+	v.mustBeTyped("TypeID")
+	return v.bits
+}
+
+// TypeName returns the name the type of an Extended typed value is registered under, or "" if it is not registered
+func (v Value) TypeName() string {
+	v.mustBeTyped("TypeName")
+	if registered, found := lookupRegisteredID(v.bits); found {
+		return registered.name
+	}
+	return ""
+}
+
+// Elem returns the value held by an Extended typed value
+func (v Value) Elem() Value {
+	v.mustBeTyped("Elem")
+	return v.items[0]
+}
+
+// mustBeTyped panics if v is not an Extended typed value
+func (v Value) mustBeTyped(method string) {
+	v.mustBe(types.Extended, method)
+	if v.extended != types.ExtendedTyped {
+		panic(fmt.Sprintf("ebe: call of Value.%s on Extended %s Value", method, types.ExtendedName(v.extended)))
+	}
+}
+
+// Len returns the number of elements of an Array, entries of a Map, fields of a Struct or bytes of a String or Buffer
+func (v Value) Len() int {
+	switch v.Kind() {
+	case types.Array, types.Map, types.Struct:
+		return len(v.items)
+	case types.String:
+		return len(v.str)
+	case types.Buffer, types.Json:
+		return len(v.buf)
+	default:
+		panic(fmt.Sprintf("ebe: call of Value.Len on %s Value", types.TypeName(v.Kind())))
+	}
+}
+
+// ElementType returns the declared element type of an Array
+func (v Value) ElementType() types.Types {
+	v.mustBe(types.Array, "ElementType")
+	return v.elementType
+}
+
+// Index returns the i'th element of an Array
+func (v Value) Index(i int) Value {
+	v.mustBe(types.Array, "Index")
+	return v.items[i]
+}
+
+// SetIndex replaces the i'th element of an Array
+func (v *Value) SetIndex(i int, element Value) {
+	v.mustBe(types.Array, "SetIndex")
+	v.items[i] = element
+}
+
+// Append adds elements to the end of an Array
+func (v *Value) Append(elements ...Value) {
+	v.mustBe(types.Array, "Append")
+	v.items = append(v.items, elements...)
+}
+
+// Tagged reports whether a Struct uses the tagged encoding with field ids
+func (v Value) Tagged() bool {
+	v.mustBe(types.Struct, "Tagged")
+	return v.tagged
+}
+
+// Field returns the i'th field of a Struct in encoded order
+func (v Value) Field(i int) Value {
+	v.mustBe(types.Struct, "Field")
+	return v.items[i]
+}
+
+// FieldID returns the id of the i'th field of a tagged Struct
+func (v Value) FieldID(i int) uint64 {
+	v.mustBe(types.Struct, "FieldID")
+	if !v.tagged {
+		panic("ebe: call of Value.FieldID on positional Struct Value")
+	}
+	return v.ids[i]
+}
+
+// FieldByID returns the field of a tagged Struct with the given id
+func (v Value) FieldByID(id uint64) (Value, bool) {
+	v.mustBe(types.Struct, "FieldByID")
+	for i, fieldID := range v.ids {
+		if fieldID == id {
+			return v.items[i], true
+		}
+	}
+	return Value{}, false
+}
+
+// SetField replaces the i'th field of a Struct
+func (v *Value) SetField(i int, field Value) {
+	v.mustBe(types.Struct, "SetField")
+	v.items[i] = field
+}
+
+// MapIndex returns the value stored under key in a Map
+func (v Value) MapIndex(key Value) (Value, bool) {
+	v.mustBe(types.Map, "MapIndex")
+	if i := v.mapKeyIndex(key); i >= 0 {
+		return v.items[i], true
+	}
+	return Value{}, false
+}
+
+// SetMapIndex stores value under key in a Map, replacing any entry with an equal key
+// New entries are encoded after the existing ones
+func (v *Value) SetMapIndex(key, value Value) {
+	v.mustBe(types.Map, "SetMapIndex")
+	encoded, err := key.MarshalEBE(nil)
+	if err == nil {
+		if i, found := v.keyPositions()[string(encoded)]; found {
+			v.items[i] = value
+			return
+		}
+	}
+	v.keys = append(v.keys, key)
+	v.items = append(v.items, value)
+	if err == nil {
+		v.index.positions[string(encoded)] = len(v.keys) - 1
+		v.index.keys = v.keys
+	}
+}
+
+// MapRange returns an iterator over the entries of a Map in encoded order
+func (v Value) MapRange() *MapIter {
+	v.mustBe(types.Map, "MapRange")
+	return &MapIter{m: v, i: -1}
+}
+
+// MapIter iterates over the entries of a Map Value, see Value.MapRange
+type MapIter struct {
+	m Value
+	i int
+}
+
+// Next advances the iterator and reports whether there is another entry
+func (it *MapIter) Next() bool {
+	if it.i+1 >= len(it.m.keys) {
+		it.i = len(it.m.keys)
+		return false
+	}
+	it.i++
+	return true
+}
+
+// Key returns the key of the current entry
+func (it *MapIter) Key() Value {
+	return it.m.keys[it.i]
+}
+
+// Value returns the value of the current entry
+func (it *MapIter) Value() Value {
+	return it.m.items[it.i]
+}
+
+// Equal reports whether two values have the same kinds and contents
+func (v Value) Equal(other Value) bool {
+	a, errA := v.MarshalEBE(nil)
+	b, errB := other.MarshalEBE(nil)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// Interface returns the value as the plain Go types produced by decoding into interface{}
+// Map entries whose keys cannot be Go map keys, such as arrays, are left out
+func (v Value) Interface() interface{} {
+	switch v.Kind() {
+	case types.UInt:
+		return v.bits
+	case types.SInt:
+		return int64(v.bits)
+	case types.Float:
+		return math.Float64frombits(v.bits)
+	case types.Complex:
+		return v.cplx
+	case types.Boolean:
+		return v.bits != 0
+	case types.String:
+		return v.str
+	case types.Buffer:
+		return v.buf
+	case types.Json:
+		var value interface{}
+		if err := json.Unmarshal(v.buf, &value); err != nil {
+			return json.RawMessage(v.buf)
+		}
+		return value
+	case types.Extended:
+		switch v.extended {
+		case types.ExtendedDuration:
+			return time.Duration(v.bits)
+		case types.ExtendedTyped:
+			// Registered types are decoded as their concrete type, anything else as the value it holds
+			if registered, found := lookupRegisteredID(v.bits); found {
+				ptr := reflect.New(registered.t)
+				if data, err := v.items[0].MarshalEBE(nil); err == nil && Unmarshal(data, ptr.Interface()) == nil {
+					return ptr.Elem().Interface()
+				}
+			}
+			return v.items[0].Interface()
+		}
+		return v.time
+	case types.Array:
+		return interfaceValues(v.items)
+	case types.Struct:
+		if !v.tagged {
+			return interfaceValues(v.items)
+		}
+		fields := make(map[uint64]interface{}, len(v.items))
+		for i, id := range v.ids {
+			fields[id] = v.items[i].Interface()
+		}
+		return fields
+	case types.Map:
+		stringKeys := true
+		for _, key := range v.keys {
+			if key.Kind() != types.String {
+				stringKeys = false
+				break
+			}
+		}
+		if stringKeys {
+			result := make(map[string]interface{}, len(v.keys))
+			for i, key := range v.keys {
+				result[key.str] = v.items[i].Interface()
+			}
+			return result
+		}
+		result := make(map[interface{}]interface{}, len(v.keys))
+		for i, key := range v.keys {
+			if k := key.Interface(); k == nil || reflect.TypeOf(k).Comparable() {
+				result[k] = v.items[i].Interface()
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// MarshalEBE appends the encoding of the value to dst
+func (v Value) MarshalEBE(dst []byte) ([]byte, error) {
+	var err error
+
+	switch v.Kind() {
+	case types.Null:
+		return appendNull(dst), nil
+	case types.UInt:
+		return appendUint(dst, v.bits), nil
+	case types.SInt:
+		return appendSint(dst, int64(v.bits)), nil
+	case types.Float:
+		return appendFloat(dst, math.Float64frombits(v.bits)), nil
+	case types.Complex:
+		return appendComplex(dst, v.cplx), nil
+	case types.Boolean:
+		return appendBoolean(dst, v.bits != 0), nil
+	case types.String:
+		return appendString(dst, v.str), nil
+	case types.Buffer:
+		return appendBuffer(dst, v.buf), nil
+	case types.Json:
+		return appendJson(dst, v.buf), nil
+
+	case types.Extended:
+		switch v.extended {
+		case types.ExtendedDuration:
+			return appendDuration(dst, time.Duration(v.bits)), nil
+		case types.ExtendedTyped:
+			dst = append(dst, types.CreateHeader(types.Extended, types.ExtendedTyped))
+			dst = appendUint(dst, v.bits)
+			return v.items[0].MarshalEBE(dst)
+		}
+		return appendTime(dst, v.time), nil
+
+	case types.Array:
+		if bits, ok := v.numericBits(); ok {
+			return appendNumericElements(dst, v.elementType, bits), nil
+		}
+		dst = appendArrayHeader(dst, len(v.items), v.elementType)
+		for i, element := range v.items {
+			if dst, err = element.MarshalEBE(dst); err != nil {
+				return dst, fmt.Errorf("failed to serialize array element %d: %w", i, err)
+			}
+		}
+		return dst, nil
+
+	case types.Map:
+		dst = appendMapHeader(dst, len(v.keys))
+		for i, key := range v.keys {
+			if dst, err = key.MarshalEBE(dst); err != nil {
+				return dst, fmt.Errorf("failed to serialize map key: %w", err)
+			}
+			if dst, err = v.items[i].MarshalEBE(dst); err != nil {
+				return dst, fmt.Errorf("failed to serialize map value: %w", err)
+			}
+		}
+		return dst, nil
+
+	case types.Struct:
+		if v.tagged {
+			dst = appendTaggedStructHeader(dst, len(v.items))
+		} else {
+			dst = appendStructHeader(dst, len(v.items))
+		}
+		for i, field := range v.items {
+			if v.tagged {
+				dst = appendUint(dst, v.ids[i])
+			}
+			if dst, err = field.MarshalEBE(dst); err != nil {
+				return dst, fmt.Errorf("failed to serialize struct field %d: %w", i, err)
+			}
+		}
+		return dst, nil
+
+	default:
+		return dst, fmt.Errorf("unsupported value kind: %s", types.TypeName(v.Kind()))
+	}
+}
+
+// UnmarshalEBE decodes any encoded value, keeping its exact wire types
+func (v *Value) UnmarshalEBE(r io.Reader, header byte) error {
+	value, err := readValue(r, header)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// readValue decodes the value with a pre-read header into a Value
+func readValue(r io.Reader, header byte) (Value, error) {
+
+	headerType := types.TypeFromHeader(header)
+
+	if isNestedHeader(header) {
+		if err := enterNested(r); err != nil {
+			return Value{}, err
+		}
+		defer leaveNested(r)
+	}
+
+	switch headerType {
+
+	case types.Null:
+		return Value{}, nil
+
+	case types.UNibble:
+		return UintValue(uint64(types.ValueFromHeader(header))), nil
+
+	case types.UInt:
+		value, err := deserializeUint(r, header)
+		return UintValue(value), err
+
+	case types.SNibble, types.SInt:
+		value, err := deserializeDynamic(r, header)
+		if err != nil {
+			return Value{}, err
+		}
+		return IntValue(value.(int64)), nil
+
+	case types.Float:
+		value, err := deserializeFloat(r, header)
+		return FloatValue(value), err
+
+	case types.Complex:
+		value, err := deserializeComplex(r, header)
+		return ComplexValue(value), err
+
+	case types.Boolean:
+		value, err := deserializeBoolean(r, header)
+		return BoolValue(value), err
+
+	case types.String:
+		value, err := deserializeString(r, header)
+		return StringValue(value), err
+
+	case types.Buffer:
+		var value []byte
+		if err := deserializeWithHeader(r, header, &value); err != nil {
+			return Value{}, err
+		}
+		return BytesValue(value), nil
+
+	case types.Json:
+		var value json.RawMessage
+		if err := deserializeJson(r, header, &value); err != nil {
+			return Value{}, err
+		}
+		return JsonValue(value), nil
+
+	case types.Extended:
+		// Typed values keep their id and inner value so they survive without the type being registered
+		if types.ValueFromHeader(header) == types.ExtendedTyped {
+			id, err := deserializeUintWithHeader(r)
+			if err != nil {
+				return Value{}, fmt.Errorf("failed to read type id: %w", err)
+			}
+			value, err := readNextValue(r)
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{kind: types.Extended, valid: true, extended: types.ExtendedTyped, bits: id, items: []Value{value}}, nil
+		}
+		value, err := readExtended(r, header, valueType)
+		if err != nil {
+			return Value{}, err
+		}
+		if duration, ok := value.(time.Duration); ok {
+			return DurationValue(duration), nil
+		}
+		v := TimeValue(value.(time.Time))
+		v.extended = types.ValueFromHeader(header)
+		return v, nil
+
+	case types.Array:
+		length, elementType, packing, err := readArrayHeader(r, header, valueType)
+		if err != nil {
+			return Value{}, err
+		}
+		if packing.packed {
+			elements, err := readPackedValues(r, length, elementType, packing)
+			if err != nil {
+				return Value{}, err
+			}
+			return ArrayValue(elementType, elements...), nil
+		}
+		elements, err := readValues(r, length, "array element")
+		if err != nil {
+			return Value{}, err
+		}
+		return ArrayValue(elementType, elements...), nil
+
+	case types.Map:
+		entryCount, err := readMapHeader(r, header, valueType)
+		if err != nil {
+			return Value{}, err
+		}
+		if err := reserveType(r, 2*entryCount, valueType); err != nil {
+			return Value{}, err
+		}
+		m := MapValue()
+		m.keys = make([]Value, entryCount)
+		m.items = make([]Value, entryCount)
+		for i := range m.keys {
+			if m.keys[i], err = readNextValue(r); err != nil {
+				return Value{}, fmt.Errorf("failed to deserialize map key %d: %w", i, err)
+			}
+			if m.items[i], err = readNextValue(r); err != nil {
+				return Value{}, fmt.Errorf("failed to deserialize map value %d: %w", i, err)
+			}
+		}
+		return m, nil
+
+	case types.Struct:
+		fieldCount, tagged, err := readStructHeader(r, header, valueType)
+		if err != nil {
+			return Value{}, err
+		}
+		if !tagged {
+			fields, err := readValues(r, fieldCount, "struct field")
+			if err != nil {
+				return Value{}, err
+			}
+			return StructValue(fields...), nil
+		}
+		if err := reserve(r, fieldCount, 8+valueType.Size()); err != nil {
+			return Value{}, err
+		}
+		s := TaggedStructValue()
+		s.ids = make([]uint64, fieldCount)
+		s.items = make([]Value, fieldCount)
+		for i := range s.ids {
+			if s.ids[i], err = deserializeUintWithHeader(r); err != nil {
+				return Value{}, fmt.Errorf("failed to read struct field id: %w", err)
+			}
+			if s.items[i], err = readNextValue(r); err != nil {
+				return Value{}, fmt.Errorf("failed to deserialize struct field id %d: %w", s.ids[i], err)
+			}
+		}
+		return s, nil
+
+	default:
+		return Value{}, &UnsupportedTypeError{Wire: headerType, Offset: headerOffset(r)}
+	}
+}
+
+// readNextValue reads a header and decodes the value that follows it
+func readNextValue(r io.Reader) (Value, error) {
+	header, err := utils.ReadByte(r)
+	if err != nil {
+		return Value{}, fmt.Errorf("failed to read header: %w", err)
+	}
+	return readValue(r, header)
+}
+
+// readValues decodes count consecutive values
+func readValues(r io.Reader, count uint64, what string) ([]Value, error) {
+	if err := checkCount(r, count); err != nil {
+		return nil, err
+	}
+	if err := reserveType(r, count, valueType); err != nil {
+		return nil, err
+	}
+	values := make([]Value, count)
+	for i := range values {
+		value, err := readNextValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize %s %d: %w", what, i, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// readPackedValues reads the elements of a packed array whose header has been read
+func readPackedValues(r io.Reader, length uint64, elementType types.Types, packing arrayPacking) ([]Value, error) {
+	p, err := newPackedReader(r, length, packing)
+	if err != nil {
+		return nil, err
+	}
+	if err := reserveType(r, length, valueType); err != nil {
+		return nil, err
+	}
+	values := make([]Value, length)
+	for i := range values {
+		element, err := p.element(elementType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize array element %d: %w", i, err)
+		}
+		switch element := element.(type) {
+		case int64:
+			values[i] = IntValue(element)
+		case uint64:
+			values[i] = UintValue(element)
+		case float64:
+			values[i] = FloatValue(element)
+		case time.Time:
+			values[i] = TimeValue(element)
+		case bool:
+			values[i] = BoolValue(element)
+		}
+	}
+	return values, nil
+}
+
+// numericBits returns the bits of the elements of an array that can be packed, which is when
+// its element type is SInt, UInt, Float or Boolean and every element is of that kind
+func (v Value) numericBits() ([]uint64, bool) {
+	if !isPackable(v.elementType) {
+		return nil, false
+	}
+	bits := make([]uint64, len(v.items))
+	for i, element := range v.items {
+		if element.kind != v.elementType {
+			return nil, false
+		}
+		bits[i] = element.bits
+	}
+	return bits, true
+}
+
+// mapKeyIndex returns the position of the entry whose key equals key, or -1
+func (v Value) mapKeyIndex(key Value) int {
+	encoded, err := key.MarshalEBE(nil)
+	if err != nil {
+		return -1
+	}
+	if i, found := v.keyPositions()[string(encoded)]; found {
+		return i
+	}
+	return -1
+}
+
+// keyPositions returns the position of each key of a Map by its encoding, indexing the keys the first time
+// Keys that cannot be encoded are never equal to another key, and the first of equal keys is the one found
+func (v Value) keyPositions() map[string]int {
+	indexed := v.index.keys
+	if v.index.positions != nil && len(indexed) == len(v.keys) && (len(indexed) == 0 || &indexed[0] == &v.keys[0]) {
+		return v.index.positions
+	}
+
+	positions := make(map[string]int, len(v.keys))
+	var scratch []byte
+	for i, key := range v.keys {
+		var err error
+		if scratch, err = key.MarshalEBE(scratch[:0]); err != nil {
+			continue
+		}
+		if _, found := positions[string(scratch)]; !found {
+			positions[string(scratch)] = i
+		}
+	}
+	v.index.keys, v.index.positions = v.keys, positions
+	return positions
+}
+
+// mustBe panics if the value is not of the expected kind
+func (v Value) mustBe(kind types.Types, method string) {
+	if v.Kind() != kind {
+		panic(fmt.Sprintf("ebe: call of Value.%s on %s Value", method, types.TypeName(v.Kind())))
+	}
+}
+
+// interfaceValues converts a list of values to their plain Go representations
+func interfaceValues(values []Value) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value.Interface()
+	}
+	return result
+}
@@ -336,9 +336,10 @@ func TestArrayWireFormat(t *testing.T) {
 
 	t.Run("large array format", func(t *testing.T) {
 		// Test array with >7 elements (length as separate UInt)
+		// The elements fit in their headers, so the array is not packed
 		input := make([]int, 10)
 		for i := range input {
-			input[i] = i
+			input[i] = i % 8
 		}
 
 		var buf bytes.Buffer
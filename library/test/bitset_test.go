@@ -0,0 +1,319 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// featureFlags returns n flags with every third one and every seventh one set
+func featureFlags(n int) []bool {
+	flags := make([]bool, n)
+	for i := range flags {
+		flags[i] = i%3 == 0 || i%7 == 0
+	}
+	return flags
+}
+
+func TestBoolArrayPackedAsBits(t *testing.T) {
+	flags := featureFlags(10000)
+	data, err := serialize.Marshal(flags)
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	if width := packedWidth(t, data); width != types.PackedBits {
+		t.Fatalf("Expected bit packing, got %d", width)
+	}
+
+	// Header, UInt count of two bytes, element type, packing and 1250 bytes of bits
+	if len(data) != 1+3+1+1+1250 {
+		t.Errorf("Expected %d bytes, got %d", 1+3+1+1+1250, len(data))
+	}
+
+	var decoded []bool
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling flags: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, flags) {
+		t.Errorf("Decoded flags differ from the originals")
+	}
+	if !serialize.IsCanonical(data) {
+		t.Errorf("Expected bit packed array to be canonical")
+	}
+}
+
+func TestBoolArrayBitOrder(t *testing.T) {
+	data, err := serialize.Marshal([]bool{true, false, false, true, true, false, false, false, false, true})
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	expected := []byte{
+		packedHeader, types.CreateHeader(types.UNibble, 10), byte(types.Boolean), types.PackedBits,
+		0x19, 0x02,
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected % x, got % x", expected, data)
+	}
+}
+
+func TestShortBoolArrayStaysRegular(t *testing.T) {
+	for _, flags := range [][]bool{{}, {true}, {true, false}, {false, true, true}} {
+		data, err := serialize.Marshal(flags)
+		if err != nil {
+			t.Fatalf("Error marshaling flags: %v", err)
+		}
+		if data[0] != types.CreateHeader(types.Array, byte(len(flags))) {
+			t.Errorf("Expected %v as a regular array, got % x", flags, data)
+		}
+	}
+
+	// From four elements the bits are smaller than a header each
+	data, err := serialize.Marshal([]bool{true, true, false, true})
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	if width := packedWidth(t, data); width != types.PackedBits {
+		t.Errorf("Expected bit packing, got %d", width)
+	}
+}
+
+func TestBoolArrayFixedLengthAndStruct(t *testing.T) {
+	type settings struct {
+		Flags   [12]bool
+		Enabled []bool
+		Name    string
+	}
+	in := settings{Enabled: featureFlags(40), Name: "after"}
+	for i := range in.Flags {
+		in.Flags[i] = i%2 == 1
+	}
+
+	data, err := serialize.Marshal(in)
+	if err != nil {
+		t.Fatalf("Error marshaling settings: %v", err)
+	}
+	var out settings
+	if err := serialize.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Error unmarshaling settings: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+	if n, err := serialize.SkipValueBytes(data); err != nil || n != len(data) {
+		t.Errorf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+	}
+}
+
+func TestBoolArrayDynamic(t *testing.T) {
+	flags := featureFlags(20)
+	data, err := serialize.Marshal(flags)
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+
+	var dynamic interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling into interface: %v", err)
+	}
+	elements, ok := dynamic.([]interface{})
+	if !ok || len(elements) != len(flags) {
+		t.Fatalf("Expected %d elements, got %#v", len(flags), dynamic)
+	}
+	for i, element := range elements {
+		if element != flags[i] {
+			t.Errorf("Element %d: expected %v, got %#v", i, flags[i], element)
+		}
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if value.Len() != len(flags) {
+		t.Fatalf("Expected %d elements, got %d", len(flags), value.Len())
+	}
+	reencoded, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling Value: %v", err)
+	}
+	if !bytes.Equal(reencoded, data) {
+		t.Errorf("Expected Value to re-encode as % x, got % x", data, reencoded)
+	}
+}
+
+func TestBoolArrayCanonicalizesToBits(t *testing.T) {
+	flags := featureFlags(16)
+	regular := []byte{types.CreateHeader(types.Array, 8), types.CreateHeader(types.UInt, 1), 16, byte(types.Boolean)}
+	for _, flag := range flags {
+		value := byte(0)
+		if flag {
+			value = 1
+		}
+		regular = append(regular, types.CreateHeader(types.Boolean, value))
+	}
+	if serialize.IsCanonical(regular) {
+		t.Errorf("Expected a regular array of 16 bools not to be canonical")
+	}
+
+	canonical, err := serialize.Canonicalize(regular)
+	if err != nil {
+		t.Fatalf("Error canonicalizing flags: %v", err)
+	}
+	expected, err := serialize.Marshal(flags)
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	if !bytes.Equal(canonical, expected) {
+		t.Errorf("Expected % x, got % x", expected, canonical)
+	}
+}
+
+func TestBoolArrayInvalidPacking(t *testing.T) {
+	data := []byte{packedHeader, types.CreateHeader(types.UNibble, 10), byte(types.Boolean), 1, 0x19, 0x02}
+	var flags []bool
+	if err := serialize.Unmarshal(data, &flags); err == nil {
+		t.Errorf("Expected an error for a Boolean array packed by width")
+	}
+	data = []byte{packedHeader, types.CreateHeader(types.UNibble, 10), byte(types.UInt), types.PackedBits, 0x19, 0x02}
+	var values []uint
+	if err := serialize.Unmarshal(data, &values); err == nil {
+		t.Errorf("Expected an error for a UInt array packed as bits")
+	}
+}
+
+func TestBoolArrayTruncated(t *testing.T) {
+	data, err := serialize.Marshal(featureFlags(100))
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	truncated := data[:len(data)-1]
+
+	var flags []bool
+	if err := serialize.Unmarshal(truncated, &flags); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	var set serialize.Bitset
+	if err := serialize.Unmarshal(truncated, &set); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := serialize.SkipValueBytes(truncated); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestBitset(t *testing.T) {
+	set := serialize.NewBitset(10)
+	set.Set(0, true)
+	set.Set(3, true)
+	set.Set(4, true)
+	set.Set(9, true)
+	set.Set(4, false)
+	set.Set(4, true)
+
+	if set.Len() != 10 || !set.Get(3) || set.Get(5) {
+		t.Errorf("Unexpected bits %v", set.Bools())
+	}
+	if !bytes.Equal(set.Bytes(), []byte{0x19, 0x02}) {
+		t.Errorf("Expected bytes 19 02, got % x", set.Bytes())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Get out of range to panic")
+		}
+	}()
+	set.Get(10)
+}
+
+func TestBitsetRoundTrip(t *testing.T) {
+	flags := featureFlags(1000)
+	set := serialize.NewBitset(len(flags))
+	for i, flag := range flags {
+		set.Set(i, flag)
+	}
+
+	data, err := serialize.Marshal(set)
+	if err != nil {
+		t.Fatalf("Error marshaling Bitset: %v", err)
+	}
+	expected, err := serialize.Marshal(flags)
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected Bitset to encode like []bool")
+	}
+
+	var decoded serialize.Bitset
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling Bitset: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Bools(), flags) {
+		t.Errorf("Decoded Bitset differs from the original")
+	}
+
+	// A Bitset also decodes regular Boolean arrays, and a []bool decodes a Bitset
+	short, err := serialize.Marshal([]bool{true, false, true})
+	if err != nil {
+		t.Fatalf("Error marshaling flags: %v", err)
+	}
+	if err := serialize.Unmarshal(short, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling Bitset: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Bools(), []bool{true, false, true}) {
+		t.Errorf("Expected [true false true], got %v", decoded.Bools())
+	}
+	var bools []bool
+	if err := serialize.Unmarshal(data, &bools); err != nil || !reflect.DeepEqual(bools, flags) {
+		t.Errorf("Expected Bitset to decode into []bool (%v)", err)
+	}
+
+	type record struct {
+		Flags *serialize.Bitset
+		Name  string
+	}
+	recordData, err := serialize.Marshal(record{Flags: set, Name: "after"})
+	if err != nil {
+		t.Fatalf("Error marshaling record: %v", err)
+	}
+	var out record
+	if err := serialize.Unmarshal(recordData, &out); err != nil {
+		t.Fatalf("Error unmarshaling record: %v", err)
+	}
+	if out.Flags == nil || !reflect.DeepEqual(out.Flags.Bools(), flags) || out.Name != "after" {
+		t.Errorf("Unexpected record %+v", out)
+	}
+}
+
+func TestBitsetTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		wire  types.Types
+	}{
+		{"int elements", []int{1, 2, 3}, types.SInt},
+		{"string", "bits", types.String},
+		{"map", map[string]bool{"a": true}, types.Map},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling value: %v", err)
+			}
+			var set serialize.Bitset
+			var mismatch *serialize.TypeMismatchError
+			if err := serialize.Unmarshal(data, &set); !errors.As(err, &mismatch) {
+				t.Fatalf("Expected a TypeMismatchError, got %v", err)
+			}
+			if mismatch.Wire != tt.wire || mismatch.GoType != reflect.TypeOf(set) || mismatch.Offset != 0 {
+				t.Errorf("Expected %s into Bitset at offset 0, got %+v", types.TypeName(tt.wire), mismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type canonicalRecord struct {
+	Name   string
+	Scores map[string]int
+	Tags   map[int]string
+	Extra  map[string]interface{}
+}
+
+func newCanonicalRecord() canonicalRecord {
+	record := canonicalRecord{
+		Name:   "record",
+		Scores: make(map[string]int),
+		Tags:   make(map[int]string),
+		Extra:  map[string]interface{}{"nested": map[string]bool{"x": true, "y": false, "z": true}},
+	}
+	for i := 0; i < 50; i++ {
+		record.Scores[string(rune('a'+i%26))+string(rune('A'+i/26))] = i * 1000
+		record.Tags[i*37] = "tag"
+	}
+	return record
+}
+
+func TestMarshalCanonicalIsDeterministic(t *testing.T) {
+	first, err := serialize.MarshalCanonical(newCanonicalRecord())
+	if err != nil {
+		t.Fatalf("Error marshaling record: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		data, err := serialize.MarshalCanonical(newCanonicalRecord())
+		if err != nil {
+			t.Fatalf("Error marshaling record: %v", err)
+		}
+		if !bytes.Equal(first, data) {
+			t.Fatalf("Canonical encoding changed between calls")
+		}
+	}
+
+	if !serialize.IsCanonical(first) {
+		t.Errorf("Expected MarshalCanonical output to be canonical")
+	}
+
+	var decoded canonicalRecord
+	if err := serialize.UnmarshalWithOptions(first, &decoded, serialize.DecodeOptions{Canonical: true}); err != nil {
+		t.Fatalf("Error unmarshaling canonical record: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Scores, newCanonicalRecord().Scores) || !reflect.DeepEqual(decoded.Tags, newCanonicalRecord().Tags) {
+		t.Errorf("Canonical record did not round trip")
+	}
+}
+
+func TestCanonicalMapKeysSortedByEncoding(t *testing.T) {
+	data, err := serialize.MarshalCanonical(map[string]int{"b": 2, "a": 1, "c": 3})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+	expected := []byte{
+		types.CreateHeader(types.Map, 3),
+		types.CreateHeader(types.String, 1), 'a', types.CreateHeader(types.SNibble, 1),
+		types.CreateHeader(types.String, 1), 'b', types.CreateHeader(types.SNibble, 2),
+		types.CreateHeader(types.String, 1), 'c', types.CreateHeader(types.SNibble, 3),
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %x, got %x", expected, data)
+	}
+
+	// The same entries in another order are valid but not canonical
+	unsorted := append([]byte{expected[0]}, expected[4:7]...)
+	unsorted = append(unsorted, expected[1:4]...)
+	unsorted = append(unsorted, expected[7:]...)
+	if serialize.IsCanonical(unsorted) {
+		t.Errorf("Expected unsorted map not to be canonical")
+	}
+	canonical, err := serialize.Canonicalize(unsorted)
+	if err != nil {
+		t.Fatalf("Error canonicalizing map: %v", err)
+	}
+	if !bytes.Equal(canonical, expected) {
+		t.Errorf("Expected %x, got %x", expected, canonical)
+	}
+}
+
+func TestCanonicalizeNonMinimalEncodings(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		canonical []byte
+	}{
+		{"UInt that fits a nibble", []byte{0x31, 0x05}, []byte{0x05}},
+		{"UInt with a leading zero", []byte{0x32, 0x00, 0xff}, []byte{0x31, 0xff}},
+		{"zero as UNibble", []byte{0x00}, []byte{0x10}},
+		{"negative zero SNibble", []byte{0x18}, []byte{0x10}},
+		{"SInt that fits a nibble", []byte{0x21, 0x83}, []byte{0x1b}},
+		{"SInt with a leading zero", []byte{0x22, 0x00, 0x40}, []byte{0x21, 0x40}},
+		{"float64 that fits a float32", append([]byte{0x48}, f64bytes(float64(float32(0.1)))...), append([]byte{0x44}, f32bytes(0.1)...)},
+		{"half precision float", []byte{0x42, 0x00, 0x3e}, append([]byte{0x44}, f32bytes(1.5)...)},
+		{"float32 that fits the header", append([]byte{0x44}, f32bytes(-1)...), []byte{0x47}},
+		{"boolean nibble", []byte{0x62}, []byte{0x61}},
+		{"string with a long length", []byte{0x78, 0x03, 'a', 'b', 'c'}, []byte{0x73, 'a', 'b', 'c'}},
+		{"map with a long count", []byte{0xb8, 0x01, 0x71, 'k', 0x10}, []byte{0xb1, 0x71, 'k', 0x10}},
+		{"nested value", []byte{0x92, 0x03, 0x31, 0x01, 0x02}, []byte{0x92, 0x03, 0x01, 0x02}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if serialize.IsCanonical(tt.data) {
+				t.Errorf("Expected %x not to be canonical", tt.data)
+			}
+			canonical, err := serialize.Canonicalize(tt.data)
+			if err != nil {
+				t.Fatalf("Error canonicalizing: %v", err)
+			}
+			if !bytes.Equal(canonical, tt.canonical) {
+				t.Errorf("Expected %x, got %x", tt.canonical, canonical)
+			}
+			if !serialize.IsCanonical(canonical) {
+				t.Errorf("Expected %x to be canonical", canonical)
+			}
+		})
+	}
+}
+
+func TestCanonicalNaN(t *testing.T) {
+	// A float32 NaN with a payload
+	data := append([]byte{0x44}, f32bytes(math.Float32frombits(0x7fc00123))...)
+	canonical, err := serialize.MarshalCanonical(math.NaN())
+	if err != nil {
+		t.Fatalf("Error marshaling NaN: %v", err)
+	}
+	other, err := serialize.Canonicalize(data)
+	if err != nil {
+		t.Fatalf("Error canonicalizing NaN: %v", err)
+	}
+	if !bytes.Equal(canonical, other) {
+		t.Errorf("Expected every NaN to have one encoding, got %x and %x", canonical, other)
+	}
+}
+
+func TestCanonicalDuplicateMapKeys(t *testing.T) {
+	data := []byte{0xb2, 0x71, 'k', 0x11, 0x71, 'k', 0x12}
+
+	_, err := serialize.Canonicalize(data)
+	var nonCanonical *serialize.NonCanonicalError
+	if !errors.As(err, &nonCanonical) {
+		t.Fatalf("Expected *NonCanonicalError, got %v", err)
+	}
+	if nonCanonical.Offset != 4 {
+		t.Errorf("Expected offset 4, got %d", nonCanonical.Offset)
+	}
+	if serialize.IsCanonical(data) {
+		t.Errorf("Expected duplicate keys not to be canonical")
+	}
+}
+
+func TestCanonicalDecoderRejectsNonCanonical(t *testing.T) {
+	data := []byte{0x92, 0x03, 0x01, 0x31, 0x02}
+
+	var decoded []uint64
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected non-canonical input to decode by default, got %v", err)
+	}
+
+	err := serialize.UnmarshalWithOptions(data, &decoded, serialize.DecodeOptions{Canonical: true})
+	var nonCanonical *serialize.NonCanonicalError
+	if !errors.As(err, &nonCanonical) {
+		t.Fatalf("Expected *NonCanonicalError, got %v", err)
+	}
+	if nonCanonical.Offset != 3 {
+		t.Errorf("Expected offset 3, got %d", nonCanonical.Offset)
+	}
+
+	// A stream of canonical values decodes, and the offsets keep counting from the start of the stream
+	var stream bytes.Buffer
+	encoder := serialize.NewEncoder(&stream)
+	encoder.SetCanonical(true)
+	for _, value := range []interface{}{map[string]int{"b": 2, "a": 1}, []uint64{1, 2}} {
+		if err := encoder.Encode(value); err != nil {
+			t.Fatalf("Error encoding value: %v", err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	stream.Write(data)
+
+	decoder := serialize.NewDecoder(&stream)
+	decoder.SetCanonical(true)
+	var m map[string]int
+	if err := decoder.Decode(&m); err != nil {
+		t.Fatalf("Error decoding canonical map: %v", err)
+	}
+	if m["a"] != 1 || m["b"] != 2 {
+		t.Errorf("Unexpected map %v", m)
+	}
+	if err := decoder.Decode(&decoded); err != nil || !reflect.DeepEqual(decoded, []uint64{1, 2}) {
+		t.Fatalf("Expected [1 2], got %v (%v)", decoded, err)
+	}
+	err = decoder.Decode(&decoded)
+	if !errors.As(err, &nonCanonical) {
+		t.Fatalf("Expected *NonCanonicalError, got %v", err)
+	}
+	if nonCanonical.Offset != 14 {
+		t.Errorf("Expected offset 14, got %d", nonCanonical.Offset)
+	}
+}
+
+func f32bytes(value float32) []byte {
+	bits := math.Float32bits(value)
+	return []byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)}
+}
+
+func f64bytes(value float64) []byte {
+	bits := math.Float64bits(value)
+	out := make([]byte, 8)
+	for i := range out {
+		out[i] = byte(bits >> (8 * i))
+	}
+	return out
+}
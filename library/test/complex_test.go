@@ -0,0 +1,162 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"math"
+	"math/cmplx"
+	"reflect"
+	"testing"
+)
+
+type iqSample struct {
+	Channel uint8
+	Value   complex64
+	Exact   complex128
+	Window  [2]complex64
+}
+
+func TestComplexWidth(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         interface{}
+		expectedWidth byte
+	}{
+		{"complex64", complex64(complex(1.5, -2.25)), 4},
+		{"complex128 fits float32", complex(0.5, 1024), 4},
+		{"complex128 real needs float64", complex(0.1, 1), 8},
+		{"complex128 imaginary needs float64", complex(1, math.Pi), 8},
+		{"zero", complex128(0), 4},
+		{"infinity", cmplx.Inf(), 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling %v: %v", tc.input, err)
+			}
+			if types.TypeFromHeader(data[0]) != types.Complex {
+				t.Fatalf("Expected Complex header, got %s", types.TypeNameFromHeader(data[0]))
+			}
+			if width := types.ValueFromHeader(data[0]); width != tc.expectedWidth {
+				t.Errorf("Expected component width %d, got %d", tc.expectedWidth, width)
+			}
+			if len(data) != 1+2*int(tc.expectedWidth) {
+				t.Errorf("Expected %d bytes, got %d", 1+2*int(tc.expectedWidth), len(data))
+			}
+		})
+	}
+}
+
+func TestComplexRoundTrip(t *testing.T) {
+	values := []complex128{
+		0,
+		complex(1, -1),
+		complex(math.Pi, math.E),
+		complex(-math.MaxFloat64, math.SmallestNonzeroFloat64),
+		complex(math.Inf(1), math.Inf(-1)),
+	}
+
+	for _, value := range values {
+		data, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling %v: %v", value, err)
+		}
+
+		var decoded complex128
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %v: %v", value, err)
+		}
+		if decoded != value {
+			t.Errorf("Expected %v, got %v", value, decoded)
+		}
+	}
+
+	// NaN parts survive the round trip
+	data, err := serialize.Marshal(complex(math.NaN(), 2))
+	if err != nil {
+		t.Fatalf("Error marshaling NaN: %v", err)
+	}
+	var decoded complex64
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling NaN: %v", err)
+	}
+	if !math.IsNaN(float64(real(decoded))) || imag(decoded) != 2 {
+		t.Errorf("Expected (NaN+2i), got %v", decoded)
+	}
+}
+
+func TestComplexArrays(t *testing.T) {
+	t.Run("complex64 slice", func(t *testing.T) {
+		original := []complex64{1 + 2i, -3.5 - 0.25i, 0}
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling []complex64: %v", err)
+		}
+		if elementType := types.Types(data[1]); elementType != types.Complex {
+			t.Errorf("Expected Complex element type, got %s", types.TypeName(elementType))
+		}
+
+		var decoded []complex64
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling []complex64: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, original) {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+
+	t.Run("complex128 slice", func(t *testing.T) {
+		original := []complex128{complex(0.1, 0.2), 1i, complex(math.MaxFloat64, -1)}
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling []complex128: %v", err)
+		}
+
+		var decoded []complex128
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling []complex128: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, original) {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+}
+
+func TestComplexNested(t *testing.T) {
+	original := iqSample{
+		Channel: 3,
+		Value:   0.5 - 0.5i,
+		Exact:   complex(math.Sqrt2, -math.Sqrt2),
+		Window:  [2]complex64{1i, -1i},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling iqSample: %v", err)
+	}
+
+	var decoded iqSample
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling iqSample: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+
+	// Complex values in interface maps decode as complex128
+	data, err = serialize.Marshal(map[string]interface{}{"gain": complex64(2 + 1i)})
+	if err != nil {
+		t.Fatalf("Error marshaling interface map: %v", err)
+	}
+	var values map[string]interface{}
+	if err := serialize.Unmarshal(data, &values); err != nil {
+		t.Fatalf("Error unmarshaling interface map: %v", err)
+	}
+	if gain, ok := values["gain"].(complex128); !ok || gain != 2+1i {
+		t.Errorf("Expected complex128 (2+1i), got %T %v", values["gain"], values["gain"])
+	}
+}
@@ -0,0 +1,343 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type deltaSeries struct {
+	IDs        []int64     `ebe:",delta"`
+	Counters   []uint64    `ebe:",delta"`
+	Timestamps []time.Time `ebe:",deltaofdelta"`
+}
+
+type plainSeries struct {
+	IDs        []int64
+	Counters   []uint64
+	Timestamps []time.Time
+}
+
+func newDeltaSeries(n int) deltaSeries {
+	series := deltaSeries{
+		IDs:        make([]int64, n),
+		Counters:   make([]uint64, n),
+		Timestamps: make([]time.Time, n),
+	}
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		series.IDs[i] = 1_000_000_000 + int64(i*3)
+		series.Counters[i] = uint64(5_000_000_000 - i*7)
+		series.Timestamps[i] = base.Add(time.Duration(i) * 15 * time.Minute)
+	}
+	return series
+}
+
+func TestDeltaTagRoundTrip(t *testing.T) {
+	series := newDeltaSeries(100)
+	data, err := serialize.Marshal(series)
+	if err != nil {
+		t.Fatalf("Error marshaling series: %v", err)
+	}
+
+	var decoded deltaSeries
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling series: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, series) {
+		t.Errorf("Series did not round trip")
+	}
+
+	// The same fields without the tags take several times as many bytes
+	plain, err := serialize.Marshal(plainSeries(series))
+	if err != nil {
+		t.Fatalf("Error marshaling series: %v", err)
+	}
+	if len(data)*4 > len(plain) {
+		t.Errorf("Expected delta encoding to be under a quarter of %d bytes, got %d", len(plain), len(data))
+	}
+
+	// Untagged types decode delta encoded fields too
+	var untagged plainSeries
+	if err := serialize.Unmarshal(data, &untagged); err != nil {
+		t.Fatalf("Error unmarshaling into untagged series: %v", err)
+	}
+	if !reflect.DeepEqual(deltaSeries(untagged), series) {
+		t.Errorf("Untagged series did not round trip")
+	}
+}
+
+func TestDeltaWireFormat(t *testing.T) {
+	type ids struct {
+		Values []int64 `ebe:",delta"`
+	}
+	data, err := serialize.Marshal(ids{Values: []int64{100, 103, 101, 101}})
+	if err != nil {
+		t.Fatalf("Error marshaling IDs: %v", err)
+	}
+	expected := []byte{
+		types.CreateHeader(types.Struct, 1),
+		types.CreateHeader(types.Array, types.ArrayPacked), types.CreateHeader(types.UNibble, 4), byte(types.SInt), types.PackedDelta,
+		0xc8, 0x01, // zigzag 100
+		0x06, // +3
+		0x03, // -2
+		0x00, // +0
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %x, got %x", expected, data)
+	}
+
+	type times struct {
+		Values []int64 `ebe:",deltaofdelta"`
+	}
+	data, err = serialize.Marshal(times{Values: []int64{10, 20, 30, 41}})
+	if err != nil {
+		t.Fatalf("Error marshaling times: %v", err)
+	}
+	expected = []byte{
+		types.CreateHeader(types.Struct, 1),
+		types.CreateHeader(types.Array, types.ArrayPacked), types.CreateHeader(types.UNibble, 4), byte(types.SInt), types.PackedDeltaOfDelta,
+		0x14, // zigzag 10
+		0x14, // +10
+		0x00, // the difference stays 10
+		0x02, // the difference grows by 1
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %x, got %x", expected, data)
+	}
+}
+
+func TestDeltaExtremes(t *testing.T) {
+	type extremes struct {
+		Signed   []int64  `ebe:",deltaofdelta"`
+		Unsigned []uint64 `ebe:",delta"`
+		Small    []int8   `ebe:",delta"`
+		Empty    []int    `ebe:",delta"`
+		Missing  []uint32 `ebe:",delta"`
+		Fixed    [3]int32 `ebe:",delta"`
+	}
+	value := extremes{
+		Signed:   []int64{-1 << 63, 1<<63 - 1, 0, -1 << 63, 5},
+		Unsigned: []uint64{1<<64 - 1, 0, 1 << 63, 1},
+		Small:    []int8{-128, 127, -128},
+		Empty:    []int{},
+		Fixed:    [3]int32{7, -7, 1 << 30},
+	}
+	data, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var decoded extremes
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling value: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Expected %+v, got %+v", value, decoded)
+	}
+}
+
+func TestDeltaTimesOutsideRange(t *testing.T) {
+	type events struct {
+		At []time.Time `ebe:",delta"`
+	}
+
+	// Times with a zone offset or beyond the nanosecond range are encoded as they would be without the tag
+	zone := time.FixedZone("", 3600)
+	value := events{At: []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, zone),
+	}}
+	data, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling events: %v", err)
+	}
+	var decoded events
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling events: %v", err)
+	}
+	if _, offset := decoded.At[1].Zone(); offset != 3600 || !decoded.At[1].Equal(value.At[1]) {
+		t.Errorf("Expected %v, got %v", value.At[1], decoded.At[1])
+	}
+
+	value.At = []time.Time{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if data, err = serialize.Marshal(value); err != nil {
+		t.Fatalf("Error marshaling events: %v", err)
+	}
+	if err := serialize.Unmarshal(data, &decoded); err != nil || !decoded.At[0].Equal(value.At[0]) {
+		t.Errorf("Expected %v, got %v (%v)", value.At[0], decoded.At, err)
+	}
+}
+
+func TestDeltaTagRequiresIntegersOrTimes(t *testing.T) {
+	type invalid struct {
+		Names []string `ebe:",delta"`
+	}
+	if _, err := serialize.Marshal(invalid{}); err == nil {
+		t.Errorf("Expected an error for a delta tag on []string")
+	}
+}
+
+func TestDeltaDecodesIntoOtherTypes(t *testing.T) {
+	series := newDeltaSeries(10)
+	data, err := serialize.Marshal(series)
+	if err != nil {
+		t.Fatalf("Error marshaling series: %v", err)
+	}
+
+	var dynamic interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling into interface{}: %v", err)
+	}
+	fields := dynamic.([]interface{})
+	if ids := fields[0].([]interface{}); ids[9] != int64(1_000_000_027) {
+		t.Errorf("Expected ID 1000000027, got %v", ids[9])
+	}
+	if times := fields[2].([]interface{}); !times[9].(time.Time).Equal(series.Timestamps[9]) {
+		t.Errorf("Expected %v, got %v", series.Timestamps[9], times[9])
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if value.Field(1).Index(3).Uint() != series.Counters[3] || !value.Field(2).Index(4).Time().Equal(series.Timestamps[4]) {
+		t.Errorf("Unexpected Value %v", value)
+	}
+
+	type narrow struct {
+		IDs        [10]int
+		Counters   []*uint64
+		Timestamps []*time.Time
+	}
+	var decoded narrow
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling into other types: %v", err)
+	}
+	if decoded.IDs[5] != 1_000_000_015 || *decoded.Counters[2] != series.Counters[2] || !decoded.Timestamps[7].Equal(series.Timestamps[7]) {
+		t.Errorf("Unexpected values %+v", decoded)
+	}
+
+	if n, err := serialize.SkipValueBytes(data); err != nil || n != len(data) {
+		t.Errorf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+	}
+}
+
+func TestDeltaOverflowAndTruncation(t *testing.T) {
+	type ids struct {
+		Values []int64 `ebe:",delta"`
+	}
+	data, err := serialize.Marshal(ids{Values: []int64{100, 110, 120, 130}})
+	if err != nil {
+		t.Fatalf("Error marshaling IDs: %v", err)
+	}
+
+	var small struct{ Values []int8 }
+	err = serialize.Unmarshal(data, &small)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError, got %v", err)
+	}
+	if overflow.Path != "Values[3]" {
+		t.Errorf("Expected path Values[3], got %q", overflow.Path)
+	}
+
+	var decoded ids
+	if err := serialize.Unmarshal(data[:len(data)-1], &decoded); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDeltaCanonicalAndHash(t *testing.T) {
+	series := newDeltaSeries(20)
+	data, err := serialize.Marshal(series)
+	if err != nil {
+		t.Fatalf("Error marshaling series: %v", err)
+	}
+	plain, err := serialize.Marshal(plainSeries(series))
+	if err != nil {
+		t.Fatalf("Error marshaling series: %v", err)
+	}
+
+	// Canonical form never uses deltas, so tags do not change it
+	if serialize.IsCanonical(data) {
+		t.Errorf("Expected delta encoding not to be canonical")
+	}
+	canonical, err := serialize.Canonicalize(data)
+	if err != nil {
+		t.Fatalf("Error canonicalizing series: %v", err)
+	}
+	expected, err := serialize.Canonicalize(plain)
+	if err != nil {
+		t.Fatalf("Error canonicalizing series: %v", err)
+	}
+	if !bytes.Equal(canonical, expected) {
+		t.Errorf("Expected %x, got %x", expected, canonical)
+	}
+
+	tagged, err := serialize.Sum256(series)
+	if err != nil {
+		t.Fatalf("Error hashing series: %v", err)
+	}
+	untagged, err := serialize.Sum256(plainSeries(series))
+	if err != nil {
+		t.Fatalf("Error hashing series: %v", err)
+	}
+	if tagged != untagged {
+		t.Errorf("Expected delta tags not to change the hash")
+	}
+}
+
+func TestEncoderDelta(t *testing.T) {
+	type nested struct {
+		Name   string
+		Series map[string]plainSeries
+		Values []float64
+	}
+	series := newDeltaSeries(50)
+	value := nested{
+		Name:   "metrics",
+		Series: map[string]plainSeries{"cpu": plainSeries(series)},
+		Values: []float64{0.1, 0.2},
+	}
+
+	var plain, delta bytes.Buffer
+	if err := serialize.Serialize(value, &plain); err != nil {
+		t.Fatalf("Error serializing value: %v", err)
+	}
+	encoder := serialize.NewEncoder(&delta)
+	encoder.SetDelta(serialize.DeltaOfDelta)
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+
+	// Arrays too short to gain from deltas are left as they are
+	if err := encoder.Encode([]int64{1, 2}); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	short, _ := serialize.Marshal([]int64{1, 2})
+	if !bytes.HasSuffix(delta.Bytes(), short) {
+		t.Errorf("Expected %x at the end of the stream, got %x", short, delta.Bytes())
+	}
+
+	if delta.Len()-len(short) >= plain.Len()/2 {
+		t.Errorf("Expected the delta encoder to halve %d bytes, got %d", plain.Len(), delta.Len()-len(short))
+	}
+
+	var decoded nested
+	decoder := serialize.NewDecoder(&delta)
+	if err := decoder.Decode(&decoded); err != nil {
+		t.Fatalf("Error decoding value: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Value did not round trip")
+	}
+}
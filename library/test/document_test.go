@@ -0,0 +1,277 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValueKinds(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input interface{}
+		kind  types.Types
+	}{
+		{"unsigned nibble", uint8(1), types.UInt},
+		{"unsigned", uint64(1 << 40), types.UInt},
+		{"signed nibble", int8(1), types.SInt},
+		{"signed", int32(-100000), types.SInt},
+		{"float", 1.25, types.Float},
+		{"complex", complex64(1i), types.Complex},
+		{"bool", false, types.Boolean},
+		{"string", "text", types.String},
+		{"buffer", []byte("text"), types.Buffer},
+		{"null", nil, types.Null},
+		{"time", time.Unix(0, 0).UTC(), types.Extended},
+		{"array", []int{1}, types.Array},
+		{"map", map[string]int{"a": 1}, types.Map},
+		{"struct", exampleStruct{}, types.Struct},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := serialize.ValueOf(tc.input)
+			if err != nil {
+				t.Fatalf("Error building Value: %v", err)
+			}
+			if value.Kind() != tc.kind {
+				t.Errorf("Expected kind %s, got %s", types.TypeName(tc.kind), types.TypeName(value.Kind()))
+			}
+		})
+	}
+
+	// The zero Value is Null
+	var zero serialize.Value
+	if !zero.IsNull() || zero.Kind() != types.Null {
+		t.Errorf("Expected zero Value to be Null, got %s", types.TypeName(zero.Kind()))
+	}
+}
+
+func TestValueAccessors(t *testing.T) {
+	value, err := serialize.ValueOf(struct {
+		Count  uint16
+		Delta  int
+		Ratio  float64
+		Name   string
+		Raw    []byte
+		Scores []int32
+		Labels map[string]string
+	}{7, -9, 0.5, "doc", []byte{0xff}, []int32{3, 4}, map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatalf("Error building Value: %v", err)
+	}
+
+	if value.Len() != 7 {
+		t.Fatalf("Expected 7 fields, got %d", value.Len())
+	}
+	if got := value.Field(0).Uint(); got != 7 {
+		t.Errorf("Expected Count 7, got %d", got)
+	}
+	if got := value.Field(1).Int(); got != -9 {
+		t.Errorf("Expected Delta -9, got %d", got)
+	}
+	if got := value.Field(2).Float(); got != 0.5 {
+		t.Errorf("Expected Ratio 0.5, got %v", got)
+	}
+	if got := value.Field(3).Str(); got != "doc" {
+		t.Errorf("Expected Name doc, got %q", got)
+	}
+	if got := value.Field(4).Bytes(); !reflect.DeepEqual(got, []byte{0xff}) {
+		t.Errorf("Expected Raw [ff], got [% x]", got)
+	}
+
+	scores := value.Field(5)
+	if scores.ElementType() != types.SInt || scores.Len() != 2 || scores.Index(1).Int() != 4 {
+		t.Errorf("Expected SInt array [3 4], got %v", scores.Interface())
+	}
+
+	iter := value.Field(6).MapRange()
+	entries := 0
+	for iter.Next() {
+		entries++
+		if iter.Key().Str() != "k" || iter.Value().Str() != "v" {
+			t.Errorf("Expected entry k=v, got %v=%v", iter.Key().Interface(), iter.Value().Interface())
+		}
+	}
+	if entries != 1 {
+		t.Errorf("Expected 1 map entry, got %d", entries)
+	}
+
+	// Accessors of the wrong kind panic
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic calling Int on a UInt Value")
+		}
+	}()
+	value.Field(0).Int()
+}
+
+func TestValueReencodesIdentically(t *testing.T) {
+	original := map[string]interface{}{
+		"id":      uint64(12),
+		"offset":  int64(-3),
+		"name":    "payload",
+		"blob":    []byte("payload"),
+		"weights": []float32{0.5, 1.5},
+		"nested":  map[int]exampleStruct{1: {A: 1, C: "x"}},
+		"when":    time.Date(2024, time.January, 2, 3, 4, 5, 6, time.FixedZone("", 3600)),
+		"account": accountV1{ID: 1, Name: "n", Email: "e"},
+		"nothing": nil,
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling payload: %v", err)
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+
+	reencoded, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling Value: %v", err)
+	}
+	if !reflect.DeepEqual(reencoded, data) {
+		t.Errorf("Expected re-encoded Value to match original encoding\nexpected [% x]\ngot      [% x]", data, reencoded)
+	}
+}
+
+func TestValueModify(t *testing.T) {
+	data, err := serialize.Marshal(accountV2{ID: 5, Name: "old", Tags: []string{"a"}, Limits: map[string]int{"x": 1}})
+	if err != nil {
+		t.Fatalf("Error marshaling account: %v", err)
+	}
+
+	var doc serialize.Value
+	if err := serialize.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if !doc.Tagged() {
+		t.Fatal("Expected tagged struct Value")
+	}
+
+	// Rename, add a tag and change a limit without knowing the Go type
+	for i := 0; i < doc.Len(); i++ {
+		switch doc.FieldID(i) {
+		case 2:
+			doc.SetField(i, serialize.StringValue("new"))
+		case 5:
+			tags := doc.Field(i)
+			tags.Append(serialize.StringValue("b"))
+			doc.SetField(i, tags)
+		case 6:
+			limits := doc.Field(i)
+			limits.SetMapIndex(serialize.StringValue("x"), serialize.IntValue(2))
+			limits.SetMapIndex(serialize.StringValue("y"), serialize.IntValue(3))
+			doc.SetField(i, limits)
+		}
+	}
+
+	data, err = serialize.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Error marshaling modified Value: %v", err)
+	}
+	var decoded accountV2
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling modified account: %v", err)
+	}
+	expected := accountV2{ID: 5, Name: "new", Tags: []string{"a", "b"}, Limits: map[string]int{"x": 2, "y": 3}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, decoded)
+	}
+}
+
+func TestValueConstructors(t *testing.T) {
+	labels := serialize.MapValue()
+	labels.SetMapIndex(serialize.StringValue("tier"), serialize.StringValue("gold"))
+
+	doc := serialize.StructValue(
+		serialize.UintValue(9),
+		serialize.StringValue("built"),
+		serialize.ArrayValue(types.SInt, serialize.IntValue(1), serialize.IntValue(-1)),
+		labels,
+		serialize.NullValue(),
+	)
+
+	data, err := serialize.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Error marshaling constructed Value: %v", err)
+	}
+
+	var decoded struct {
+		ID     uint32
+		Name   string
+		Deltas []int
+		Labels map[string]string
+		Parent *exampleStruct
+	}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling constructed Value: %v", err)
+	}
+	if decoded.ID != 9 || decoded.Name != "built" || !reflect.DeepEqual(decoded.Deltas, []int{1, -1}) ||
+		decoded.Labels["tier"] != "gold" || decoded.Parent != nil {
+		t.Errorf("Unexpected decoded struct %+v", decoded)
+	}
+
+	tagged := serialize.TaggedStructValue(
+		serialize.TaggedField{ID: 2, Value: serialize.StringValue("by id")},
+		serialize.TaggedField{ID: 1, Value: serialize.UintValue(77)},
+	)
+	if field, ok := tagged.FieldByID(1); !ok || field.Uint() != 77 {
+		t.Errorf("Expected field 1 to be 77, got %v", field.Interface())
+	}
+	data, err = serialize.Marshal(tagged)
+	if err != nil {
+		t.Fatalf("Error marshaling tagged Value: %v", err)
+	}
+	var account accountV1
+	if err := serialize.Unmarshal(data, &account); err != nil {
+		t.Fatalf("Error unmarshaling tagged Value: %v", err)
+	}
+	if account != (accountV1{ID: 77, Name: "by id"}) {
+		t.Errorf("Expected {77 by id}, got %+v", account)
+	}
+}
+
+func TestValueMapIndex(t *testing.T) {
+	// Keys are found through an index, so large maps are built and read in linear time
+	m := serialize.MapValue()
+	const entries = 1 << 15
+	for i := 0; i < entries; i++ {
+		m.SetMapIndex(serialize.IntValue(int64(i)), serialize.IntValue(int64(-i)))
+	}
+	for i := 0; i < entries; i++ {
+		if value, ok := m.MapIndex(serialize.IntValue(int64(i))); !ok || value.Int() != int64(-i) {
+			t.Fatalf("Expected %d under %d, got %v (%v)", -i, i, value.Interface(), ok)
+		}
+	}
+
+	// Setting an existing key replaces its value, and keys of another kind are other keys
+	m.SetMapIndex(serialize.IntValue(3), serialize.StringValue("three"))
+	if value, ok := m.MapIndex(serialize.IntValue(3)); !ok || value.Kind() != types.String || m.Len() != entries {
+		t.Errorf("Expected three under 3, got %v with %d entries", value.Interface(), m.Len())
+	}
+	if _, ok := m.MapIndex(serialize.UintValue(3)); ok {
+		t.Error("Expected UInt 3 to be a different key from SInt 3")
+	}
+
+	// Copies share the index but not the entries added after the copy
+	original := serialize.MapValue()
+	original.SetMapIndex(serialize.StringValue("a"), serialize.IntValue(1))
+	copied := original
+	copied.SetMapIndex(serialize.StringValue("b"), serialize.IntValue(2))
+	original.SetMapIndex(serialize.StringValue("c"), serialize.IntValue(3))
+	if _, ok := original.MapIndex(serialize.StringValue("b")); ok {
+		t.Error("Expected key added to the copy to be missing from the original")
+	}
+	if value, ok := original.MapIndex(serialize.StringValue("c")); !ok || value.Int() != 3 {
+		t.Errorf("Expected 3 under c in the original, got %v (%v)", value.Interface(), ok)
+	}
+	if value, ok := copied.MapIndex(serialize.StringValue("a")); !ok || value.Int() != 1 {
+		t.Errorf("Expected 1 under a in the copy, got %v (%v)", value.Interface(), ok)
+	}
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/utils"
+	"io"
+	"testing"
+)
+
+// countingWriter records how many Write calls reach the underlying writer
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncoderDecoderSequence(t *testing.T) {
+	values := []interface{}{
+		uint64(0xffffffffffffffff),
+		"The quick brown fox jumps over the lazy dog",
+		int64(-0x7fffffffffffffff),
+		true,
+		3.141592653589793,
+		[]int32{1, -2, 300},
+		map[string]string{"key": "value"},
+		exampleStruct{A: 42, B: -7, C: "nested", D: true},
+	}
+
+	var out countingWriter
+	enc := serialize.NewEncoder(&out)
+	for i, value := range values {
+		if err := enc.Encode(value); err != nil {
+			t.Fatalf("Error encoding value %d (%T): %v", i, value, err)
+		}
+	}
+
+	// Nothing should reach the writer until the encoder is flushed
+	if out.writes != 0 {
+		t.Errorf("Expected no writes before Flush, got %d", out.writes)
+	}
+	if enc.Buffered() == 0 {
+		t.Fatal("Expected buffered data before Flush")
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	if out.writes != 1 || enc.Buffered() != 0 {
+		t.Errorf("Expected a single write and empty buffer after Flush, got %d writes and %d buffered", out.writes, enc.Buffered())
+	}
+
+	dec := serialize.NewDecoder(bytes.NewReader(out.Bytes()))
+
+	var u uint64
+	var s string
+	var i int64
+	var b bool
+	var f float64
+	var arr []int32
+	var m map[string]string
+	var st exampleStruct
+	targets := []interface{}{&u, &s, &i, &b, &f, &arr, &m, &st}
+	for idx, target := range targets {
+		if err := dec.Decode(target); err != nil {
+			t.Fatalf("Error decoding value %d: %v", idx, err)
+		}
+	}
+
+	decoded := []interface{}{u, s, i, b, f, arr, m, st}
+	for idx, expected := range values {
+		if !utils.CompareValue(expected, decoded[idx]) {
+			t.Errorf("Value %d: expected %v, got %v", idx, expected, decoded[idx])
+		}
+	}
+
+	// The stream is exhausted, so the next Decode reports a clean EOF
+	var extra int
+	if err := dec.Decode(&extra); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestEncoderFlushesLargeStreams(t *testing.T) {
+	var out countingWriter
+	enc := serialize.NewEncoder(&out)
+
+	const count = 10000
+	for i := 0; i < count; i++ {
+		if err := enc.Encode(int64(i * 1000)); err != nil {
+			t.Fatalf("Error encoding value %d: %v", i, err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	// Writes are batched rather than issued per value or per byte
+	if out.writes == 0 || out.writes >= count/10 {
+		t.Errorf("Expected a small number of batched writes, got %d", out.writes)
+	}
+
+	dec := serialize.NewDecoder(&out)
+	for i := 0; i < count; i++ {
+		var v int64
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Error decoding value %d: %v", i, err)
+		}
+		if v != int64(i*1000) {
+			t.Fatalf("Value %d: expected %d, got %d", i, i*1000, v)
+		}
+	}
+}
+
+func TestEncoderDiscardsFailedValue(t *testing.T) {
+	var out bytes.Buffer
+	enc := serialize.NewEncoder(&out)
+
+	if err := enc.Encode("before"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	buffered := enc.Buffered()
+
+	// A struct whose second field fails leaves a partial value behind unless it is discarded
+	bad := struct {
+		A int
+		B chan int
+	}{A: 1, B: make(chan int)}
+	if err := enc.Encode(bad); err == nil {
+		t.Fatal("Expected error encoding unsupported value")
+	}
+	if enc.Buffered() != buffered {
+		t.Errorf("Expected failed value to be discarded, buffered %d -> %d", buffered, enc.Buffered())
+	}
+
+	if err := enc.Encode("after"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	dec := serialize.NewDecoder(&out)
+	for _, expected := range []string{"before", "after"} {
+		var s string
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("Error decoding %q: %v", expected, err)
+		}
+		if s != expected {
+			t.Errorf("Expected %q, got %q", expected, s)
+		}
+	}
+}
+
+func TestEncoderDecoderReset(t *testing.T) {
+	var first, second bytes.Buffer
+	enc := serialize.NewEncoder(&first)
+
+	if err := enc.Encode("discarded"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+
+	// Reset drops unflushed data and switches the destination
+	enc.Reset(&second)
+	if enc.Buffered() != 0 {
+		t.Errorf("Expected empty buffer after Reset, got %d bytes", enc.Buffered())
+	}
+	if err := enc.Encode("kept"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	if first.Len() != 0 {
+		t.Errorf("Expected nothing written to the first writer, got %d bytes", first.Len())
+	}
+
+	dec := serialize.NewDecoder(bytes.NewReader([]byte{0xff}))
+	dec.Reset(bytes.NewReader(second.Bytes()))
+
+	var s string
+	if err := dec.Decode(&s); err != nil {
+		t.Fatalf("Error decoding after Reset: %v", err)
+	}
+	if s != "kept" {
+		t.Errorf("Expected %q, got %q", "kept", s)
+	}
+	if dec.Buffered() != 0 {
+		t.Errorf("Expected no buffered bytes after decoding the stream, got %d", dec.Buffered())
+	}
+}
@@ -0,0 +1,292 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type zipAddress struct {
+	Street string
+	Zip    int
+}
+
+type directoryUser struct {
+	Name    string
+	Address zipAddress
+}
+
+type directory struct {
+	Users []directoryUser
+}
+
+// textZipAddress has the same shape as zipAddress with the Zip written as text
+type textZipAddress struct {
+	Street string
+	Zip    string
+}
+
+type textDirectoryUser struct {
+	Name    string
+	Address textZipAddress
+}
+
+type textDirectory struct {
+	Users []textDirectoryUser
+}
+
+func TestTypeMismatchErrorPath(t *testing.T) {
+	users := make([]textDirectoryUser, 4)
+	users[3] = textDirectoryUser{Name: "Ada", Address: textZipAddress{Street: "Main", Zip: "N1"}}
+	for i := 0; i < 3; i++ {
+		users[i].Address.Zip = "0"
+	}
+	data, err := serialize.Marshal(textDirectory{Users: users})
+	if err != nil {
+		t.Fatalf("Error marshaling directory: %v", err)
+	}
+
+	// The first three zips are strings too, so the first failure is at index 0
+	var decoded directory
+	err = serialize.Unmarshal(data, &decoded)
+
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+	if mismatch.Path != "Users[0].Address.Zip" {
+		t.Errorf("Expected path Users[0].Address.Zip, got %q", mismatch.Path)
+	}
+	if mismatch.Wire != types.String || mismatch.GoType != reflect.TypeOf(0) {
+		t.Errorf("Expected String into int, got %s into %v", types.TypeName(mismatch.Wire), mismatch.GoType)
+	}
+
+	// The offset is that of the header of the failing zip
+	zip := bytes.Index(data, []byte{types.CreateHeader(types.String, 1), '0'})
+	if mismatch.Offset != int64(zip) {
+		t.Errorf("Expected offset %d, got %d", zip, mismatch.Offset)
+	}
+}
+
+func TestTypeMismatchErrorMapPath(t *testing.T) {
+	data, err := serialize.Marshal(map[string]interface{}{"limit": "high"})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+
+	var decoded map[string]uint16
+	err = serialize.Unmarshal(data, &decoded)
+
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+	if mismatch.Path != `["limit"]` {
+		t.Errorf("Expected path [\"limit\"], got %q", mismatch.Path)
+	}
+}
+
+func TestTypeMismatchErrorTopLevel(t *testing.T) {
+	data, err := serialize.Marshal("text")
+	if err != nil {
+		t.Fatalf("Error marshaling string: %v", err)
+	}
+
+	var decoded exampleStruct
+	err = serialize.Unmarshal(data, &decoded)
+
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+	if mismatch.Path != "" || mismatch.Offset != 0 || mismatch.GoType != reflect.TypeOf(decoded) {
+		t.Errorf("Expected mismatch into exampleStruct at offset 0, got %+v", mismatch)
+	}
+}
+
+func TestTypeMismatchErrorStructFieldCount(t *testing.T) {
+	// The address is encoded with four fields but decoded into a struct with two
+	data, err := serialize.Marshal(struct {
+		Name    string
+		Address exampleStruct
+	}{Name: "Ada"})
+	if err != nil {
+		t.Fatalf("Error marshaling user: %v", err)
+	}
+
+	var decoded directoryUser
+	err = serialize.Unmarshal(data, &decoded)
+
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+	address := bytes.IndexByte(data, types.CreateHeader(types.Struct, 4))
+	if mismatch.Path != "Address" || mismatch.Wire != types.Struct || mismatch.GoType != reflect.TypeOf(zipAddress{}) || mismatch.Offset != int64(address) {
+		t.Errorf("Expected Struct into zipAddress at Address (offset %d), got %+v", address, mismatch)
+	}
+}
+
+// mislabeledArray returns an array of one element whose declared element type is not that of the element
+func mislabeledArray(elementType types.Types, element ...byte) []byte {
+	return append([]byte{types.CreateHeader(types.Array, 1), byte(elementType)}, element...)
+}
+
+func TestTypeMismatchErrorLowLevel(t *testing.T) {
+	text := []byte{types.CreateHeader(types.String, 1), 'x'}
+	tests := []struct {
+		name   string
+		data   []byte
+		out    interface{}
+		wire   types.Types
+		goType reflect.Type
+		offset int64
+	}{
+		{"string element into int64", mislabeledArray(types.SInt, text...), new([]int64), types.String, reflect.TypeOf(int64(0)), 2},
+		{"string element into uint64", mislabeledArray(types.UInt, text...), new([]uint64), types.String, reflect.TypeOf(uint64(0)), 2},
+		{"string element into float64", mislabeledArray(types.Float, text...), new([]float64), types.String, reflect.TypeOf(float64(0)), 2},
+		{"int element into complex128", mislabeledArray(types.Complex, 0x01), new([]complex128), types.UNibble, reflect.TypeOf(complex128(0)), 2},
+		{"int element into string", mislabeledArray(types.String, 0x01), new([]string), types.UNibble, reflect.TypeOf(""), 2},
+		{"string into int slice", text, new([]int), types.String, reflect.TypeOf([]int{}), 0},
+		{"string into bool slice", text, new([]bool), types.String, reflect.TypeOf([]bool{}), 0},
+		{"string into map", text, new(map[string]int), types.String, reflect.TypeOf(map[string]int{}), 0},
+		{"string into generic map", text, new(map[uint8]int), types.String, reflect.TypeOf(map[uint8]int{}), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := serialize.Unmarshal(tt.data, tt.out)
+
+			var mismatch *serialize.TypeMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Expected *TypeMismatchError, got %v", err)
+			}
+			if mismatch.Wire != tt.wire || mismatch.GoType != tt.goType {
+				t.Errorf("Expected %s into %v, got %s into %v", types.TypeName(tt.wire), tt.goType, types.TypeName(mismatch.Wire), mismatch.GoType)
+			}
+			if mismatch.Offset != tt.offset {
+				t.Errorf("Expected offset %d, got %d", tt.offset, mismatch.Offset)
+			}
+		})
+	}
+}
+
+func TestTruncatedError(t *testing.T) {
+	data, err := serialize.Marshal(directory{Users: []directoryUser{{Name: "Grace", Address: zipAddress{Street: "Elm", Zip: 12345}}}})
+	if err != nil {
+		t.Fatalf("Error marshaling directory: %v", err)
+	}
+
+	for cut := 1; cut < len(data); cut++ {
+		var decoded directory
+		err := serialize.Unmarshal(data[:cut], &decoded)
+
+		var truncated *serialize.TruncatedError
+		if !errors.As(err, &truncated) {
+			t.Fatalf("Cut at %d: expected *TruncatedError, got %v", cut, err)
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Cut at %d: expected error to match io.ErrUnexpectedEOF", cut)
+		}
+		if truncated.Offset > int64(cut) {
+			t.Errorf("Cut at %d: offset %d is beyond the input", cut, truncated.Offset)
+		}
+	}
+
+	// The last byte belongs to the zip code
+	var decoded directory
+	var truncated *serialize.TruncatedError
+	if err := serialize.Unmarshal(data[:len(data)-1], &decoded); !errors.As(err, &truncated) || truncated.Path != "Users[0].Address.Zip" {
+		t.Errorf("Expected truncation at Users[0].Address.Zip, got %v", err)
+	}
+
+	// A clean end of stream is still a bare io.EOF
+	if err := serialize.Deserialize(bytes.NewReader(nil), &decoded); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestUnsupportedTypeError(t *testing.T) {
+	t.Run("wire type", func(t *testing.T) {
+		var decoded interface{}
+		err := serialize.Unmarshal([]byte{0xf0}, &decoded)
+
+		var unsupported *serialize.UnsupportedTypeError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("Expected *UnsupportedTypeError, got %v", err)
+		}
+		if unsupported.GoType != nil || unsupported.Wire != types.Types(15) {
+			t.Errorf("Expected unsupported wire type 15, got %+v", unsupported)
+		}
+	})
+
+	t.Run("Go type", func(t *testing.T) {
+		data, err := serialize.Marshal(1)
+		if err != nil {
+			t.Fatalf("Error marshaling int: %v", err)
+		}
+		var decoded struct{ Ch chan int }
+		err = serialize.Unmarshal(append([]byte{types.CreateHeader(types.Struct, 1)}, data...), &decoded)
+
+		var unsupported *serialize.UnsupportedTypeError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("Expected *UnsupportedTypeError, got %v", err)
+		}
+		if unsupported.GoType != reflect.TypeOf(decoded.Ch) || unsupported.Path != "Ch" {
+			t.Errorf("Expected unsupported chan int at Ch, got %+v", unsupported)
+		}
+	})
+}
+
+func TestLimitErrorPath(t *testing.T) {
+	data, err := serialize.Marshal(directory{Users: []directoryUser{{Name: "a very long name"}}})
+	if err != nil {
+		t.Fatalf("Error marshaling directory: %v", err)
+	}
+
+	var decoded directory
+	err = serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxBytes: 8})
+
+	var limitErr *serialize.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected *LimitError, got %v", err)
+	}
+	if limitErr.Path != "Users[0].Name" || limitErr.Offset == 0 {
+		t.Errorf("Expected limit error at Users[0].Name with an offset, got %+v", limitErr)
+	}
+}
+
+func TestDecoderErrorOffset(t *testing.T) {
+	var stream bytes.Buffer
+	enc := serialize.NewEncoder(&stream)
+	if err := enc.Encode("first"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	if err := enc.Encode("second"); err != nil {
+		t.Fatalf("Error encoding value: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	// Offsets count from the start of the stream, not the start of the value
+	dec := serialize.NewDecoder(&stream)
+	var s string
+	if err := dec.Decode(&s); err != nil {
+		t.Fatalf("Error decoding first value: %v", err)
+	}
+	var n int
+	err := dec.Decode(&n)
+
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+	if mismatch.Offset != 6 {
+		t.Errorf("Expected offset 6, got %d", mismatch.Offset)
+	}
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"math"
+	"testing"
+)
+
+// marshalHalf encodes value with an Encoder that writes half precision floats
+func marshalHalf(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := serialize.NewEncoder(&buf)
+	encoder.SetHalfPrecision(true)
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Error encoding %v: %v", value, err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFloatRoundTripAndSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		size     int
+		halfSize int // Size with half precision enabled
+	}{
+		{"zero", 0, 1, 1},
+		{"negative zero", math.Copysign(0, -1), 1, 1},
+		{"NaN", math.NaN(), 1, 1},
+		{"positive infinity", math.Inf(1), 1, 1},
+		{"negative infinity", math.Inf(-1), 1, 1},
+		{"minus one", -1, 1, 1},
+		{"one", 1, 1, 1},
+		{"seven", 7, 1, 1},
+		{"eight", 8, 5, 3},
+		{"half", 0.5, 5, 3},
+		{"negative small", -2.25, 5, 3},
+		{"largest half", 65504, 5, 3},
+		{"smallest half subnormal", math.Ldexp(1, -24), 5, 3},
+		{"half subnormal", math.Ldexp(3, -20), 5, 3},
+		{"beyond half", 65505, 5, 5},
+		{"float32 precision", float64(float32(0.1)), 5, 5},
+		{"float64 precision", 0.1, 9, 9},
+		{"negative float64 precision", -0.1, 9, 9},
+		{"large float32", float64(float32(1e30)), 5, 5},
+		{"large float64", 1e300, 9, 9},
+		{"smallest float64", math.SmallestNonzeroFloat64, 9, 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling %v: %v", tt.value, err)
+			}
+			if len(data) != tt.size {
+				t.Errorf("Expected %v to take %d bytes, got %d (%x)", tt.value, tt.size, len(data), data)
+			}
+			half := marshalHalf(t, tt.value)
+			if len(half) != tt.halfSize {
+				t.Errorf("Expected %v to take %d bytes in half precision, got %d (%x)", tt.value, tt.halfSize, len(half), half)
+			}
+
+			for _, encoded := range [][]byte{data, half} {
+				var decoded float64
+				if err := serialize.Unmarshal(encoded, &decoded); err != nil {
+					t.Fatalf("Error unmarshaling %v: %v", tt.value, err)
+				}
+				if math.IsNaN(tt.value) {
+					if !math.IsNaN(decoded) {
+						t.Errorf("Expected NaN, got %v", decoded)
+					}
+					continue
+				}
+				if decoded != tt.value || math.Signbit(decoded) != math.Signbit(tt.value) {
+					t.Errorf("Expected %v, got %v", tt.value, decoded)
+				}
+
+				size, err := serialize.SkipValueBytes(encoded)
+				if err != nil || size != len(encoded) {
+					t.Errorf("Expected to skip %d bytes, got %d (%v)", len(encoded), size, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFloatHalfPrecisionOption(t *testing.T) {
+	// Half precision is never written unless the encoder asks for it
+	values := []float64{0.5, 1.5, -2.25, 1024, 0.125}
+	data, err := serialize.Marshal(values)
+	if err != nil {
+		t.Fatalf("Error marshaling floats: %v", err)
+	}
+	if bytes.Contains(data, []byte{types.CreateHeader(types.Float, types.FloatHalf)}) {
+		t.Errorf("Expected no half precision floats by default, got %x", data)
+	}
+
+	// Three bytes each in half precision are smaller than a packed array of float32
+	half := marshalHalf(t, values)
+	if len(half) >= len(data) {
+		t.Errorf("Expected half precision to be smaller than %d bytes, got %d (%x)", len(data), len(half), half)
+	}
+	var decoded []float64
+	if err := serialize.Unmarshal(half, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling half precision floats: %v", err)
+	}
+	for i, value := range values {
+		if decoded[i] != value {
+			t.Errorf("Expected %v at %d, got %v", value, i, decoded[i])
+		}
+	}
+
+	// Canonical form is the default encoding, without half precision
+	if serialize.IsCanonical(half) {
+		t.Errorf("Expected half precision floats not to be canonical")
+	}
+	canonical, err := serialize.Canonicalize(half)
+	if err != nil || !bytes.Equal(canonical, data) {
+		t.Errorf("Expected %x, got %x (%v)", data, canonical, err)
+	}
+}
+
+func TestFloatHalfPrecisionIsExact(t *testing.T) {
+	// With half precision enabled, every value with an 11 bit significand in its range takes three bytes and round trips
+	for exp := -24; exp <= 5; exp++ {
+		for mantissa := 1024; mantissa < 2048; mantissa += 37 {
+			value := math.Ldexp(float64(mantissa), exp)
+			if value < math.Ldexp(1, -24) || value > 65504 || (value == math.Trunc(value) && value <= 7) {
+				continue
+			}
+			data := marshalHalf(t, value)
+			var decoded float64
+			if err := serialize.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling %v: %v", value, err)
+			}
+			if decoded != value {
+				t.Fatalf("Expected %v, got %v", value, decoded)
+			}
+			if exp >= -14 && len(data) != 3 {
+				t.Fatalf("Expected %v to take 3 bytes, got %d", value, len(data))
+			}
+		}
+	}
+}
+
+func TestFloat32Compact(t *testing.T) {
+	values := []float32{0, 3, -1, 0.25, 0.1, math.MaxFloat32, float32(math.Inf(-1))}
+	for _, value := range values {
+		data, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling %v: %v", value, err)
+		}
+		var decoded float32
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %v: %v", value, err)
+		}
+		if decoded != value {
+			t.Errorf("Expected %v, got %v", value, decoded)
+		}
+	}
+}
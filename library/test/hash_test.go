@@ -0,0 +1,169 @@
+package test
+
+import (
+	"crypto/sha256"
+	"ebe/serialize"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"testing"
+	"time"
+)
+
+type hashedDocument struct {
+	ID     uint64
+	Labels map[string]string
+	Rows   []map[int]float64
+}
+
+func newHashedDocument(reverse bool) hashedDocument {
+	doc := hashedDocument{ID: 7, Labels: make(map[string]string)}
+	for i := 0; i < 500; i++ {
+		j := i
+		if reverse {
+			j = 499 - i
+		}
+		doc.Labels[string(rune('a'+j%26))+string(rune('a'+j/26))] = "label"
+	}
+	for i := 0; i < 20; i++ {
+		row := make(map[int]float64)
+		for k := 0; k < 40; k++ {
+			row[k*k] = float64(k) / 3
+		}
+		doc.Rows = append(doc.Rows, row)
+	}
+	return doc
+}
+
+func TestSum256StructurallyEqualValues(t *testing.T) {
+	first, err := serialize.Sum256(newHashedDocument(false))
+	if err != nil {
+		t.Fatalf("Error hashing document: %v", err)
+	}
+	second, err := serialize.Sum256(newHashedDocument(true))
+	if err != nil {
+		t.Fatalf("Error hashing document: %v", err)
+	}
+	if first != second {
+		t.Errorf("Expected equal documents to hash the same")
+	}
+
+	changed := newHashedDocument(false)
+	changed.Rows[19][0] = 1
+	third, err := serialize.Sum256(changed)
+	if err != nil {
+		t.Fatalf("Error hashing document: %v", err)
+	}
+	if first == third {
+		t.Errorf("Expected different documents to hash differently")
+	}
+}
+
+func TestSum256MatchesCanonicalEncoding(t *testing.T) {
+	values := []interface{}{
+		newHashedDocument(false),
+		map[string]interface{}{"b": []int{1, 2, 3}, "a": nil},
+		largeUints(3000),
+		"text",
+		struct{}{},
+		newCanonicalRecord(),
+		newLogRecords(500),
+		newDeltaSeries(100),
+		accountV2{ID: 1, Tags: []string{"x"}, Limits: map[string]int{"b": 2, "a": 1}},
+		taggedOptional{ID: 3, Scores: []int{1, 2}},
+		taggedExportedInline{AuditFields: AuditFields{CreatedBy: "ada", Version: 2}, Name: "inline"},
+		drawing{Title: "shapes", Main: circle{Radius: math.NaN()}, Shapes: []shape{&square{Side: 2}, nil}},
+		[]interface{}{1, "two", nil, math.NaN(), []string{"x"}, json.RawMessage(nil), money{cents: 5}},
+		[]complex128{complex(math.NaN(), 1), 2},
+		[]*exampleStruct{{A: 1, C: "first"}, nil},
+		map[float64][]time.Duration{math.NaN(): {time.Second}, 1.5: nil},
+	}
+
+	for _, value := range values {
+		data, err := serialize.MarshalCanonical(value)
+		if err != nil {
+			t.Fatalf("Error marshaling %T: %v", value, err)
+		}
+		sum, err := serialize.Sum256(value)
+		if err != nil {
+			t.Fatalf("Error hashing %T: %v", value, err)
+		}
+		if sum != sha256.Sum256(data) {
+			t.Errorf("Sum256 of %T does not match the digest of its canonical encoding", value)
+		}
+	}
+}
+
+func TestHashWithOtherHashes(t *testing.T) {
+	a, b := fnv.New64a(), fnv.New64a()
+	if err := serialize.Hash(map[int]string{1: "one", 2: "two", 3: "three"}, a); err != nil {
+		t.Fatalf("Error hashing map: %v", err)
+	}
+	if err := serialize.Hash(map[int]string{3: "three", 2: "two", 1: "one"}, b); err != nil {
+		t.Fatalf("Error hashing map: %v", err)
+	}
+	if a.Sum64() != b.Sum64() {
+		t.Errorf("Expected equal maps to hash the same")
+	}
+
+	if err := serialize.Hash(make(chan int), fnv.New64a()); err == nil {
+		t.Errorf("Expected an error hashing an unsupported type")
+	}
+}
+
+// largeUints returns values whose encoding is larger than the chunks Hash writes
+func largeUints(n int) []uint64 {
+	values := make([]uint64, n)
+	for i := range values {
+		values[i] = uint64(i) * 1e9
+	}
+	return values
+}
+
+// countingHash is a hash.Hash that only counts what is written to it, and the size of the largest write
+type countingHash struct {
+	written, largest int
+}
+
+func (h *countingHash) Write(p []byte) (int, error) {
+	h.written += len(p)
+	h.largest = max(h.largest, len(p))
+	return len(p), nil
+}
+
+func (h *countingHash) Sum(b []byte) []byte { return b }
+func (h *countingHash) Reset()              { *h = countingHash{} }
+func (h *countingHash) Size() int           { return 0 }
+func (h *countingHash) BlockSize() int      { return 1 }
+
+func TestHashStreamsLargeValues(t *testing.T) {
+	small, large := newLogRecords(100), newLogRecords(20000)
+	data, err := serialize.MarshalCanonical(large)
+	if err != nil {
+		t.Fatalf("Error marshaling records: %v", err)
+	}
+
+	// The encoding reaches the hash in small chunks rather than in one write
+	var h countingHash
+	if err := serialize.Hash(large, &h); err != nil {
+		t.Fatalf("Error hashing records: %v", err)
+	}
+	if h.written != len(data) {
+		t.Errorf("Expected %d bytes written, got %d", len(data), h.written)
+	}
+	if h.largest > 8192 {
+		t.Errorf("Expected writes of at most 8192 bytes of the %d byte encoding, got one of %d", len(data), h.largest)
+	}
+
+	// Walking the records allocates nothing per record, so a large value allocates no more than a small one
+	allocs := func(value interface{}) float64 {
+		return testing.AllocsPerRun(10, func() {
+			if err := serialize.Hash(value, &countingHash{}); err != nil {
+				t.Fatalf("Error hashing records: %v", err)
+			}
+		})
+	}
+	if smallAllocs, largeAllocs := allocs(small), allocs(large); largeAllocs > smallAllocs {
+		t.Errorf("Expected hashing 20000 records to allocate as often as 100, got %v and %v allocations", largeAllocs, smallAllocs)
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"ebe/serialize"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type envelope struct {
+	Kind    string
+	Payload interface{}
+}
+
+func TestInterfaceScalars(t *testing.T) {
+	instant := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		input    interface{}
+		expected interface{}
+	}{
+		{"unsigned nibble", uint8(3), uint64(3)},
+		{"unsigned", uint32(70000), uint64(70000)},
+		{"signed nibble", -3, int64(-3)},
+		{"signed", int64(-1 << 40), int64(-1 << 40)},
+		{"float", 2.5, 2.5},
+		{"complex", complex(1, -1), complex(1, -1)},
+		{"bool", true, true},
+		{"string", "hello", "hello"},
+		{"buffer", []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"null", nil, nil},
+		{"time", instant, instant},
+		{"duration", 3 * time.Second, 3 * time.Second},
+		{"json", json.RawMessage(`{"a":[1,"b"]}`), map[string]interface{}{"a": []interface{}{1.0, "b"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling %v: %v", tc.input, err)
+			}
+
+			var decoded interface{} = "stale"
+			if err := serialize.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling into interface{}: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tc.expected) {
+				t.Errorf("Expected %T %v, got %T %v", tc.expected, tc.expected, decoded, decoded)
+			}
+		})
+	}
+}
+
+func TestInterfaceTree(t *testing.T) {
+	original := map[string]interface{}{
+		"name":  "service",
+		"ports": []int{80, 443},
+		"owner": map[string]interface{}{
+			"team":    "platform",
+			"members": []string{"ada", "grace"},
+			"oncall":  nil,
+		},
+		"limits": map[string]int{"cpu": 4},
+		"matrix": [][]float64{{1, 2}, {3}},
+		"ids":    map[int]string{1: "one", -2: "minus two"},
+		"point":  exampleStruct{A: 1, B: -2, C: "c", D: true},
+		"tagged": accountV1{ID: 9, Name: "n", Email: "e"},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling tree: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"name":  "service",
+		"ports": []interface{}{int64(80), int64(443)},
+		"owner": map[string]interface{}{
+			"team":    "platform",
+			"members": []interface{}{"ada", "grace"},
+			"oncall":  nil,
+		},
+		"limits": map[string]interface{}{"cpu": int64(4)},
+		"matrix": []interface{}{[]interface{}{1.0, 2.0}, []interface{}{3.0}},
+		"ids":    map[interface{}]interface{}{int64(1): "one", int64(-2): "minus two"},
+		"point":  []interface{}{uint64(1), int64(-2), "c", true},
+		"tagged": map[uint64]interface{}{1: uint64(9), 2: "n", 3: "e"},
+	}
+
+	// Decoding into interface{} and into map[string]interface{} build the same tree
+	var decoded interface{}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling tree into interface{}: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %v, got %v", expected, decoded)
+	}
+
+	var decodedMap map[string]interface{}
+	if err := serialize.Unmarshal(data, &decodedMap); err != nil {
+		t.Fatalf("Error unmarshaling tree into map: %v", err)
+	}
+	if !reflect.DeepEqual(decodedMap, expected) {
+		t.Errorf("Expected %v, got %v", expected, decodedMap)
+	}
+}
+
+func TestInterfaceStructField(t *testing.T) {
+	original := envelope{Kind: "batch", Payload: map[string]interface{}{"count": 2, "items": []string{"x", "y"}}}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling envelope: %v", err)
+	}
+
+	var decoded envelope
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling envelope: %v", err)
+	}
+	expected := envelope{Kind: "batch", Payload: map[string]interface{}{"count": int64(2), "items": []interface{}{"x", "y"}}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, decoded)
+	}
+}
+
+func TestInterfaceUnhashableKey(t *testing.T) {
+	data, err := serialize.Marshal(map[[2]int]string{{1, 2}: "pair"})
+	if err != nil {
+		t.Fatalf("Error marshaling array-keyed map: %v", err)
+	}
+
+	// Array keys decode to []interface{}, which cannot key a Go map
+	var decoded interface{}
+	if err := serialize.Unmarshal(data, &decoded); err == nil {
+		t.Errorf("Expected error for unhashable map key, got %v", decoded)
+	}
+}
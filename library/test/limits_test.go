@@ -0,0 +1,220 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// unsizedReader hides the size of the input, as a network connection would
+type unsizedReader struct {
+	r io.Reader
+}
+
+func (u unsizedReader) Read(p []byte) (int, error) {
+	return u.r.Read(p)
+}
+
+// nestedArrays returns depth arrays nested inside each other around an empty array
+func nestedArrays(depth int) []byte {
+	var data []byte
+	for i := 0; i < depth; i++ {
+		data = append(data, types.CreateHeader(types.Array, 1), byte(types.Array))
+	}
+	return append(data, types.CreateHeader(types.Array, 0), byte(types.SInt))
+}
+
+func expectLimitError(t *testing.T, err error, limit string) {
+	t.Helper()
+	var limitErr *serialize.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected *LimitError for %s, got %v", limit, err)
+	}
+	if limitErr.Limit != limit {
+		t.Errorf("Expected %s to be exceeded, got %v", limit, limitErr)
+	}
+}
+
+func TestLimitsHostileLengthWithoutLimits(t *testing.T) {
+	// A String claiming 2^56 bytes is rejected before allocating, since the input is much shorter
+	data := []byte{types.CreateHeader(types.String, 8), types.CreateHeader(types.UInt, 8), 1, 0, 0, 0, 0, 0, 0, 0, 'a'}
+	var s string
+	err := serialize.Unmarshal(data, &s)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for oversized string, got %v", err)
+	}
+
+	data[0] = types.CreateHeader(types.Buffer, 8)
+	var b []byte
+	if err := serialize.Unmarshal(data, &b); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for oversized buffer, got %v", err)
+	}
+}
+
+func TestLimitsHostileCountWithoutLimits(t *testing.T) {
+	// 2^36 elements are declared in front of a single byte, and rejected before anything is allocated for them
+	count := []byte{types.CreateHeader(types.UInt, 5), 0x10, 0, 0, 0, 0}
+	payloads := map[string][]byte{
+		"array":        append(append([]byte{types.CreateHeader(types.Array, 8)}, count...), byte(types.SInt), 0x10),
+		"struct array": append(append([]byte{types.CreateHeader(types.Array, 8)}, count...), byte(types.Struct), 0x10),
+		"varint array": append(append([]byte{types.CreateHeader(types.Array, types.ArrayPacked)}, count...), byte(types.SInt), types.PackedVarint, 0x10),
+		"packed array": append(append([]byte{types.CreateHeader(types.Array, types.ArrayPacked)}, count...), byte(types.SInt), 8, 0x10),
+		"map":          append(append([]byte{types.CreateHeader(types.Map, 8)}, count...), 0x10),
+		"struct":       append(append([]byte{types.CreateHeader(types.Struct, 8)}, count...), 0x10),
+	}
+	targets := map[string]func() interface{}{
+		"[]int64":         func() interface{} { return new([]int64) },
+		"[]interface{}":   func() interface{} { return new([]interface{}) },
+		"interface{}":     func() interface{} { return new(interface{}) },
+		"[][]int":         func() interface{} { return new([][]int) },
+		"map[string]int":  func() interface{} { return new(map[string]int) },
+		"exampleStruct":   func() interface{} { return new(exampleStruct) },
+		"[]exampleStruct": func() interface{} { return new([]exampleStruct) },
+		"serialize.Value": func() interface{} { return new(serialize.Value) },
+	}
+
+	for name, data := range payloads {
+		for target, out := range targets {
+			t.Run(name+" into "+target, func(t *testing.T) {
+				err := serialize.Unmarshal(data, out())
+				if err == nil {
+					t.Fatal("Expected an error for the declared count, got nil")
+				}
+				var truncated *serialize.TruncatedError
+				var mismatch *serialize.TypeMismatchError
+				if !errors.As(err, &truncated) && !errors.As(err, &mismatch) {
+					t.Errorf("Expected *TruncatedError or *TypeMismatchError, got %v", err)
+				}
+			})
+		}
+	}
+
+	// Where the target accepts the payload, the only possible failure is the truncation
+	for name, target := range map[string]interface{}{"[]int64": new([]int64), "[]interface{}": new([]interface{}),
+		"interface{}": new(interface{}), "[][]int": new([][]int), "serialize.Value": new(serialize.Value)} {
+		var truncated *serialize.TruncatedError
+		if err := serialize.Unmarshal(payloads["array"], target); !errors.As(err, &truncated) {
+			t.Errorf("Expected *TruncatedError decoding array into %s, got %v", name, err)
+		}
+	}
+}
+
+func TestLimitsMaxBytes(t *testing.T) {
+	data, err := serialize.Marshal(strings.Repeat("x", 100))
+	if err != nil {
+		t.Fatalf("Error marshaling string: %v", err)
+	}
+
+	var s string
+	err = serialize.DeserializeWithLimits(unsizedReader{bytes.NewReader(data)}, &s, serialize.Limits{MaxBytes: 99})
+	expectLimitError(t, err, "MaxBytes")
+
+	if err := serialize.UnmarshalWithLimits(data, &s, serialize.Limits{MaxBytes: 100}); err != nil || len(s) != 100 {
+		t.Errorf("Expected string within limit to decode, got %d bytes (%v)", len(s), err)
+	}
+}
+
+func TestLimitsMaxLength(t *testing.T) {
+	values := map[string]interface{}{
+		"array":  make([]int, 20),
+		"map":    map[int]int{1: 1, 2: 2, 3: 3},
+		"struct": exampleStruct{},
+	}
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			data, err := serialize.Marshal(value)
+			if err != nil {
+				t.Fatalf("Error marshaling %T: %v", value, err)
+			}
+			var decoded interface{}
+			err = serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxLength: 2})
+			expectLimitError(t, err, "MaxLength")
+		})
+	}
+
+	// A hostile array length fails before the slice is made
+	data := []byte{types.CreateHeader(types.Array, 8), types.CreateHeader(types.UInt, 8), 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, byte(types.SInt)}
+	var ints []int
+	err := serialize.UnmarshalWithLimits(data, &ints, serialize.Limits{MaxLength: 1 << 20})
+	expectLimitError(t, err, "MaxLength")
+}
+
+func TestLimitsMaxDepth(t *testing.T) {
+	data := nestedArrays(3)
+
+	var decoded [][][][]int
+	if err := serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxDepth: 4}); err != nil {
+		t.Fatalf("Expected nesting within limit to decode, got %v", err)
+	}
+	err := serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxDepth: 3})
+	expectLimitError(t, err, "MaxDepth")
+
+	// Deep hostile input is rejected whichever way it is decoded
+	hostile := nestedArrays(100000)
+	var dynamic interface{}
+	err = serialize.UnmarshalWithLimits(hostile, &dynamic, serialize.Limits{MaxDepth: 64})
+	expectLimitError(t, err, "MaxDepth")
+
+	var doc serialize.Value
+	err = serialize.UnmarshalWithLimits(hostile, &doc, serialize.Limits{MaxDepth: 64})
+	expectLimitError(t, err, "MaxDepth")
+}
+
+func TestLimitsMaxAllocation(t *testing.T) {
+	data, err := serialize.Marshal(make([]int64, 1000))
+	if err != nil {
+		t.Fatalf("Error marshaling slice: %v", err)
+	}
+
+	var decoded []int64
+	err = serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxAllocation: 7999})
+	expectLimitError(t, err, "MaxAllocation")
+	if decoded != nil {
+		t.Errorf("Expected nothing to be allocated, got %d elements", len(decoded))
+	}
+
+	if err := serialize.UnmarshalWithLimits(data, &decoded, serialize.Limits{MaxAllocation: 8000}); err != nil {
+		t.Errorf("Expected slice within limit to decode, got %v", err)
+	}
+
+	// Strings count towards the same total
+	data, err = serialize.Marshal([]string{strings.Repeat("a", 600), strings.Repeat("b", 600)})
+	if err != nil {
+		t.Fatalf("Error marshaling strings: %v", err)
+	}
+	var strs []string
+	err = serialize.UnmarshalWithLimits(data, &strs, serialize.Limits{MaxAllocation: 1000})
+	expectLimitError(t, err, "MaxAllocation")
+}
+
+func TestDecoderLimits(t *testing.T) {
+	var stream bytes.Buffer
+	enc := serialize.NewEncoder(&stream)
+	for i := 0; i < 5; i++ {
+		if err := enc.Encode(strings.Repeat("x", 50)); err != nil {
+			t.Fatalf("Error encoding value %d: %v", i, err)
+		}
+	}
+	if err := enc.Encode(strings.Repeat("x", 500)); err != nil {
+		t.Fatalf("Error encoding large value: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	// The allocation limit applies to each value, not to the stream as a whole
+	dec := serialize.NewDecoder(&stream)
+	dec.SetLimits(serialize.Limits{MaxAllocation: 100})
+	for i := 0; i < 5; i++ {
+		var s string
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("Error decoding value %d: %v", i, err)
+		}
+	}
+	var s string
+	expectLimitError(t, dec.Decode(&s), "MaxAllocation")
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/utils"
+	"testing"
+)
+
+func TestMarshalMatchesSerialize(t *testing.T) {
+	values := []interface{}{
+		uint64(0xffffffffffffffff),
+		int64(-123456),
+		3.5,
+		"The quick brown fox jumps over the lazy dog",
+		[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		[]int{1, -2, 3000},
+		[]string{"a", "bb", "ccc"},
+		map[string]int{"one": 1},
+		exampleStruct{A: 1, B: -2, C: "three", D: true},
+	}
+
+	for i, value := range values {
+		var buf bytes.Buffer
+		if err := serialize.Serialize(value, &buf); err != nil {
+			t.Fatalf("Error serializing value %d (%T): %v", i, value, err)
+		}
+
+		data, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling value %d (%T): %v", i, value, err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("Value %d (%T): Marshal produced [% x], Serialize produced [% x]", i, value, data, buf.Bytes())
+		}
+	}
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	original := exampleStruct{A: 200, B: -300, C: "round trip", D: true}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	var decoded exampleStruct
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling struct: %v", err)
+	}
+
+	if !utils.CompareValue(original, decoded) {
+		t.Errorf("Round trip mismatch: expected %+v, got %+v", original, decoded)
+	}
+}
+
+func TestUnmarshalRejectsTrailingData(t *testing.T) {
+	data, err := serialize.Marshal("value")
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+	data = append(data, 0x01)
+
+	var out string
+	if err := serialize.Unmarshal(data, &out); err == nil {
+		t.Error("Expected error when unmarshaling data with trailing bytes, got nil")
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	prefix := []byte{0xAA, 0xBB}
+
+	data, err := serialize.AppendValue(prefix, "appended")
+	if err != nil {
+		t.Fatalf("Error appending value: %v", err)
+	}
+	if !bytes.Equal(data[:2], prefix) {
+		t.Fatalf("Expected prefix to be preserved, got [% x]", data[:2])
+	}
+
+	var out string
+	if err := serialize.Unmarshal(data[2:], &out); err != nil {
+		t.Fatalf("Error unmarshaling appended value: %v", err)
+	}
+	if out != "appended" {
+		t.Errorf("Expected %q, got %q", "appended", out)
+	}
+
+	// A failed append leaves the destination at its original length
+	failed, err := serialize.AppendValue(data, make(chan int))
+	if err == nil {
+		t.Fatal("Expected error appending unsupported value")
+	}
+	if len(failed) != len(data) {
+		t.Errorf("Expected length %d after failed append, got %d", len(data), len(failed))
+	}
+}
+
+func TestAppendValueAllocationFree(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value interface{}
+	}{
+		{"uint64", uint64(0xffffffff)},
+		{"int64", int64(-1234567)},
+		{"float64", 2.75},
+		{"bool", true},
+		{"string", "allocation free string"},
+		{"[]byte", []byte("allocation free buffer")},
+		{"[]int", []int{1, 2, 3, 400, 50000}},
+		{"[]uint32", []uint32{1, 2, 3, 400, 50000}},
+		{"[]float64", []float64{1.5, 2.5, 3.5}},
+		{"[]string", []string{"a", "b", "c"}},
+		{"[]bool", []bool{true, false, true}},
+		{"map[string]int", map[string]int{"a": 1, "b": 2}},
+		{"map[string]string", map[string]string{"a": "x", "b": "y"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := make([]byte, 0, 1024)
+			allocs := testing.AllocsPerRun(100, func() {
+				var err error
+				buf, err = serialize.AppendValue(buf[:0], tc.value)
+				if err != nil {
+					t.Fatalf("Error appending %s: %v", tc.name, err)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("Expected no allocations appending %s, got %.1f", tc.name, allocs)
+			}
+		})
+	}
+}
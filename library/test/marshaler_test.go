@@ -0,0 +1,224 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// money is stored as integer cents, so it encodes as a single SInt
+type money struct {
+	cents int64
+}
+
+func (m money) MarshalEBE(dst []byte) ([]byte, error) {
+	return serialize.AppendValue(dst, m.cents)
+}
+
+func (m *money) UnmarshalEBE(r io.Reader, header byte) error {
+	return serialize.DeserializeWithHeader(r, header, &m.cents)
+}
+
+// geoPoint encodes as a packed 8-byte buffer of two float32 values (pointer receivers)
+type geoPoint struct {
+	lat, lng float32
+}
+
+func (g *geoPoint) MarshalEBE(dst []byte) ([]byte, error) {
+	var packed [8]byte
+	lat := math.Float32bits(g.lat)
+	lng := math.Float32bits(g.lng)
+	for i := 0; i < 4; i++ {
+		packed[i] = byte(lat >> (8 * i))
+		packed[4+i] = byte(lng >> (8 * i))
+	}
+	return serialize.AppendValue(dst, packed[:])
+}
+
+func (g *geoPoint) UnmarshalEBE(r io.Reader, header byte) error {
+	var packed []byte
+	if err := serialize.DeserializeWithHeader(r, header, &packed); err != nil {
+		return err
+	}
+	if len(packed) != 8 {
+		return fmt.Errorf("expected 8 bytes for geoPoint, got %d", len(packed))
+	}
+	var lat, lng uint32
+	for i := 0; i < 4; i++ {
+		lat |= uint32(packed[i]) << (8 * i)
+		lng |= uint32(packed[4+i]) << (8 * i)
+	}
+	g.lat = math.Float32frombits(lat)
+	g.lng = math.Float32frombits(lng)
+	return nil
+}
+
+// userID is a named integer with a custom string representation
+type userID uint64
+
+func (id userID) MarshalEBE(dst []byte) ([]byte, error) {
+	return serialize.AppendValue(dst, fmt.Sprintf("user-%d", uint64(id)))
+}
+
+func (id *userID) UnmarshalEBE(r io.Reader, header byte) error {
+	var s string
+	if err := serialize.DeserializeWithHeader(r, header, &s); err != nil {
+		return err
+	}
+	var n uint64
+	if _, err := fmt.Sscanf(s, "user-%d", &n); err != nil {
+		return fmt.Errorf("invalid user id %q: %w", s, err)
+	}
+	*id = userID(n)
+	return nil
+}
+
+// failingMarshaler always fails to encode itself
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalEBE(dst []byte) ([]byte, error) {
+	return dst, fmt.Errorf("refusing to marshal")
+}
+
+type order struct {
+	ID       userID
+	Total    money
+	Location geoPoint
+	Stops    []geoPoint
+	Prices   map[string]money
+}
+
+func TestMarshalerTopLevel(t *testing.T) {
+	data, err := serialize.Marshal(money{cents: -1999})
+	if err != nil {
+		t.Fatalf("Error marshaling money: %v", err)
+	}
+
+	// The custom representation replaces struct reflection entirely
+	if types.TypeFromHeader(data[0]) != types.SInt {
+		t.Errorf("Expected money to encode as SInt, got %s", types.TypeNameFromHeader(data[0]))
+	}
+
+	var out money
+	if err := serialize.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Error unmarshaling money: %v", err)
+	}
+	if out.cents != -1999 {
+		t.Errorf("Expected -1999 cents, got %d", out.cents)
+	}
+
+	// Pointer receivers are honored for addressable values and pointers alike
+	data, err = serialize.Marshal(geoPoint{lat: 47.6, lng: -122.3})
+	if err != nil {
+		t.Fatalf("Error marshaling geoPoint: %v", err)
+	}
+	if types.TypeFromHeader(data[0]) != types.Buffer {
+		t.Errorf("Expected geoPoint to encode as Buffer, got %s", types.TypeNameFromHeader(data[0]))
+	}
+
+	var point geoPoint
+	if err := serialize.Unmarshal(data, &point); err != nil {
+		t.Fatalf("Error unmarshaling geoPoint: %v", err)
+	}
+	if point.lat != 47.6 || point.lng != -122.3 {
+		t.Errorf("Expected {47.6 -122.3}, got %+v", point)
+	}
+}
+
+func TestMarshalerNested(t *testing.T) {
+	original := order{
+		ID:       userID(4242),
+		Total:    money{cents: 123456},
+		Location: geoPoint{lat: 1.5, lng: -2.5},
+		Stops:    []geoPoint{{lat: 10, lng: 20}, {lat: 30, lng: 40}},
+		Prices:   map[string]money{"coffee": {cents: 450}, "bagel": {cents: 325}},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling order: %v", err)
+	}
+
+	var decoded order
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling order: %v", err)
+	}
+
+	if !reflect.DeepEqual(original, decoded) {
+		t.Errorf("Round trip mismatch:\nexpected %+v\ngot      %+v", original, decoded)
+	}
+}
+
+func TestMarshalerArrayElementType(t *testing.T) {
+	// userID is a uint64 written as a String, so its arrays cannot declare the element type of its kind
+	ids := []userID{1, 2}
+	data, err := serialize.Marshal(ids)
+	if err != nil {
+		t.Fatalf("Error marshaling ids: %v", err)
+	}
+	if elementType := arrayElementType(t, data); elementType != types.Mixed {
+		t.Errorf("Expected Mixed element type, got %s", types.TypeName(elementType))
+	}
+
+	var decoded []userID
+	if err := serialize.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, ids) {
+		t.Errorf("Expected %v, got %v (%v)", ids, decoded, err)
+	}
+	var dynamic []interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil || !reflect.DeepEqual(dynamic, []interface{}{"user-1", "user-2"}) {
+		t.Errorf("Expected [user-1 user-2], got %v (%v)", dynamic, err)
+	}
+	if !serialize.IsCanonical(data) {
+		t.Errorf("Expected ids to be canonical")
+	}
+
+	// Values write whatever they hold, so a []serialize.Value is Mixed as well
+	values := []serialize.Value{serialize.IntValue(-1), serialize.StringValue("x")}
+	data, err = serialize.Marshal(values)
+	if err != nil {
+		t.Fatalf("Error marshaling values: %v", err)
+	}
+	if elementType := arrayElementType(t, data); elementType != types.Mixed {
+		t.Errorf("Expected Mixed element type, got %s", types.TypeName(elementType))
+	}
+	var decodedValues []serialize.Value
+	if err := serialize.Unmarshal(data, &decodedValues); err != nil {
+		t.Fatalf("Error unmarshaling values: %v", err)
+	}
+	if len(decodedValues) != 2 || !decodedValues[0].Equal(values[0]) || !decodedValues[1].Equal(values[1]) {
+		t.Errorf("Expected %v, got %v", values, decodedValues)
+	}
+}
+
+func TestMarshalerErrors(t *testing.T) {
+	t.Run("marshal failure", func(t *testing.T) {
+		if _, err := serialize.Marshal(failingMarshaler{}); err == nil {
+			t.Error("Expected error from failing MarshalEBE, got nil")
+		}
+	})
+
+	t.Run("marshal failure in field", func(t *testing.T) {
+		value := struct {
+			A int
+			B failingMarshaler
+		}{A: 1}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error from failing MarshalEBE in struct field, got nil")
+		}
+	})
+
+	t.Run("unmarshal failure", func(t *testing.T) {
+		data, err := serialize.Marshal("not-a-user")
+		if err != nil {
+			t.Fatalf("Error marshaling string: %v", err)
+		}
+		var id userID
+		if err := serialize.Unmarshal(data, &id); err == nil {
+			t.Error("Expected error from failing UnmarshalEBE, got nil")
+		}
+	})
+}
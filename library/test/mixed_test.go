@@ -0,0 +1,210 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// mixedValues holds one value of each kind a heterogeneous array commonly mixes
+var mixedValues = []interface{}{
+	int32(42),
+	"mixed string",
+	3.14159,
+	true,
+	[]byte{0xDE, 0xAD, 0xBE, 0xEF},
+	nil,
+	[]interface{}{uint8(1), "nested"},
+}
+
+// naturalMixedValues is mixedValues as decoded into interface{}, with each element's natural Go type
+var naturalMixedValues = []interface{}{
+	int64(42),
+	"mixed string",
+	3.14159,
+	true,
+	[]byte{0xDE, 0xAD, 0xBE, 0xEF},
+	nil,
+	[]interface{}{uint64(1), "nested"},
+}
+
+// arrayElementType returns the element type of an array that is not packed, which follows its header and count
+func arrayElementType(t *testing.T, data []byte) types.Types {
+	t.Helper()
+	if types.TypeFromHeader(data[0]) != types.Array {
+		t.Fatalf("Expected an array, got header %02x", data[0])
+	}
+	if types.ValueFromHeader(data[0]) < 8 {
+		return types.Types(data[1])
+	}
+	return types.Types(data[2+int(types.ValueFromHeader(data[1]))])
+}
+
+func TestMixedArrayRoundTrip(t *testing.T) {
+	data, err := serialize.Marshal(mixedValues)
+	if err != nil {
+		t.Fatalf("Error marshaling mixed array: %v", err)
+	}
+	if elementType := arrayElementType(t, data); elementType != types.Mixed {
+		t.Errorf("Expected Mixed element type, got %s", types.TypeName(elementType))
+	}
+
+	var decoded []interface{}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling mixed array: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, naturalMixedValues) {
+		t.Errorf("Expected %#v, got %#v", naturalMixedValues, decoded)
+	}
+
+	var dynamic interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling into interface: %v", err)
+	}
+	if !reflect.DeepEqual(dynamic, naturalMixedValues) {
+		t.Errorf("Expected %#v, got %#v", naturalMixedValues, dynamic)
+	}
+
+	if !serialize.IsCanonical(data) {
+		t.Errorf("Expected mixed array to be canonical")
+	}
+	if n, err := serialize.SkipValueBytes(data); err != nil || n != len(data) {
+		t.Errorf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+	}
+}
+
+func TestMixedElementTypeByte(t *testing.T) {
+	// Mixed only appears in the element type byte, beyond the 15 header types, which leaves the last header nibble free
+	data, err := serialize.Marshal([]interface{}{"a"})
+	if err != nil {
+		t.Fatalf("Error marshaling mixed array: %v", err)
+	}
+	expected := []byte{types.CreateHeader(types.Array, 1), 0x10, types.CreateHeader(types.String, 1), 'a'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected % x, got % x", expected, data)
+	}
+}
+
+func TestMixedArrayField(t *testing.T) {
+	type collection struct {
+		Name       string
+		MixedArray []interface{}
+		Fixed      [2]interface{}
+	}
+	in := collection{Name: "mixed", MixedArray: mixedValues, Fixed: [2]interface{}{"a", int8(-3)}}
+	data, err := serialize.Marshal(in)
+	if err != nil {
+		t.Fatalf("Error marshaling collection: %v", err)
+	}
+
+	var out collection
+	if err := serialize.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Error unmarshaling collection: %v", err)
+	}
+	expected := collection{Name: "mixed", MixedArray: naturalMixedValues, Fixed: [2]interface{}{"a", int64(-3)}}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, out)
+	}
+}
+
+func TestMixedArrayValue(t *testing.T) {
+	data, err := serialize.Marshal(mixedValues)
+	if err != nil {
+		t.Fatalf("Error marshaling mixed array: %v", err)
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if value.ElementType() != types.Mixed {
+		t.Errorf("Expected Mixed element type, got %s", types.TypeName(value.ElementType()))
+	}
+	if value.Index(1).Kind() != types.String || value.Index(3).Kind() != types.Boolean {
+		t.Errorf("Expected elements to keep their own kinds, got %s and %s",
+			types.TypeName(value.Index(1).Kind()), types.TypeName(value.Index(3).Kind()))
+	}
+
+	reencoded, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling Value: %v", err)
+	}
+	if !bytes.Equal(reencoded, data) {
+		t.Errorf("Expected Value to re-encode as % x, got % x", data, reencoded)
+	}
+
+	built, err := serialize.Marshal(serialize.ArrayValue(types.Mixed, serialize.IntValue(-1), serialize.StringValue("x")))
+	if err != nil {
+		t.Fatalf("Error marshaling built Value: %v", err)
+	}
+	var decoded []interface{}
+	if err := serialize.Unmarshal(built, &decoded); err != nil || !reflect.DeepEqual(decoded, []interface{}{int64(-1), "x"}) {
+		t.Errorf("Expected [-1 x], got %v (%v)", decoded, err)
+	}
+}
+
+func TestInterfaceArrayElementType(t *testing.T) {
+	data, err := serialize.Marshal([]shape{circle{Radius: 1}, nil})
+	if err != nil {
+		t.Fatalf("Error marshaling shapes: %v", err)
+	}
+	if elementType := arrayElementType(t, data); elementType != types.Mixed {
+		t.Errorf("Expected Mixed element type, got %s", types.TypeName(elementType))
+	}
+}
+
+func TestArrayElementTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		out   interface{}
+		wire  types.Types
+	}{
+		{"strings into int16 array", []string{"a", "b", "c"}, new([3]int16), types.String},
+		{"empty strings into float32 pointers", []string{}, new([]*float32), types.String},
+		{"ints into strings", []int64{1, 2}, new([2]string), types.SInt},
+		{"bools into ints", []bool{true, false}, new([2]uint16), types.Boolean},
+		{"mixed into ints", []interface{}{1, "a"}, new([]int), types.Mixed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling array: %v", err)
+			}
+			err = serialize.Unmarshal(data, tt.out)
+			var mismatch *serialize.TypeMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Expected a TypeMismatchError, got %v", err)
+			}
+			if mismatch.Wire != tt.wire {
+				t.Errorf("Expected wire type %s, got %s", types.TypeName(tt.wire), types.TypeName(mismatch.Wire))
+			}
+		})
+	}
+}
+
+func TestArrayElementTypeConversions(t *testing.T) {
+	data, err := serialize.Marshal([]uint32{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	var floats [3]float64
+	if err := serialize.Unmarshal(data, &floats); err != nil || floats != [3]float64{1, 2, 3} {
+		t.Errorf("Expected [1 2 3], got %v (%v)", floats, err)
+	}
+
+	// Mixed elements are checked one by one, so a mixed array of numbers decodes into numbers
+	data, err = serialize.Marshal([]interface{}{1, uint(2), 3.0})
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	var ints [3]int8
+	if err := serialize.Unmarshal(data, &ints); err != nil || ints != [3]int8{1, 2, 3} {
+		t.Errorf("Expected [1 2 3], got %v (%v)", ints, err)
+	}
+}
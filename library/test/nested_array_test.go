@@ -0,0 +1,104 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNestedSlicesRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  interface{}
+		output interface{}
+	}{
+		{"int32 matrix", [][]int32{{1, 2, 3}, {}, {-4, 5}}, new([][]int32)},
+		{"string rows", [][]string{{"a", "b"}, {"c"}}, new([][]string)},
+		{"nil inner slice", [][]string{{"x"}, nil}, new([][]string)},
+		{"struct rows", [][]exampleStruct{{{A: 1, C: "one"}}, {{B: -2, D: true}, {A: 3}}}, new([][]exampleStruct)},
+		{"three levels", [][][]uint16{{{1}, {2, 3}}, {{4, 5, 6}}}, new([][][]uint16)},
+		{"buffers", [][]byte{{0x01, 0x02}, {}}, new([][]byte)},
+		{"fixed array of slices", [2][]float64{{1.5}, {2.5, 3.5}}, new([2][]float64)},
+		{"slice of fixed arrays", [][3]int8{{1, 2, 3}, {-1, -2, -3}}, new([][3]int8)},
+		{"float32 grid", [4][4]float32{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}, new([4][4]float32)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling %T: %v", tc.input, err)
+			}
+			if err := serialize.Unmarshal(data, tc.output); err != nil {
+				t.Fatalf("Error unmarshaling %T: %v", tc.input, err)
+			}
+			decoded := reflect.ValueOf(tc.output).Elem().Interface()
+			if !reflect.DeepEqual(decoded, tc.input) {
+				t.Errorf("Expected %v, got %v", tc.input, decoded)
+			}
+		})
+	}
+}
+
+func TestNestedArrayElementTypes(t *testing.T) {
+	data, err := serialize.Marshal([][]string{{"a"}})
+	if err != nil {
+		t.Fatalf("Error marshaling [][]string: %v", err)
+	}
+
+	// Outer array of arrays, then the inner array declares its own element type
+	expected := []byte{
+		types.CreateHeader(types.Array, 1), byte(types.Array),
+		types.CreateHeader(types.Array, 1), byte(types.String),
+		types.CreateHeader(types.String, 1), 'a',
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected [% x], got [% x]", expected, data)
+	}
+
+	// Slices of byte slices are arrays of buffers
+	data, err = serialize.Marshal([][]byte{{1}})
+	if err != nil {
+		t.Fatalf("Error marshaling [][]byte: %v", err)
+	}
+	if elementType := types.Types(data[1]); elementType != types.Buffer {
+		t.Errorf("Expected Buffer element type, got %s", types.TypeName(elementType))
+	}
+}
+
+func TestFixedArrayLengthValidation(t *testing.T) {
+	data, err := serialize.Marshal([][]int{{1, 2}, {3, 4}})
+	if err != nil {
+		t.Fatalf("Error marshaling [][]int: %v", err)
+	}
+
+	var tooLong [3][2]int
+	var mismatch *serialize.TypeMismatchError
+	err = serialize.Unmarshal(data, &tooLong)
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError decoding 2 rows into [3][2]int, got %v", err)
+	}
+	if mismatch.Wire != types.Array || mismatch.GoType != reflect.TypeOf(tooLong) || mismatch.Path != "" || mismatch.Offset != 0 {
+		t.Errorf("Expected Array into [3][2]int at offset 0, got %+v", mismatch)
+	}
+
+	// The mismatch is located at the first row, after the outer header and element type
+	var tooShort [2][1]int
+	err = serialize.Unmarshal(data, &tooShort)
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError decoding 2 columns into [2][1]int, got %v", err)
+	}
+	if mismatch.GoType != reflect.TypeOf([1]int{}) || mismatch.Path != "[0]" || mismatch.Offset != 2 {
+		t.Errorf("Expected [1]int at [0] and offset 2, got %+v", mismatch)
+	}
+
+	var exact [2][2]int
+	if err := serialize.Unmarshal(data, &exact); err != nil {
+		t.Fatalf("Error decoding into [2][2]int: %v", err)
+	}
+	if exact != [2][2]int{{1, 2}, {3, 4}} {
+		t.Errorf("Expected [[1 2] [3 4]], got %v", exact)
+	}
+}
@@ -0,0 +1,233 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	Street string
+	City   string
+}
+
+type contact struct {
+	Name     string
+	Home     *address
+	Work     *address
+	Age      *int
+	Phones   []string
+	Labels   map[string]string
+	Metadata interface{}
+}
+
+func TestNullTopLevel(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input interface{}
+	}{
+		{"nil interface", nil},
+		{"nil int pointer", (*int)(nil)},
+		{"nil struct pointer", (*address)(nil)},
+		{"nil int slice", []int(nil)},
+		{"nil string slice", []string(nil)},
+		{"nil byte slice", []byte(nil)},
+		{"nil struct slice", []address(nil)},
+		{"nil map", map[string]int(nil)},
+		{"nil generic map", map[uint8]address(nil)},
+		{"nil marshaler pointer", (*geoPoint)(nil)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling %s: %v", tc.name, err)
+			}
+			if len(data) != 1 || types.TypeFromHeader(data[0]) != types.Null {
+				t.Errorf("Expected single Null header, got [% x]", data)
+			}
+		})
+	}
+}
+
+func TestNullDecodesToZero(t *testing.T) {
+	data, err := serialize.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Error marshaling nil: %v", err)
+	}
+
+	ptr := new(int)
+	if err := serialize.Unmarshal(data, &ptr); err != nil {
+		t.Fatalf("Error unmarshaling Null into pointer: %v", err)
+	}
+	if ptr != nil {
+		t.Errorf("Expected nil pointer, got %v", ptr)
+	}
+
+	slice := []int{1, 2, 3}
+	if err := serialize.Unmarshal(data, &slice); err != nil {
+		t.Fatalf("Error unmarshaling Null into slice: %v", err)
+	}
+	if slice != nil {
+		t.Errorf("Expected nil slice, got %v", slice)
+	}
+
+	m := map[string]string{"k": "v"}
+	if err := serialize.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Error unmarshaling Null into map: %v", err)
+	}
+	if m != nil {
+		t.Errorf("Expected nil map, got %v", m)
+	}
+}
+
+func TestPointerAllocation(t *testing.T) {
+	data, err := serialize.Marshal(42)
+	if err != nil {
+		t.Fatalf("Error marshaling int: %v", err)
+	}
+
+	var ptr *int
+	if err := serialize.Unmarshal(data, &ptr); err != nil {
+		t.Fatalf("Error unmarshaling into nil pointer: %v", err)
+	}
+	if ptr == nil || *ptr != 42 {
+		t.Fatalf("Expected pointer to 42, got %v", ptr)
+	}
+
+	// An existing pointer is decoded into rather than replaced
+	existing := ptr
+	data, _ = serialize.Marshal(7)
+	if err := serialize.Unmarshal(data, &ptr); err != nil {
+		t.Fatalf("Error unmarshaling into existing pointer: %v", err)
+	}
+	if ptr != existing || *existing != 7 {
+		t.Errorf("Expected existing pointer to hold 7, got %v (%d)", ptr, *ptr)
+	}
+}
+
+func TestNullInStruct(t *testing.T) {
+	age := 36
+	testCases := []struct {
+		name  string
+		input contact
+	}{
+		{"all nil", contact{Name: "nobody"}},
+		{"all set", contact{
+			Name:     "Ada",
+			Home:     &address{Street: "1 Main St", City: "London"},
+			Work:     &address{City: "Cambridge"},
+			Age:      &age,
+			Phones:   []string{"555-0100"},
+			Labels:   map[string]string{"role": "engineer"},
+			Metadata: "note",
+		}},
+		{"some nil", contact{Name: "Grace", Work: &address{Street: "Navy Yard"}, Phones: []string{}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling contact: %v", err)
+			}
+
+			// Stale values in the target are replaced, including pointers set back to nil
+			decoded := contact{Home: &address{City: "stale"}, Phones: []string{"stale"}, Metadata: 1}
+			if err := serialize.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling contact: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tc.input) {
+				t.Errorf("Expected %+v, got %+v", tc.input, decoded)
+			}
+		})
+	}
+}
+
+func TestNullInCollections(t *testing.T) {
+	t.Run("pointer slice", func(t *testing.T) {
+		original := []*address{{City: "Paris"}, nil, {Street: "Rue"}}
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling pointer slice: %v", err)
+		}
+
+		// The element type is that of the pointed-to value
+		if elementType := types.Types(data[1]); elementType != types.Struct {
+			t.Errorf("Expected Struct element type, got %s", types.TypeName(elementType))
+		}
+
+		var decoded []*address
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling pointer slice: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, original) {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+
+	t.Run("pointer map values", func(t *testing.T) {
+		original := map[string]*address{"home": {City: "Oslo"}, "work": nil}
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling pointer map: %v", err)
+		}
+
+		var decoded map[string]*address
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling pointer map: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, original) {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+
+	t.Run("interface map values", func(t *testing.T) {
+		original := map[string]interface{}{"set": "value", "unset": nil, "none": []byte(nil)}
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling interface map: %v", err)
+		}
+
+		var decoded map[string]interface{}
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling interface map: %v", err)
+		}
+		expected := map[string]interface{}{"set": "value", "unset": nil, "none": nil}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Expected %v, got %v", expected, decoded)
+		}
+	})
+}
+
+func TestBytesBufferPointerTarget(t *testing.T) {
+	original := struct {
+		Payload *bytes.Buffer
+		Empty   *bytes.Buffer
+	}{Payload: bytes.NewBufferString("payload")}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling buffer pointers: %v", err)
+	}
+
+	var decoded struct {
+		Payload *bytes.Buffer
+		Empty   *bytes.Buffer
+	}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling buffer pointers: %v", err)
+	}
+	if decoded.Payload == nil || decoded.Payload.String() != "payload" {
+		t.Errorf("Expected payload buffer, got %v", decoded.Payload)
+	}
+	if decoded.Empty != nil {
+		t.Errorf("Expected nil buffer, got %v", decoded.Empty)
+	}
+}
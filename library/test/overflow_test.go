@@ -0,0 +1,277 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestOverflowUintIntoUint8(t *testing.T) {
+	data, err := serialize.Marshal(uint64(300))
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var decoded uint8
+	err = serialize.Unmarshal(data, &decoded)
+
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError, got %v", err)
+	}
+	if overflow.Value != uint64(300) {
+		t.Errorf("Expected value 300, got %v", overflow.Value)
+	}
+	if overflow.GoType != reflect.TypeOf(uint8(0)) {
+		t.Errorf("Expected Go type uint8, got %v", overflow.GoType)
+	}
+	if overflow.Offset != 0 {
+		t.Errorf("Expected offset 0, got %d", overflow.Offset)
+	}
+}
+
+func TestOverflowNumericConversions(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		out   interface{}
+	}{
+		{"negative into uint32", int64(-1), new(uint32)},
+		{"negative nibble into uint", int8(-3), new(uint)},
+		{"int16 range", int64(40000), new(int16)},
+		{"int8 range", int64(-129), new(int8)},
+		{"uint64 into int64", uint64(math.MaxUint64), new(int64)},
+		{"fraction into int", 1.5, new(int)},
+		{"NaN into int", math.NaN(), new(int)},
+		{"float into uint8", 256.0, new(uint8)},
+		{"float32 range", 1e300, new(float32)},
+		{"complex64 range", complex(1e300, 0), new(complex64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling value: %v", err)
+			}
+			err = serialize.Unmarshal(data, tt.out)
+			var overflow *serialize.OverflowError
+			if !errors.As(err, &overflow) {
+				t.Fatalf("Expected *OverflowError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStrictConversionsInRange(t *testing.T) {
+	var small int8
+	data, _ := serialize.Marshal(int64(-128))
+	if err := serialize.Unmarshal(data, &small); err != nil || small != -128 {
+		t.Errorf("Expected -128, got %d (%v)", small, err)
+	}
+
+	var whole int
+	data, _ = serialize.Marshal(42.0)
+	if err := serialize.Unmarshal(data, &whole); err != nil || whole != 42 {
+		t.Errorf("Expected 42, got %d (%v)", whole, err)
+	}
+
+	var single float32
+	data, _ = serialize.Marshal(math.Inf(-1))
+	if err := serialize.Unmarshal(data, &single); err != nil || !math.IsInf(float64(single), -1) {
+		t.Errorf("Expected -Inf, got %v (%v)", single, err)
+	}
+
+	var widened float64
+	data, _ = serialize.Marshal(uint64(7))
+	if err := serialize.Unmarshal(data, &widened); err != nil || widened != 7 {
+		t.Errorf("Expected 7, got %v (%v)", widened, err)
+	}
+}
+
+func TestStrictNumberIntoString(t *testing.T) {
+	data, err := serialize.Marshal(int64(65))
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var text string
+	err = serialize.Unmarshal(data, &text)
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *TypeMismatchError, got %v", err)
+	}
+}
+
+func TestOverflowArrayFastPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		out   interface{}
+	}{
+		{"int8", []int64{1, 2, 200}, new([]int8)},
+		{"int16", []int64{1, 2, -40000}, new([]int16)},
+		{"int32", []int64{1, 2, 1 << 40}, new([]int32)},
+		{"uint16", []uint64{1, 2, 70000}, new([]uint16)},
+		{"uint32", []uint64{1, 2, 1 << 40}, new([]uint32)},
+		{"float32", []float64{1, 2, 1e300}, new([]float32)},
+		{"complex64", []complex128{1, 2, complex(0, 1e300)}, new([]complex64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling value: %v", err)
+			}
+			err = serialize.Unmarshal(data, tt.out)
+			var overflow *serialize.OverflowError
+			if !errors.As(err, &overflow) {
+				t.Fatalf("Expected *OverflowError, got %v", err)
+			}
+			if overflow.Path != "[2]" {
+				t.Errorf("Expected path [2], got %q", overflow.Path)
+			}
+		})
+	}
+}
+
+func TestOverflowMapValue(t *testing.T) {
+	data, err := serialize.Marshal(map[string]int64{"big": 1 << 40})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+
+	var decoded map[string]int32
+	err = serialize.Unmarshal(data, &decoded)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError, got %v", err)
+	}
+	if overflow.Path != `["big"]` {
+		t.Errorf("Expected path [\"big\"], got %q", overflow.Path)
+	}
+}
+
+func TestOverflowMapIntFastPaths(t *testing.T) {
+	if strconv.IntSize == 64 {
+		t.Skip("int holds every encoded integer on 64-bit platforms")
+	}
+
+	values, err := serialize.Marshal(map[string]int64{"big": 1 << 40})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+	var byName map[string]int
+	err = serialize.Unmarshal(values, &byName)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError for a value, got %v", err)
+	}
+	if overflow.Path != `["big"]` {
+		t.Errorf("Expected path [\"big\"], got %q", overflow.Path)
+	}
+
+	keys, err := serialize.Marshal(map[int64]string{1 << 40: "big"})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+	var byID map[int]string
+	err = serialize.Unmarshal(keys, &byID)
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError for a key, got %v", err)
+	}
+	if overflow.Path != "[1099511627776]" {
+		t.Errorf("Expected path [1099511627776], got %q", overflow.Path)
+	}
+}
+
+func TestOverflowStructFieldPath(t *testing.T) {
+	type wide struct {
+		Name  string
+		Count int64
+	}
+	type narrow struct {
+		Name  string
+		Count int8
+	}
+
+	data, err := serialize.Marshal(wide{Name: "a", Count: 1000})
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	var decoded narrow
+	err = serialize.Unmarshal(data, &decoded)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError, got %v", err)
+	}
+	if overflow.Path != "Count" {
+		t.Errorf("Expected path Count, got %q", overflow.Path)
+	}
+}
+
+func TestLenientConversion(t *testing.T) {
+	data, err := serialize.Marshal(uint64(300))
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var decoded uint8
+	if err := serialize.UnmarshalWithOptions(data, &decoded, serialize.DecodeOptions{Lenient: true}); err != nil {
+		t.Fatalf("Lenient unmarshal failed: %v", err)
+	}
+	if decoded != 44 {
+		t.Errorf("Expected 300 to wrap to 44, got %d", decoded)
+	}
+
+	// Deserialize keeps its lenient behavior
+	decoded = 0
+	if err := serialize.Deserialize(bytes.NewReader(data), &decoded); err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if decoded != 44 {
+		t.Errorf("Expected 300 to wrap to 44, got %d", decoded)
+	}
+
+	arrayData, err := serialize.Marshal([]int64{1, 200})
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	var small []int8
+	if err := serialize.UnmarshalWithOptions(arrayData, &small, serialize.DecodeOptions{Lenient: true}); err != nil {
+		t.Fatalf("Lenient array unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(small, []int8{1, -56}) {
+		t.Errorf("Expected [1 -56], got %v", small)
+	}
+}
+
+func TestDecoderLenient(t *testing.T) {
+	data, err := serialize.Marshal(int64(-1))
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var decoded uint16
+	decoder := serialize.NewDecoder(bytes.NewReader(data))
+	err = decoder.Decode(&decoded)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError from strict decoder, got %v", err)
+	}
+
+	decoder = serialize.NewDecoder(bytes.NewReader(data))
+	decoder.SetLenient(true)
+	if err := decoder.Decode(&decoded); err != nil {
+		t.Fatalf("Lenient decode failed: %v", err)
+	}
+	if decoded != math.MaxUint16 {
+		t.Errorf("Expected -1 to wrap to %d, got %d", math.MaxUint16, decoded)
+	}
+}
@@ -0,0 +1,375 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// packedHeader is the first byte of every packed array
+var packedHeader = types.CreateHeader(types.Array, types.ArrayPacked)
+
+// packedWidth returns the packing byte of a packed array, which follows its header, count and element type
+func packedWidth(t *testing.T, data []byte) byte {
+	t.Helper()
+	if data[0] != packedHeader {
+		t.Fatalf("Expected a packed array, got header %02x", data[0])
+	}
+	countSize := 1
+	if types.TypeFromHeader(data[1]) == types.UInt {
+		countSize += int(types.ValueFromHeader(data[1]))
+	}
+	return data[1+countSize+1]
+}
+
+func TestPackedArrayRoundTrip(t *testing.T) {
+	ints := make([]int, 100)
+	int8s := make([]int8, 100)
+	uint16s := make([]uint16, 100)
+	uint64s := make([]uint64, 100)
+	float32s := make([]float32, 100)
+	float64s := make([]float64, 100)
+	for i := range ints {
+		ints[i] = 40000 + 100*i
+		int8s[i] = int8(i - 50)
+		uint16s[i] = uint16(600 * i)
+		uint64s[i] = uint64(i) << 40
+		float32s[i] = float32(i) + 0.1
+		float64s[i] = float64(i) + 0.1
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		width byte
+		out   interface{}
+	}{
+		{"int", ints, 3, new([]int)},
+		{"int8", int8s, 1, new([]int8)},
+		{"uint16", uint16s, 2, new([]uint16)},
+		{"uint64", uint64s, 6, new([]uint64)},
+		{"float32", float32s, 4, new([]float32)},
+		{"float64", float64s, 8, new([]float64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling array: %v", err)
+			}
+			if width := packedWidth(t, data); width != tt.width {
+				t.Errorf("Expected packing %d, got %d", tt.width, width)
+			}
+			if err := serialize.Unmarshal(data, tt.out); err != nil {
+				t.Fatalf("Error unmarshaling array: %v", err)
+			}
+			if decoded := reflect.ValueOf(tt.out).Elem().Interface(); !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("Expected %v, got %v", tt.value, decoded)
+			}
+			if !serialize.IsCanonical(data) {
+				t.Errorf("Expected packed array to be canonical")
+			}
+		})
+	}
+}
+
+func TestPackedArraySize(t *testing.T) {
+	input := make([]int, 100)
+	for i := range input {
+		input[i] = 1000 + i
+	}
+	data, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+
+	// Header, count, element type and packing, then two bytes per element instead of three
+	if len(data) != 5+200 {
+		t.Errorf("Expected 205 bytes, got %d", len(data))
+	}
+
+	// Arrays whose elements fit in their headers are smaller unpacked
+	data, err = serialize.Marshal([]int{1, 2, 3, -4, 5, 6, 7, 0, 1, 2})
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	if data[0] == packedHeader {
+		t.Errorf("Expected nibble-sized elements not to be packed")
+	}
+}
+
+func TestPackedVarint(t *testing.T) {
+	// One large element makes a fixed width wasteful for the rest
+	input := make([]int64, 50)
+	for i := range input {
+		input[i] = int64(i%20) - 60
+	}
+	input[25] = 1 << 40
+
+	data, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	if width := packedWidth(t, data); width != types.PackedVarint {
+		t.Fatalf("Expected varint packing, got %d", width)
+	}
+
+	var decoded []int64
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling array: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("Expected %v, got %v", input, decoded)
+	}
+}
+
+func TestPackedFloatWidth(t *testing.T) {
+	// Every element is exact as a float32, so they are packed four bytes wide
+	input := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8}
+	for i := range input {
+		input[i] = float64(float32(input[i]))
+	}
+	data, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	if width := packedWidth(t, data); width != 4 {
+		t.Errorf("Expected packing 4, got %d", width)
+	}
+
+	var decoded []float64
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling array: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("Expected %v, got %v", input, decoded)
+	}
+
+	// Float32 slices decode float64 elements too
+	wide, _ := serialize.Marshal([]float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8})
+	var narrow []float32
+	if err := serialize.Unmarshal(wide, &narrow); err != nil {
+		t.Fatalf("Error unmarshaling float64 elements into []float32: %v", err)
+	}
+	if narrow[0] != float32(0.1) {
+		t.Errorf("Expected 0.1, got %v", narrow[0])
+	}
+}
+
+func TestPackedArrayIntoOtherTypes(t *testing.T) {
+	input := []int{300, -300, 1000, 2000, 3000, 4000, 5000, 6000}
+	data, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	packedWidth(t, data)
+
+	var fixed [8]int
+	if err := serialize.Unmarshal(data, &fixed); err != nil {
+		t.Fatalf("Error unmarshaling into Go array: %v", err)
+	}
+	if fixed[1] != -300 || fixed[7] != 6000 {
+		t.Errorf("Unexpected Go array %v", fixed)
+	}
+
+	var pointers []*int
+	if err := serialize.Unmarshal(data, &pointers); err != nil {
+		t.Fatalf("Error unmarshaling into []*int: %v", err)
+	}
+	if len(pointers) != 8 || *pointers[2] != 1000 {
+		t.Errorf("Unexpected pointers %v", pointers)
+	}
+
+	var dynamic interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling into interface{}: %v", err)
+	}
+	if elements, ok := dynamic.([]interface{}); !ok || len(elements) != 8 || elements[1] != int64(-300) {
+		t.Errorf("Unexpected dynamic value %#v", dynamic)
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if value.Len() != 8 || value.ElementType() != types.SInt || value.Index(3).Int() != 2000 {
+		t.Errorf("Unexpected Value %v", value)
+	}
+
+	// The Value encodes back to the same packed array
+	encoded, err := serialize.Marshal(value)
+	if err != nil {
+		t.Fatalf("Error marshaling Value: %v", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Errorf("Expected %x, got %x", data, encoded)
+	}
+
+	// Go arrays and named slice types are packed as well
+	type scores []int
+	named, err := serialize.Marshal(scores(input))
+	if err != nil {
+		t.Fatalf("Error marshaling named slice: %v", err)
+	}
+	if fromArray, _ := serialize.Marshal(fixed); !bytes.Equal(named, data) || !bytes.Equal(fromArray, data) {
+		t.Errorf("Expected named slices and Go arrays to be packed like slices")
+	}
+}
+
+func TestPackedArraySkip(t *testing.T) {
+	type record struct {
+		Values []uint32
+		Name   string
+	}
+	values := make([]uint32, 20)
+	for i := range values {
+		values[i] = uint32(i * 70000)
+	}
+	data, err := serialize.Marshal(record{Values: values, Name: "after"})
+	if err != nil {
+		t.Fatalf("Error marshaling record: %v", err)
+	}
+
+	n, err := serialize.SkipValueBytes(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+	}
+
+	varints := make([]int64, 30)
+	for i := range varints {
+		varints[i] = -50
+	}
+	varints[10] = 1 << 50
+	data, err = serialize.Marshal(varints)
+	if err != nil {
+		t.Fatalf("Error marshaling values: %v", err)
+	}
+	if width := packedWidth(t, data); width != types.PackedVarint {
+		t.Fatalf("Expected varint packing, got %d", width)
+	}
+	if n, err := serialize.SkipValueBytes(data); err != nil || n != len(data) {
+		t.Errorf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+	}
+}
+
+func TestPackedArrayCanonical(t *testing.T) {
+	input := []int{1000, 2000, 3000, 4000, 5000, 6000, 7000, 8000}
+	packed, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+
+	// The same elements with a header each are valid but not canonical
+	regular := []byte{types.CreateHeader(types.Array, 8), types.CreateHeader(types.UNibble, 8), byte(types.SInt)}
+	for _, value := range input {
+		regular = append(regular, types.CreateHeader(types.SInt, 2), byte(value>>8), byte(value))
+	}
+	var decoded []int
+	if err := serialize.Unmarshal(regular, &decoded); err != nil || !reflect.DeepEqual(decoded, input) {
+		t.Fatalf("Expected %v, got %v (%v)", input, decoded, err)
+	}
+	if serialize.IsCanonical(regular) {
+		t.Errorf("Expected unpacked array not to be canonical")
+	}
+	canonical, err := serialize.Canonicalize(regular)
+	if err != nil {
+		t.Fatalf("Error canonicalizing array: %v", err)
+	}
+	if !bytes.Equal(canonical, packed) {
+		t.Errorf("Expected %x, got %x", packed, canonical)
+	}
+
+	// So is a packed array wider than it needs to be
+	wide := []byte{packedHeader, types.CreateHeader(types.UNibble, 8), byte(types.SInt), 4}
+	for _, value := range input {
+		wide = append(wide, byte(value), byte(value>>8), 0, 0)
+	}
+	if err := serialize.Unmarshal(wide, &decoded); err != nil || !reflect.DeepEqual(decoded, input) {
+		t.Fatalf("Expected %v, got %v (%v)", input, decoded, err)
+	}
+	if serialize.IsCanonical(wide) {
+		t.Errorf("Expected wide packed array not to be canonical")
+	}
+	if canonical, err := serialize.Canonicalize(wide); err != nil || !bytes.Equal(canonical, packed) {
+		t.Errorf("Expected %x, got %x (%v)", packed, canonical, err)
+	}
+
+	// Packed NaNs are canonicalized like any other
+	nans := []float32{1e-3, 1e-3, 1e-3, 1e-3, 1e-3, 1e-3, 1e-3, math.Float32frombits(0x7fc00123)}
+	data, _ := serialize.Marshal(nans)
+	if serialize.IsCanonical(data) {
+		t.Errorf("Expected NaN payload not to be canonical")
+	}
+}
+
+func TestPackedArrayOverflow(t *testing.T) {
+	input := make([]int64, 20)
+	for i := range input {
+		input[i] = int64(i) * 10
+	}
+	data, err := serialize.Marshal(input)
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	packedWidth(t, data)
+
+	var small []int8
+	err = serialize.Unmarshal(data, &small)
+	var overflow *serialize.OverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("Expected *OverflowError, got %v", err)
+	}
+	if overflow.Path != "[13]" {
+		t.Errorf("Expected path [13], got %q", overflow.Path)
+	}
+
+	// The offset is that of the element in the packed payload
+	if overflow.Offset != int64(len(data)-2*7) {
+		t.Errorf("Expected offset %d, got %d", len(data)-2*7, overflow.Offset)
+	}
+
+	if err := serialize.UnmarshalWithOptions(data, &small, serialize.DecodeOptions{Lenient: true}); err != nil {
+		t.Fatalf("Lenient unmarshal failed: %v", err)
+	}
+	if small[13] != -126 {
+		t.Errorf("Expected 130 to wrap to -126, got %d", small[13])
+	}
+
+	var unsigned []uint64
+	err = serialize.Unmarshal(data, &unsigned)
+	var mismatch *serialize.TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("Expected *TypeMismatchError, got %v", err)
+	}
+}
+
+func TestPackedArrayTruncated(t *testing.T) {
+	data, err := serialize.Marshal([]float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8})
+	if err != nil {
+		t.Fatalf("Error marshaling array: %v", err)
+	}
+	truncated := data[:len(data)-1]
+
+	var floats []float64
+	if err := serialize.Unmarshal(truncated, &floats); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	var dynamic interface{}
+	if err := serialize.Unmarshal(truncated, &dynamic); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := serialize.SkipValueBytes(truncated); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	// A stream reader cannot tell the input is short until it runs out
+	if err := serialize.Deserialize(io.MultiReader(bytes.NewReader(truncated)), &floats); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type circle struct {
+	Radius float64
+}
+
+func (c circle) Area() float64 { return math.Pi * c.Radius * c.Radius }
+
+type square struct {
+	Side uint32
+}
+
+func (s *square) Area() float64 { return float64(s.Side) * float64(s.Side) }
+
+type drawing struct {
+	Title  string
+	Main   shape
+	Shapes []shape
+}
+
+type event interface {
+	Topic() string
+}
+
+type loginEvent struct {
+	User string
+}
+
+func (loginEvent) Topic() string { return "login" }
+
+type unregisteredShape struct {
+	Points uint8
+}
+
+func (unregisteredShape) Area() float64 { return 0 }
+
+func init() {
+	serialize.RegisterType("test.circle", circle{})
+	serialize.RegisterType("test.square", &square{})
+	serialize.RegisterType("test.loginEvent", loginEvent{})
+}
+
+func TestRegistryInterfaceField(t *testing.T) {
+	original := drawing{
+		Title:  "shapes",
+		Main:   circle{Radius: 2},
+		Shapes: []shape{&square{Side: 3}, circle{Radius: 1}, nil},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling drawing: %v", err)
+	}
+
+	var decoded drawing
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling drawing: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+	if _, ok := decoded.Shapes[0].(*square); !ok {
+		t.Errorf("Expected *square element, got %T", decoded.Shapes[0])
+	}
+}
+
+func TestRegistryMapValues(t *testing.T) {
+	original := map[string]event{
+		"first":  loginEvent{User: "ada"},
+		"second": loginEvent{User: "grace"},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling events: %v", err)
+	}
+
+	var decoded map[string]event
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling events: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+
+	// Empty interfaces restore registered types too
+	data, err = serialize.Marshal(map[string]interface{}{"event": loginEvent{User: "linus"}, "count": 1})
+	if err != nil {
+		t.Fatalf("Error marshaling interface map: %v", err)
+	}
+	var dynamic map[string]interface{}
+	if err := serialize.Unmarshal(data, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling interface map: %v", err)
+	}
+	if dynamic["event"] != (loginEvent{User: "linus"}) {
+		t.Errorf("Expected loginEvent, got %#v", dynamic["event"])
+	}
+	if dynamic["count"] != int64(1) {
+		t.Errorf("Expected int64(1), got %#v", dynamic["count"])
+	}
+}
+
+func TestRegistryWireFormat(t *testing.T) {
+	data, err := serialize.Marshal(drawing{Main: circle{Radius: 1}})
+	if err != nil {
+		t.Fatalf("Error marshaling drawing: %v", err)
+	}
+
+	// Struct header, empty Title, then the typed header of Main
+	if data[2] != types.CreateHeader(types.Extended, types.ExtendedTyped) {
+		t.Errorf("Expected typed header for interface field, got [% x]", data)
+	}
+
+	// Concrete fields never carry a type id
+	plain, err := serialize.Marshal(circle{Radius: 1})
+	if err != nil {
+		t.Fatalf("Error marshaling circle: %v", err)
+	}
+	if types.TypeFromHeader(plain[0]) != types.Struct {
+		t.Errorf("Expected plain struct encoding, got [% x]", plain)
+	}
+
+	// A typed value still decodes into a field of its concrete type
+	framed, err := serialize.Marshal(struct{ Main shape }{Main: circle{Radius: 1}})
+	if err != nil {
+		t.Fatalf("Error marshaling framed shape: %v", err)
+	}
+	var concrete struct{ Main circle }
+	if err := serialize.Unmarshal(framed, &concrete); err != nil {
+		t.Fatalf("Error unmarshaling typed value into concrete field: %v", err)
+	}
+	if concrete.Main.Radius != 1 {
+		t.Errorf("Expected radius 1, got %+v", concrete.Main)
+	}
+}
+
+func TestRegistryValue(t *testing.T) {
+	data, err := serialize.Marshal(drawing{Main: circle{Radius: 3}})
+	if err != nil {
+		t.Fatalf("Error marshaling drawing: %v", err)
+	}
+
+	var doc serialize.Value
+	if err := serialize.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	main := doc.Field(1)
+	if main.TypeName() != "test.circle" {
+		t.Errorf("Expected type name test.circle, got %q", main.TypeName())
+	}
+	if main.Interface() != (circle{Radius: 3}) {
+		t.Errorf("Expected circle, got %#v", main.Interface())
+	}
+
+	encoded, err := serialize.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Error marshaling Value: %v", err)
+	}
+	if !reflect.DeepEqual(encoded, data) {
+		t.Errorf("Expected Value to re-encode to [% x], got [% x]", data, encoded)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	t.Run("unregistered type in interface with methods", func(t *testing.T) {
+		data, err := serialize.Marshal(drawing{Main: unregisteredShape{Points: 5}})
+		if err != nil {
+			t.Fatalf("Error marshaling drawing: %v", err)
+		}
+		var decoded drawing
+		if err := serialize.Unmarshal(data, &decoded); err == nil {
+			t.Error("Expected error decoding unregistered type into interface, got nil")
+		}
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		data := []byte{types.CreateHeader(types.Extended, types.ExtendedTyped), types.CreateHeader(types.UNibble, 5), types.CreateHeader(types.Null, 0)}
+		var decoded interface{}
+		if err := serialize.Unmarshal(data, &decoded); err == nil {
+			t.Error("Expected error for unknown type id, got nil")
+		}
+	})
+
+	t.Run("registered type that does not implement the interface", func(t *testing.T) {
+		data, err := serialize.Marshal(map[string]interface{}{"e": loginEvent{User: "x"}})
+		if err != nil {
+			t.Fatalf("Error marshaling map: %v", err)
+		}
+		var decoded map[string]shape
+		if err := serialize.Unmarshal(data, &decoded); err == nil {
+			t.Error("Expected error assigning loginEvent to shape, got nil")
+		}
+	})
+
+	t.Run("conflicting registration", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic registering circle under a second name")
+			}
+		}()
+		serialize.RegisterType("test.otherCircle", circle{})
+	})
+
+	t.Run("repeated registration", func(t *testing.T) {
+		serialize.RegisterType("test.circle", circle{})
+	})
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// skipValues covers every wire type, including overflow lengths and nested containers
+var skipValues = []interface{}{
+	uint8(3),
+	uint64(0xffffffffffffffff),
+	int16(-7),
+	int64(-0x7fffffffffffffff),
+	float32(1.5),
+	3.141592653589793,
+	complex(1, -2),
+	true,
+	"short",
+	strings.Repeat("long string ", 20),
+	[]byte{1, 2, 3},
+	bytes.Repeat([]byte{0xaa}, 300),
+	json.RawMessage(`{"nested":[1,2,3]}`),
+	[]int{1, -2, 300, 70000},
+	make([]string, 40),
+	[][]uint16{{1, 2}, nil, {3}},
+	map[string][]int{"a": {1}, "b": nil},
+	map[int]exampleStruct{1: {A: 1, C: "one"}, 2: {B: -2}},
+	exampleStruct{A: 1, B: -1, C: "struct", D: true},
+	accountV2{ID: 1, Tags: []string{"x"}, Limits: map[string]int{"k": 1}},
+	time.Date(2024, 2, 29, 12, 0, 0, 5, time.UTC),
+	time.Date(2024, 2, 29, 12, 0, 0, 0, time.FixedZone("", -5*3600)),
+	90 * time.Second,
+	drawing{Title: "typed", Main: circle{Radius: 1}, Shapes: []shape{&square{Side: 2}}},
+	nil,
+}
+
+func TestSkipValue(t *testing.T) {
+	var stream bytes.Buffer
+	for i, value := range skipValues {
+		if err := serialize.Serialize(value, &stream); err != nil {
+			t.Fatalf("Error serializing value %d (%T): %v", i, value, err)
+		}
+	}
+	if err := serialize.Serialize("sentinel", &stream); err != nil {
+		t.Fatalf("Error serializing sentinel: %v", err)
+	}
+
+	// Skipping every value leaves the reader exactly at the sentinel
+	reader := bytes.NewReader(stream.Bytes())
+	for i, value := range skipValues {
+		if err := serialize.SkipValue(reader); err != nil {
+			t.Fatalf("Error skipping value %d (%T): %v", i, value, err)
+		}
+	}
+
+	var sentinel string
+	if err := serialize.Deserialize(reader, &sentinel); err != nil {
+		t.Fatalf("Error deserializing sentinel: %v", err)
+	}
+	if sentinel != "sentinel" || reader.Len() != 0 {
+		t.Errorf("Expected sentinel at end of stream, got %q with %d bytes left", sentinel, reader.Len())
+	}
+}
+
+func TestSkipValueBytes(t *testing.T) {
+	for i, value := range skipValues {
+		data, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling value %d (%T): %v", i, value, err)
+		}
+
+		// Trailing bytes belong to the next value and are not counted
+		n, err := serialize.SkipValueBytes(append(data, 0x71, 'x'))
+		if err != nil {
+			t.Errorf("Error skipping value %d (%T): %v", i, value, err)
+			continue
+		}
+		if n != len(data) {
+			t.Errorf("Value %d (%T): expected length %d, got %d", i, value, len(data), n)
+		}
+	}
+}
+
+func TestSkipValueIndexStream(t *testing.T) {
+	var stream []byte
+	var offsets []int
+	for _, value := range []interface{}{"first", []int{1, 2, 3}, map[string]string{"k": "v"}, 42} {
+		offsets = append(offsets, len(stream))
+		data, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling %T: %v", value, err)
+		}
+		stream = append(stream, data...)
+	}
+
+	// Walking the stream with SkipValueBytes finds the start of every value
+	var found []int
+	for offset := 0; offset < len(stream); {
+		found = append(found, offset)
+		n, err := serialize.SkipValueBytes(stream[offset:])
+		if err != nil {
+			t.Fatalf("Error skipping value at offset %d: %v", offset, err)
+		}
+		offset += n
+	}
+	if len(found) != len(offsets) {
+		t.Fatalf("Expected offsets %v, got %v", offsets, found)
+	}
+	for i := range offsets {
+		if found[i] != offsets[i] {
+			t.Errorf("Expected offsets %v, got %v", offsets, found)
+			break
+		}
+	}
+
+	// The last value can be decoded directly from its offset
+	var last int
+	if err := serialize.Unmarshal(stream[found[len(found)-1]:], &last); err != nil || last != 42 {
+		t.Errorf("Expected 42 at last offset, got %d (%v)", last, err)
+	}
+}
+
+func TestSkipValueTruncated(t *testing.T) {
+	data, err := serialize.Marshal(map[string][]string{"key": {"a", "b", "c"}})
+	if err != nil {
+		t.Fatalf("Error marshaling map: %v", err)
+	}
+
+	for cut := 0; cut < len(data); cut++ {
+		if _, err := serialize.SkipValueBytes(data[:cut]); err == nil {
+			t.Errorf("Expected error skipping value truncated to %d of %d bytes, got nil", cut, len(data))
+		}
+	}
+}
+
+func TestSkipValueOversizedLength(t *testing.T) {
+	// Each payload claims 2^64-1 bytes but only two follow
+	huge := []byte{0x38, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	payloads := map[string][]byte{
+		"string": append(append([]byte{0x78}, huge...), 'a', 'b'),
+		"buffer": append(append([]byte{0x88}, huge...), 'a', 'b'),
+		"json":   append(append([]byte{0xa0}, huge...), 'a', 'b'),
+	}
+
+	for name, data := range payloads {
+		if n, err := serialize.SkipValueBytes(data); err == nil {
+			t.Errorf("Expected error skipping oversized %s, got length %d", name, n)
+		}
+		// A reader without a known length reaches the skip itself
+		if err := serialize.SkipValue(io.MultiReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("Expected error skipping oversized %s from a stream, got nil", name)
+		}
+	}
+}
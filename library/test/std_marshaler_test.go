@@ -0,0 +1,144 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type networkEvent struct {
+	At      time.Time
+	Source  net.IP
+	Peer    netip.Addr
+	Balance big.Int
+	Seen    []time.Time
+	Owners  map[netip.Addr]string
+}
+
+func TestBinaryMarshalerRoundTrip(t *testing.T) {
+	original := netip.MustParseAddr("2001:db8::68")
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling netip.Addr: %v", err)
+	}
+	if types.TypeFromHeader(data[0]) != types.Buffer {
+		t.Errorf("Expected netip.Addr to encode as Buffer, got %s", types.TypeNameFromHeader(data[0]))
+	}
+
+	var decoded netip.Addr
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling netip.Addr: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("Expected %v, got %v", original, decoded)
+	}
+}
+
+func TestTextMarshalerRoundTrip(t *testing.T) {
+	t.Run("net.IP", func(t *testing.T) {
+		original := net.ParseIP("192.168.1.10")
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling net.IP: %v", err)
+		}
+		if types.TypeFromHeader(data[0]) != types.String {
+			t.Errorf("Expected net.IP to encode as String, got %s", types.TypeNameFromHeader(data[0]))
+		}
+
+		var decoded net.IP
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling net.IP: %v", err)
+		}
+		if !decoded.Equal(original) {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+
+	t.Run("big.Int pointer", func(t *testing.T) {
+		original, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling *big.Int: %v", err)
+		}
+
+		decoded := new(big.Int)
+		if err := serialize.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Error unmarshaling *big.Int: %v", err)
+		}
+		if decoded.Cmp(original) != 0 {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	})
+}
+
+func TestStdMarshalersNested(t *testing.T) {
+	balance, _ := new(big.Int).SetString("98765432109876543210", 10)
+	original := networkEvent{
+		At:      time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC),
+		Source:  net.ParseIP("2001:db8::1"),
+		Peer:    netip.MustParseAddr("10.0.0.1"),
+		Balance: *balance,
+		Seen: []time.Time{
+			time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2023, time.June, 15, 12, 30, 0, 0, time.UTC),
+		},
+		Owners: map[netip.Addr]string{
+			netip.MustParseAddr("10.0.0.2"): "alice",
+			netip.MustParseAddr("10.0.0.3"): "bob",
+		},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling networkEvent: %v", err)
+	}
+
+	var decoded networkEvent
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling networkEvent: %v", err)
+	}
+
+	if !decoded.At.Equal(original.At) {
+		t.Errorf("At: expected %v, got %v", original.At, decoded.At)
+	}
+	if !decoded.Source.Equal(original.Source) {
+		t.Errorf("Source: expected %v, got %v", original.Source, decoded.Source)
+	}
+	if decoded.Peer != original.Peer {
+		t.Errorf("Peer: expected %v, got %v", original.Peer, decoded.Peer)
+	}
+	if decoded.Balance.Cmp(&original.Balance) != 0 {
+		t.Errorf("Balance: expected %v, got %v", &original.Balance, &decoded.Balance)
+	}
+	if len(decoded.Seen) != len(original.Seen) {
+		t.Fatalf("Seen: expected %d entries, got %d", len(original.Seen), len(decoded.Seen))
+	}
+	for i := range original.Seen {
+		if !decoded.Seen[i].Equal(original.Seen[i]) {
+			t.Errorf("Seen[%d]: expected %v, got %v", i, original.Seen[i], decoded.Seen[i])
+		}
+	}
+	if !reflect.DeepEqual(decoded.Owners, original.Owners) {
+		t.Errorf("Owners: expected %v, got %v", original.Owners, decoded.Owners)
+	}
+}
+
+func TestStdMarshalerArrayElementType(t *testing.T) {
+	data, err := serialize.Marshal([]netip.Addr{netip.MustParseAddr("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("Error marshaling []netip.Addr: %v", err)
+	}
+
+	// netip.Addr prefers its binary form, so the declared element type is Buffer
+	if elementType := types.Types(data[1]); elementType != types.Buffer {
+		t.Errorf("Expected Buffer element type, got %s", types.TypeName(elementType))
+	}
+}
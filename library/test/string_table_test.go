@@ -0,0 +1,353 @@
+package test
+
+import (
+	"bytes"
+	"ebe/serialize"
+	"ebe/types"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// logRecord has the enum-like strings that repeat across a log
+type logRecord struct {
+	Level   string
+	Service string
+	Message string
+}
+
+// newLogRecords returns n entries that cycle through a few levels, services and messages
+func newLogRecords(n int) []logRecord {
+	levels := []string{"info", "warning", "error"}
+	services := []string{"authentication", "billing-service"}
+	entries := make([]logRecord, n)
+	for i := range entries {
+		entries[i] = logRecord{
+			Level:   levels[i%len(levels)],
+			Service: services[i%len(services)],
+			Message: fmt.Sprintf("request %d handled", i%10),
+		}
+	}
+	return entries
+}
+
+// newProfiles returns n maps with the same keys, as decoded from a JSON API
+func newProfiles(n int) []map[string]interface{} {
+	profiles := make([]map[string]interface{}, n)
+	for i := range profiles {
+		profiles[i] = map[string]interface{}{
+			"username": fmt.Sprintf("user%d", i),
+			"country":  "Netherlands",
+			"verified": i%2 == 0,
+		}
+	}
+	return profiles
+}
+
+func TestMarshalInternedWireFormat(t *testing.T) {
+	data, err := serialize.MarshalInterned([]string{"status", "status", "status"})
+	if err != nil {
+		t.Fatalf("Error marshaling strings: %v", err)
+	}
+	expected := []byte{
+		types.CreateHeader(types.Array, 3), byte(types.String),
+		types.CreateHeader(types.String, types.StringDefine), types.CreateHeader(types.UNibble, 6), 's', 't', 'a', 't', 'u', 's',
+		types.CreateHeader(types.String, types.StringReference), types.CreateHeader(types.SNibble, 0),
+		types.CreateHeader(types.String, types.StringReference), types.CreateHeader(types.SNibble, 0),
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected % x, got % x", expected, data)
+	}
+
+	// Strings that do not repeat, or are too short to gain from it, are written in full
+	for _, value := range [][]string{{"a", "bb", "ccc"}, {"x", "x", "x"}, {"", ""}} {
+		interned, err := serialize.MarshalInterned(value)
+		if err != nil {
+			t.Fatalf("Error marshaling strings: %v", err)
+		}
+		plain, err := serialize.Marshal(value)
+		if err != nil {
+			t.Fatalf("Error marshaling strings: %v", err)
+		}
+		if !bytes.Equal(interned, plain) {
+			t.Errorf("Expected %q to be written in full, got % x", value, interned)
+		}
+	}
+}
+
+func TestMarshalInternedRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		out   interface{}
+	}{
+		{"structs", newLogRecords(100), new([]logRecord)},
+		{"maps", newProfiles(100), new([]map[string]interface{})},
+		{"map keys", map[string][]string{"first": {"shared value"}, "second": {"shared value", "first"}}, new(map[string][]string)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling value: %v", err)
+			}
+			interned, err := serialize.MarshalInterned(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling interned value: %v", err)
+			}
+			if len(interned) > len(plain) {
+				t.Errorf("Expected interning to take at most %d bytes, got %d", len(plain), len(interned))
+			}
+
+			if err := serialize.Unmarshal(interned, tt.out); err != nil {
+				t.Fatalf("Error unmarshaling interned value: %v", err)
+			}
+			expected := reflect.New(reflect.TypeOf(tt.out).Elem())
+			if err := serialize.Unmarshal(plain, expected.Interface()); err != nil {
+				t.Fatalf("Error unmarshaling value: %v", err)
+			}
+			if !reflect.DeepEqual(reflect.ValueOf(tt.out).Elem().Interface(), expected.Elem().Interface()) {
+				t.Errorf("Interned value decoded differently from the plain one")
+			}
+
+			if n, err := serialize.SkipValueBytes(interned); err != nil || n != len(interned) {
+				t.Errorf("Expected to skip %d bytes, got %d (%v)", len(interned), n, err)
+			}
+			canonical, err := serialize.Canonicalize(interned)
+			if err != nil {
+				t.Fatalf("Error canonicalizing interned value: %v", err)
+			}
+			expectedCanonical, err := serialize.Canonicalize(plain)
+			if err != nil {
+				t.Fatalf("Error canonicalizing value: %v", err)
+			}
+			if !bytes.Equal(canonical, expectedCanonical) {
+				t.Errorf("Expected interned and plain values to have the same canonical form")
+			}
+		})
+	}
+}
+
+func TestMarshalInternedShrinksRepetitiveData(t *testing.T) {
+	entries := newLogRecords(1000)
+	plain, err := serialize.Marshal(entries)
+	if err != nil {
+		t.Fatalf("Error marshaling entries: %v", err)
+	}
+	interned, err := serialize.MarshalInterned(entries)
+	if err != nil {
+		t.Fatalf("Error marshaling entries: %v", err)
+	}
+	if len(interned)*3 > len(plain) {
+		t.Errorf("Expected interning to shrink %d bytes to a third, got %d", len(plain), len(interned))
+	}
+}
+
+func TestMarshalInternedDynamic(t *testing.T) {
+	profiles := newProfiles(20)
+	interned, err := serialize.MarshalInterned(profiles)
+	if err != nil {
+		t.Fatalf("Error marshaling profiles: %v", err)
+	}
+
+	var dynamic interface{}
+	if err := serialize.Unmarshal(interned, &dynamic); err != nil {
+		t.Fatalf("Error unmarshaling into interface: %v", err)
+	}
+	elements, ok := dynamic.([]interface{})
+	if !ok || len(elements) != len(profiles) {
+		t.Fatalf("Expected %d profiles, got %#v", len(profiles), dynamic)
+	}
+	for i, element := range elements {
+		if profile, ok := element.(map[string]interface{}); !ok || profile["country"] != "Netherlands" || profile["username"] != fmt.Sprintf("user%d", i) {
+			t.Errorf("Unexpected profile %d: %#v", i, element)
+		}
+	}
+
+	var value serialize.Value
+	if err := serialize.Unmarshal(interned, &value); err != nil {
+		t.Fatalf("Error unmarshaling into Value: %v", err)
+	}
+	if !reflect.DeepEqual(value.Interface(), dynamic) {
+		t.Errorf("Expected interned Value to hold %#v, got %#v", dynamic, value.Interface())
+	}
+}
+
+func TestInternedStringsInSkippedFields(t *testing.T) {
+	type full struct {
+		Unknown string `ebe:",id=1"`
+		Known   string `ebe:",id=2"`
+	}
+	type partial struct {
+		Known string `ebe:",id=2"`
+	}
+	shared := "defined in a field that is skipped"
+	data, err := serialize.MarshalInterned(full{Unknown: shared, Known: shared})
+	if err != nil {
+		t.Fatalf("Error marshaling value: %v", err)
+	}
+
+	var out partial
+	if err := serialize.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Error unmarshaling value: %v", err)
+	}
+	if out.Known != shared {
+		t.Errorf("Expected %q, got %q", shared, out.Known)
+	}
+}
+
+func TestInternedStringErrors(t *testing.T) {
+	reference := []byte{types.CreateHeader(types.String, types.StringReference), types.CreateHeader(types.UNibble, 1)}
+	var s string
+	var undefined *serialize.StringReferenceError
+	if err := serialize.Unmarshal(reference, &s); !errors.As(err, &undefined) {
+		t.Errorf("Expected *StringReferenceError for a reference to an undefined string, got %v", err)
+	} else if undefined.Position != 1 || undefined.Defined != 0 || undefined.Offset != 0 {
+		t.Errorf("Expected reference 1 of 0 strings at offset 0, got %+v", undefined)
+	}
+
+	// The second element refers back to the string defined by the first, which is one past the table
+	elements := []byte{types.CreateHeader(types.Array, 2), byte(types.String),
+		types.CreateHeader(types.String, types.StringDefine), types.CreateHeader(types.UNibble, 1), 'x',
+		types.CreateHeader(types.String, types.StringReference), types.CreateHeader(types.UNibble, 1)}
+	var list []string
+	if err := serialize.Unmarshal(elements, &list); !errors.As(err, &undefined) {
+		t.Errorf("Expected *StringReferenceError for an element, got %v", err)
+	} else if undefined.Path != "[1]" || undefined.Defined != 1 || undefined.Offset != 5 {
+		t.Errorf("Expected reference of 1 string at [1] offset 5, got %+v", undefined)
+	}
+	if err := serialize.Unmarshal(reference[:1], &s); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	data, err := serialize.MarshalInterned([]string{"repeated", "repeated"})
+	if err != nil {
+		t.Fatalf("Error marshaling strings: %v", err)
+	}
+	var strings []string
+	var nonCanonical *serialize.NonCanonicalError
+	if err := serialize.UnmarshalWithOptions(data, &strings, serialize.DecodeOptions{Canonical: true}); !errors.As(err, &nonCanonical) {
+		t.Errorf("Expected a NonCanonicalError, got %v", err)
+	}
+	if serialize.IsCanonical(data) {
+		t.Errorf("Expected interned strings not to be canonical")
+	}
+}
+
+func TestEncoderStringTableStream(t *testing.T) {
+	var plain, interned bytes.Buffer
+	plainEncoder := serialize.NewEncoder(&plain)
+	encoder := serialize.NewEncoder(&interned)
+	encoder.SetStringTable(serialize.StringTableStream)
+	entries := newLogRecords(50)
+	for _, entry := range entries {
+		if err := plainEncoder.Encode(entry); err != nil {
+			t.Fatalf("Error encoding entry: %v", err)
+		}
+		if err := encoder.Encode(entry); err != nil {
+			t.Fatalf("Error encoding entry: %v", err)
+		}
+	}
+	if err := plainEncoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	if interned.Len()*2 > plain.Len() {
+		t.Errorf("Expected a shared table to halve %d bytes, got %d", plain.Len(), interned.Len())
+	}
+
+	decoder := serialize.NewDecoder(bytes.NewReader(interned.Bytes()))
+	decoder.SetStringTable(serialize.StringTableStream)
+	for i, entry := range entries {
+		var decoded logRecord
+		if err := decoder.Decode(&decoded); err != nil {
+			t.Fatalf("Error decoding entry %d: %v", i, err)
+		}
+		if decoded != entry {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, entry, decoded)
+		}
+	}
+	var decoded logRecord
+	if err := decoder.Decode(&decoded); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the stream, got %v", err)
+	}
+
+	// Without the shared table, later entries refer to strings that the decoder has forgotten
+	decoder = serialize.NewDecoder(bytes.NewReader(interned.Bytes()))
+	var err error
+	for err == nil {
+		err = decoder.Decode(&decoded)
+	}
+	if err == io.EOF {
+		t.Errorf("Expected an error decoding a shared table stream value by value")
+	}
+}
+
+func TestEncoderStringTablePerValue(t *testing.T) {
+	var stream bytes.Buffer
+	encoder := serialize.NewEncoder(&stream)
+	encoder.SetStringTable(serialize.StringTablePerValue)
+	batches := [][]logRecord{newLogRecords(10), newLogRecords(20)}
+	for _, batch := range batches {
+		if err := encoder.Encode(batch); err != nil {
+			t.Fatalf("Error encoding batch: %v", err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	// Each value has its own table, so it decodes on its own
+	data := stream.Bytes()
+	for i, batch := range batches {
+		n, err := serialize.SkipValueBytes(data)
+		if err != nil {
+			t.Fatalf("Error skipping batch %d: %v", i, err)
+		}
+		var decoded []logRecord
+		if err := serialize.Unmarshal(data[:n], &decoded); err != nil {
+			t.Fatalf("Error unmarshaling batch %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(decoded, batch) {
+			t.Errorf("Batch %d decoded differently", i)
+		}
+		data = data[n:]
+	}
+}
+
+func TestEncoderStringTableReset(t *testing.T) {
+	var first, second bytes.Buffer
+	encoder := serialize.NewEncoder(&first)
+	encoder.SetStringTable(serialize.StringTableStream)
+	entry := logRecord{Level: "information", Service: "authentication", Message: "started"}
+	if err := encoder.Encode(entry); err != nil {
+		t.Fatalf("Error encoding entry: %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+
+	// After a reset the table starts again, so the new stream defines its strings itself
+	encoder.Reset(&second)
+	if err := encoder.Encode(entry); err != nil {
+		t.Fatalf("Error encoding entry: %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Error flushing encoder: %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("Expected the same bytes after Reset, got % x and % x", first.Bytes(), second.Bytes())
+	}
+
+	var decoded logRecord
+	decoder := serialize.NewDecoder(&second)
+	decoder.SetStringTable(serialize.StringTableStream)
+	if err := decoder.Decode(&decoded); err != nil || decoded != entry {
+		t.Errorf("Expected %+v, got %+v (%v)", entry, decoded, err)
+	}
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"reflect"
+	"testing"
+)
+
+// accountV1 is the original schema
+type accountV1 struct {
+	ID    uint64 `ebe:",id=1"`
+	Name  string `ebe:",id=2"`
+	Email string `ebe:",id=3"`
+}
+
+// accountV2 reorders fields, drops Email and adds new fields of several kinds
+type accountV2 struct {
+	Tags    []string          `ebe:",id=5"`
+	Name    string            `ebe:",id=2"`
+	ID      uint64            `ebe:",id=1"`
+	Limits  map[string]int    `ebe:",id=6"`
+	Profile exampleStruct     `ebe:",id=7"`
+	Extra   map[string]string `ebe:",id=8,omitempty"`
+}
+
+type positionalAccount struct {
+	ID    uint64
+	Name  string
+	Email string
+}
+
+func TestTaggedStructRoundTrip(t *testing.T) {
+	original := accountV2{
+		Tags:    []string{"admin", "beta"},
+		Name:    "Ada",
+		ID:      1815,
+		Limits:  map[string]int{"storage": 100},
+		Profile: exampleStruct{A: 1, B: -1, C: "profile", D: true},
+		Extra:   map[string]string{"k": "v"},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling tagged struct: %v", err)
+	}
+	if types.TypeFromHeader(data[0]) != types.Struct || types.ValueFromHeader(data[0]) != 9 {
+		t.Errorf("Expected tagged struct header, got [% x]", data[:1])
+	}
+
+	var decoded accountV2
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling tagged struct: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+}
+
+func TestTaggedStructSchemaEvolution(t *testing.T) {
+	t.Run("old producer, new consumer", func(t *testing.T) {
+		data, err := serialize.Marshal(accountV1{ID: 42, Name: "Grace", Email: "grace@example.com"})
+		if err != nil {
+			t.Fatalf("Error marshaling v1: %v", err)
+		}
+
+		// Unknown Email is skipped and the fields v1 does not know about stay zero
+		decoded := accountV2{Tags: []string{"stale"}}
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling v1 into v2: %v", err)
+		}
+		expected := accountV2{ID: 42, Name: "Grace"}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, decoded)
+		}
+	})
+
+	t.Run("new producer, old consumer", func(t *testing.T) {
+		data, err := serialize.Marshal(accountV2{
+			Tags:    []string{"x", "y"},
+			Name:    "Linus",
+			ID:      7,
+			Limits:  map[string]int{"a": 1, "b": 2},
+			Profile: exampleStruct{A: 9, C: "skipped"},
+			Extra:   map[string]string{"nested": "value"},
+		})
+		if err != nil {
+			t.Fatalf("Error marshaling v2: %v", err)
+		}
+
+		// Arrays, maps and nested structs the old consumer doesn't know are skipped whole
+		var decoded accountV1
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling v2 into v1: %v", err)
+		}
+		expected := accountV1{ID: 7, Name: "Linus"}
+		if decoded != expected {
+			t.Errorf("Expected %+v, got %+v", expected, decoded)
+		}
+	})
+}
+
+func TestTaggedStructOmitEmpty(t *testing.T) {
+	data, err := serialize.Marshal(accountV2{ID: 1})
+	if err != nil {
+		t.Fatalf("Error marshaling tagged struct: %v", err)
+	}
+
+	withExtra, err := serialize.Marshal(accountV2{ID: 1, Extra: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatalf("Error marshaling tagged struct: %v", err)
+	}
+
+	// The omitted field costs nothing at all in the tagged encoding
+	if len(withExtra) <= len(data) {
+		t.Errorf("Expected omitted field to be left out: %d bytes with it, %d without", len(withExtra), len(data))
+	}
+
+	var decoded accountV2
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling tagged struct: %v", err)
+	}
+	if decoded.ID != 1 || decoded.Extra != nil {
+		t.Errorf("Expected ID 1 and nil Extra, got %+v", decoded)
+	}
+}
+
+func TestTaggedStructZeroCountAndID(t *testing.T) {
+	type empty struct {
+		A int    `ebe:",id=1,omitempty"`
+		B string `ebe:",id=2,omitempty"`
+	}
+	type zeroID struct {
+		A int `ebe:",id=0"`
+		B int `ebe:",id=1"`
+	}
+
+	// A count or id of 0 is written as the SNibble 0 that appendUint uses for 0
+	tests := []struct {
+		name  string
+		value interface{}
+		out   interface{}
+	}{
+		{"all fields omitted", empty{}, new(empty)},
+		{"field id 0", zeroID{A: 5, B: 6}, new(zeroID)},
+		{"field id 0 only", struct {
+			A int `ebe:",id=0"`
+		}{A: 5}, new(struct {
+			A int `ebe:",id=0"`
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Error marshaling tagged struct: %v", err)
+			}
+			if err := serialize.Unmarshal(data, tt.out); err != nil {
+				t.Fatalf("Error unmarshaling [% x]: %v", data, err)
+			}
+			if decoded := reflect.ValueOf(tt.out).Elem().Interface(); !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("Expected %+v, got %+v", tt.value, decoded)
+			}
+
+			var dynamic interface{}
+			if err := serialize.Unmarshal(data, &dynamic); err != nil {
+				t.Errorf("Error unmarshaling [% x] into interface: %v", data, err)
+			}
+			var value serialize.Value
+			if err := serialize.Unmarshal(data, &value); err != nil {
+				t.Errorf("Error unmarshaling [% x] into Value: %v", data, err)
+			}
+			if n, err := serialize.SkipValueBytes(data); err != nil || n != len(data) {
+				t.Errorf("Expected to skip %d bytes, got %d (%v)", len(data), n, err)
+			}
+		})
+	}
+}
+
+func TestTaggedStructErrors(t *testing.T) {
+	t.Run("mixed tags", func(t *testing.T) {
+		value := struct {
+			A int `ebe:",id=1"`
+			B int
+		}{}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error for struct mixing tagged and untagged fields, got nil")
+		}
+	})
+
+	t.Run("duplicate ids", func(t *testing.T) {
+		value := struct {
+			A int `ebe:",id=1"`
+			B int `ebe:",id=1"`
+		}{}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error for duplicate field ids, got nil")
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		value := struct {
+			A int `ebe:",id=first"`
+		}{}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error for non-numeric field id, got nil")
+		}
+	})
+
+	t.Run("tagged data into positional struct", func(t *testing.T) {
+		data, err := serialize.Marshal(accountV1{ID: 1, Name: "n", Email: "e"})
+		if err != nil {
+			t.Fatalf("Error marshaling tagged struct: %v", err)
+		}
+		var decoded positionalAccount
+		if err := serialize.Unmarshal(data, &decoded); err == nil {
+			t.Error("Expected error decoding tagged struct into struct without ids, got nil")
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type taggedSkip struct {
+	Keep   int32
+	Secret string `ebe:"-"`
+	Also   bool
+}
+
+type taggedOptional struct {
+	ID       uint32
+	Nickname string            `ebe:",omitempty"`
+	Scores   []int             `ebe:"scores,omitempty"`
+	Labels   map[string]string `ebe:",omitempty"`
+	Parent   exampleStruct     `ebe:",omitempty"`
+}
+
+type auditFields struct {
+	CreatedBy string
+	Version   uint16
+}
+
+type taggedInline struct {
+	auditFields `ebe:",inline"`
+	Name        string
+}
+
+// AuditFields is an exported embedded struct that is serialized as a nested struct unless inlined
+type AuditFields struct {
+	CreatedBy string
+	Version   uint16
+}
+
+type taggedExportedInline struct {
+	AuditFields `ebe:",inline"`
+	Name        string
+}
+
+type flatEquivalent struct {
+	CreatedBy string
+	Version   uint16
+	Name      string
+}
+
+func TestStructTagSkip(t *testing.T) {
+	original := taggedSkip{Keep: -5, Secret: "do not send", Also: true}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	// Only the two untagged fields are counted in the header
+	if types.ValueFromHeader(data[0]) != 2 {
+		t.Errorf("Expected 2 serialized fields, got %d", types.ValueFromHeader(data[0]))
+	}
+
+	decoded := taggedSkip{Secret: "local"}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling struct: %v", err)
+	}
+	if decoded.Keep != original.Keep || decoded.Also != original.Also {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+	if decoded.Secret != "local" {
+		t.Errorf("Expected skipped field to be left untouched, got %q", decoded.Secret)
+	}
+}
+
+func TestStructTagOmitEmpty(t *testing.T) {
+	empty := taggedOptional{ID: 7}
+
+	data, err := serialize.Marshal(empty)
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	// Header, ID nibble and one Null marker for each of the four omitted fields
+	if len(data) != 6 {
+		t.Errorf("Expected 6 bytes for struct with omitted fields, got %d: [% x]", len(data), data)
+	}
+	for i := 2; i < len(data); i++ {
+		if types.TypeFromHeader(data[i]) != types.Null {
+			t.Errorf("Expected Null marker at byte %d, got %s", i, types.TypeNameFromHeader(data[i]))
+		}
+	}
+
+	// Omitted fields decode to their zero values even when the target was populated
+	decoded := taggedOptional{Nickname: "stale", Scores: []int{1}}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling struct: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, empty) {
+		t.Errorf("Expected %+v, got %+v", empty, decoded)
+	}
+
+	full := taggedOptional{
+		ID:       9,
+		Nickname: "nick",
+		Scores:   []int{1, 2, 3},
+		Labels:   map[string]string{"tier": "gold"},
+		Parent:   exampleStruct{A: 1, B: 2, C: "three", D: true},
+	}
+	data, err = serialize.Marshal(full)
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	decoded = taggedOptional{}
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling struct: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, full) {
+		t.Errorf("Expected %+v, got %+v", full, decoded)
+	}
+}
+
+func TestStructTagInline(t *testing.T) {
+	original := taggedExportedInline{
+		AuditFields: AuditFields{CreatedBy: "admin", Version: 3},
+		Name:        "inlined",
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+
+	// The inlined struct is flattened, so the encoding matches a struct with the same fields
+	flat, err := serialize.Marshal(flatEquivalent{CreatedBy: "admin", Version: 3, Name: "inlined"})
+	if err != nil {
+		t.Fatalf("Error marshaling flat struct: %v", err)
+	}
+	if !reflect.DeepEqual(data, flat) {
+		t.Errorf("Expected inlined encoding [% x] to match flat encoding [% x]", data, flat)
+	}
+
+	var decoded taggedExportedInline
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling struct: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+
+	// Unexported embedded structs are not serialized even when tagged inline
+	data, err = serialize.Marshal(taggedInline{auditFields: auditFields{CreatedBy: "x"}, Name: "only"})
+	if err != nil {
+		t.Fatalf("Error marshaling struct: %v", err)
+	}
+	if types.ValueFromHeader(data[0]) != 1 {
+		t.Errorf("Expected 1 serialized field, got %d", types.ValueFromHeader(data[0]))
+	}
+}
+
+func TestStructTagNameAndErrors(t *testing.T) {
+	t.Run("tag name used in errors", func(t *testing.T) {
+		value := struct {
+			Ch chan int `ebe:"updates"`
+		}{Ch: make(chan int)}
+
+		_, err := serialize.Marshal(value)
+		if err == nil {
+			t.Fatal("Expected error marshaling channel field, got nil")
+		}
+		if !strings.Contains(err.Error(), "updates") {
+			t.Errorf("Expected error to mention tag name, got %v", err)
+		}
+	})
+
+	t.Run("unknown option", func(t *testing.T) {
+		value := struct {
+			A int `ebe:",omitempyt"`
+		}{A: 1}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error for unknown tag option, got nil")
+		}
+	})
+
+	t.Run("inline non-struct", func(t *testing.T) {
+		value := struct {
+			A int `ebe:",inline"`
+		}{A: 1}
+		if _, err := serialize.Marshal(value); err == nil {
+			t.Error("Expected error for inline on non-struct field, got nil")
+		}
+	})
+}
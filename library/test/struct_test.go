@@ -3,6 +3,7 @@ package test
 import (
 	"bytes"
 	"ebe/serialize"
+	"ebe/types"
 	"ebe/utils"
 	"fmt"
 	"math"
@@ -327,12 +328,13 @@ func TestStructSerializationErrors(t *testing.T) {
 		var nilPtr *exampleStruct
 		var buf bytes.Buffer
 
+		// A nil pointer is not an error, it is written as a single Null marker
 		err := serialize.Serialize(nilPtr, &buf)
-		if err == nil {
-			t.Error("Expected error when serializing nil pointer, got nil")
+		if err != nil {
+			t.Fatalf("Expected nil pointer to serialize as Null, got error: %v", err)
 		}
-		if err != nil && err.Error() != "cannot serialize nil pointer" {
-			t.Errorf("Expected specific nil pointer error, got: %v", err)
+		if buf.Len() != 1 || types.TypeFromHeader(buf.Bytes()[0]) != types.Null {
+			t.Errorf("Expected single Null header, got [% x]", buf.Bytes())
 		}
 	})
 
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"ebe/serialize"
+	"ebe/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type logEntry struct {
+	Timestamp time.Time
+	Level     string
+	Elapsed   time.Duration
+	Deadline  *time.Time
+	Timeouts  []time.Duration
+	Data      map[string]interface{}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input time.Time
+		kind  byte
+	}{
+		{"zero", time.Time{}, types.ExtendedTime},
+		{"unix epoch", time.Unix(0, 0).UTC(), types.ExtendedTime},
+		{"utc with nanoseconds", time.Date(2024, time.February, 29, 23, 59, 59, 999999999, time.UTC), types.ExtendedTime},
+		{"before epoch", time.Date(1969, time.July, 20, 20, 17, 40, 0, time.UTC), types.ExtendedTime},
+		{"positive offset", time.Date(2024, time.March, 14, 15, 9, 26, 535897932, time.FixedZone("UTC+2", 2*60*60)), types.ExtendedTimeOffset},
+		{"negative offset", time.Date(2000, time.January, 1, 0, 0, 0, 0, time.FixedZone("", -(9*60*60 + 30*60))), types.ExtendedTimeOffset},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := serialize.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("Error marshaling time: %v", err)
+			}
+			if types.TypeFromHeader(data[0]) != types.Extended || types.ValueFromHeader(data[0]) != tc.kind {
+				t.Fatalf("Expected Extended %s header, got [% x]", types.ExtendedName(tc.kind), data[:1])
+			}
+
+			var decoded time.Time
+			if err := serialize.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling time: %v", err)
+			}
+			if !decoded.Equal(tc.input) {
+				t.Errorf("Expected %v, got %v", tc.input, decoded)
+			}
+
+			// The offset from UTC is preserved along with the instant
+			_, expectedOffset := tc.input.Zone()
+			if _, offset := decoded.Zone(); offset != expectedOffset {
+				t.Errorf("Expected zone offset %d, got %d", expectedOffset, offset)
+			}
+		})
+	}
+
+	// UTC times and the zero time decode to values identical to the originals
+	for _, original := range []time.Time{{}, time.Date(2023, time.May, 5, 5, 5, 5, 5, time.UTC)} {
+		data, _ := serialize.Marshal(original)
+		var decoded time.Time
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling time: %v", err)
+		}
+		if decoded != original {
+			t.Errorf("Expected identical %#v, got %#v", original, decoded)
+		}
+	}
+}
+
+func TestTimeCompactEncoding(t *testing.T) {
+	data, err := serialize.Marshal(time.Unix(1700000000, 0).UTC())
+	if err != nil {
+		t.Fatalf("Error marshaling time: %v", err)
+	}
+
+	// Header, 4-byte SInt seconds and a nibble for zero nanoseconds
+	if len(data) != 7 {
+		t.Errorf("Expected 7 bytes, got %d: [% x]", len(data), data)
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	for _, original := range []time.Duration{0, time.Nanosecond, -5 * time.Second, 90 * time.Minute, time.Duration(1<<63 - 1)} {
+		data, err := serialize.Marshal(original)
+		if err != nil {
+			t.Fatalf("Error marshaling duration %v: %v", original, err)
+		}
+		if types.TypeFromHeader(data[0]) != types.Extended || types.ValueFromHeader(data[0]) != types.ExtendedDuration {
+			t.Fatalf("Expected Extended Duration header, got [% x]", data[:1])
+		}
+
+		var decoded time.Duration
+		if err := serialize.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling duration %v: %v", original, err)
+		}
+		if decoded != original {
+			t.Errorf("Expected %v, got %v", original, decoded)
+		}
+	}
+}
+
+func TestTimeNested(t *testing.T) {
+	deadline := time.Date(2025, time.December, 1, 9, 0, 0, 0, time.UTC)
+	original := logEntry{
+		Timestamp: time.Date(2025, time.November, 30, 12, 0, 0, 123000000, time.UTC),
+		Level:     "INFO",
+		Elapsed:   1500 * time.Millisecond,
+		Deadline:  &deadline,
+		Timeouts:  []time.Duration{time.Second, time.Minute},
+		Data: map[string]interface{}{
+			"received": time.Date(2025, time.November, 30, 11, 59, 59, 0, time.UTC),
+			"latency":  250 * time.Microsecond,
+		},
+	}
+
+	data, err := serialize.Marshal(original)
+	if err != nil {
+		t.Fatalf("Error marshaling logEntry: %v", err)
+	}
+
+	var decoded logEntry
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling logEntry: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+
+	// Slices of times declare the Extended element type
+	data, err = serialize.Marshal([]time.Time{deadline, deadline.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Error marshaling []time.Time: %v", err)
+	}
+	if elementType := types.Types(data[1]); elementType != types.Extended {
+		t.Errorf("Expected Extended element type, got %s", types.TypeName(elementType))
+	}
+	var times []time.Time
+	if err := serialize.Unmarshal(data, &times); err != nil {
+		t.Fatalf("Error unmarshaling []time.Time: %v", err)
+	}
+	if len(times) != 2 || !times[0].Equal(deadline) || !times[1].Equal(deadline.Add(time.Hour)) {
+		t.Errorf("Expected [%v %v], got %v", deadline, deadline.Add(time.Hour), times)
+	}
+}
+
+func TestTimeFromBinaryMarshaler(t *testing.T) {
+	original := time.Date(2022, time.August, 8, 8, 8, 8, 8, time.UTC)
+
+	// Times written as MarshalBinary buffers before the native encoding still decode
+	binary, err := original.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Error from MarshalBinary: %v", err)
+	}
+	data, err := serialize.Marshal(binary)
+	if err != nil {
+		t.Fatalf("Error marshaling buffer: %v", err)
+	}
+
+	var decoded time.Time
+	if err := serialize.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling buffer into time: %v", err)
+	}
+	if !decoded.Equal(original) {
+		t.Errorf("Expected %v, got %v", original, decoded)
+	}
+}
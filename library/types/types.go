@@ -3,37 +3,116 @@ package types
 type Types uint8
 
 const (
-	UNibble Types = 0
-	SNibble Types = 1
-	SInt    Types = 2
-	UInt    Types = 3
-	Float   Types = 4
-	Complex Types = 5
-	Boolean Types = 6
-	String  Types = 7
-	Buffer  Types = 8
-	Array   Types = 9
-	Json    Types = 10
-	Map     Types = 11
-	Struct  Types = 12
+	UNibble  Types = 0
+	SNibble  Types = 1
+	SInt     Types = 2
+	UInt     Types = 3
+	Float    Types = 4
+	Complex  Types = 5
+	Boolean  Types = 6
+	String   Types = 7
+	Buffer   Types = 8
+	Array    Types = 9
+	Json     Types = 10
+	Map      Types = 11
+	Struct   Types = 12
+	Null     Types = 13
+	Extended Types = 14
+
+	// Mixed is only used as the element type of an Array whose elements may each have a different type,
+	// such as a []interface{}. Every element still carries its own header, so no value header has this type.
+	// The element type takes a whole byte, so Mixed lies beyond the header type nibble and leaves type 15 free.
+	Mixed Types = 16
+)
+
+// Extended values carry one of these kinds in the header value nibble
+const (
+	ExtendedTime       byte = 0 // SInt seconds, UInt nanoseconds, UTC
+	ExtendedTimeOffset byte = 1 // SInt seconds, UInt nanoseconds, SInt zone offset in seconds
+	ExtendedDuration   byte = 2 // SInt nanoseconds
+	ExtendedTyped      byte = 3 // UInt registered type id, then the value
+)
+
+// An Array with this header value is packed: the UInt element count and the element type are followed
+// by a packing byte and the elements as raw data without headers. Only SInt, UInt, Float and Boolean elements are packed,
+// and Extended elements with a delta packing, which are UTC times as SInt nanoseconds since the Unix epoch.
+const ArrayPacked byte = 9
+
+// The packing byte of a packed array is the width in bytes of every element, from 1 to 8, or one of these
+// Fixed width elements are little-endian, SInt elements in two's complement and Float elements 4 or 8 bytes wide
+const (
+	PackedVarint       byte = 0  // LEB128 varints, with SInt elements zigzag encoded first
+	PackedDelta        byte = 9  // The first element as a varint, then the zigzag varint difference from the previous element
+	PackedDeltaOfDelta byte = 10 // The first element and the first difference, then the zigzag varint change in difference
+	PackedBits         byte = 11 // Boolean elements as bits, eight to a byte from the lowest bit, with unused bits zero
+)
+
+// String values with one of these header values go through a table of strings that the decoder rebuilds as it reads.
+// Strings are added to the end of the table by definitions, in the order they are read, and referred to by position.
+const (
+	StringDefine    byte = 9  // UInt length and the string, which is then added to the table
+	StringReference byte = 10 // UInt position in the table of a string defined earlier
 )
 
+// Float values carry one of these forms in the header value nibble
+// Only the half, single and double forms are followed by data bytes, which are little-endian
+const (
+	FloatZero         byte = 0 // +0
+	FloatNegativeZero byte = 1 // -0
+	FloatHalf         byte = 2 // IEEE 754 half precision in 2 bytes, only written by encoders that ask for it
+	FloatNaN          byte = 3
+	FloatSingle       byte = 4 // float32 in 4 bytes
+	FloatInf          byte = 5 // +Inf
+	FloatNegativeInf  byte = 6 // -Inf
+	FloatMinusOne     byte = 7 // -1
+	FloatDouble       byte = 8 // float64 in 8 bytes
+	FloatSmallInt     byte = 9 // 9 to 15 hold the integers 1 to 7
+)
+
+// FloatDataSize returns the number of data bytes that follow a Float header with the given value nibble
+func FloatDataSize(form byte) int {
+	switch form {
+	case FloatHalf:
+		return 2
+	case FloatSingle:
+		return 4
+	case FloatDouble:
+		return 8
+	default:
+		return 0
+	}
+}
+
+var ExtendedNames = map[byte]string{
+	ExtendedTime:       "Time",
+	ExtendedTimeOffset: "TimeOffset",
+	ExtendedDuration:   "Duration",
+	ExtendedTyped:      "Typed",
+}
+
 var TypeNames = map[Types]string{
-	UNibble: "UNibble",
-	SNibble: "SNibble",
-	SInt:    "SInt",
-	UInt:    "UInt",
-	Float:   "Float",
-	Complex: "Complex",
-	Boolean: "Boolean",
-	String:  "String",
-	Buffer:  "Buffer",
-	Array:   "Array",
-	Json:    "Json",
-	Map:     "Map",
-	Struct:  "Struct",
+	UNibble:  "UNibble",
+	SNibble:  "SNibble",
+	SInt:     "SInt",
+	UInt:     "UInt",
+	Float:    "Float",
+	Complex:  "Complex",
+	Boolean:  "Boolean",
+	String:   "String",
+	Buffer:   "Buffer",
+	Array:    "Array",
+	Json:     "Json",
+	Map:      "Map",
+	Struct:   "Struct",
+	Null:     "Null",
+	Extended: "Extended",
+	Mixed:    "Mixed",
 }
 
 func TypeName(typeValue Types) string {
 	return TypeNames[typeValue]
 }
+
+func ExtendedName(kind byte) string {
+	return ExtendedNames[kind]
+}
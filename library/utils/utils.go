@@ -3,14 +3,21 @@ package utils
 import (
 	"bytes"
 	"ebe/types"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"strings"
 )
 
 // ReadByte reads a single byte from an io.Reader
+// Readers that implement io.ByteReader are read directly to avoid allocating a buffer per byte
 func ReadByte(r io.Reader) (byte, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+
 	buf := make([]byte, 1)
 	n, err := r.Read(buf)
 	if err != nil {
@@ -36,7 +43,12 @@ func ReadHeader(r io.Reader) (types.Types, uint8, error) {
 }
 
 // WriteByte writes a single byte to an io.Writer
+// Writers that implement io.ByteWriter are written directly to avoid allocating a buffer per byte
 func WriteByte(w io.Writer, b byte) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return bw.WriteByte(b)
+	}
+
 	buf := []byte{b}
 	n, err := w.Write(buf)
 	if err != nil {
@@ -185,124 +197,295 @@ func compareFloats(a, b interface{}) bool {
 }
 
 // PrintSerializedData takes a byte array and prints out each serialized type and value
+// Arrays, maps, structs and extended values are walked recursively and their contents printed indented below them
 func PrintSerializedData(data []byte) {
 	fmt.Printf("Parsing %d bytes of serialized data: [% x]\n", len(data), data)
 
-	remaining := data
+	offset := 0
 	valueIndex := 0
 
-	for len(remaining) > 0 {
-		fmt.Printf("[%d] ", valueIndex)
-
-		// Parse the header
-		header := remaining[0]
-		headerType := types.TypeFromHeader(header)
-		headerValue := types.ValueFromHeader(header)
-
-		fmt.Printf("Type: %s, Value: %d", types.TypeName(headerType), headerValue)
-
-		// Move past the header
-		remaining = remaining[1:]
-
-		// Estimate how many bytes this value uses based on type and header value
-		var bytesToSkip int
-		switch headerType {
-
-		case types.UNibble, types.SNibble, types.Boolean:
-			// These store their value in the header nibble
-			bytesToSkip = 0
-
-		case types.UInt, types.SInt:
-			// These use the header value as the length
-			bytesToSkip = int(headerValue)
-
-		case types.Float:
-			// Float uses header value as length (4 or 8 bytes typically)
-			bytesToSkip = int(headerValue)
-
-		case types.String, types.Buffer:
-
-			if headerValue&0x08 != 0 {
-
-				// Length stored as separate UInt - need to parse it
-				if len(remaining) > 0 {
-
-					lengthHeader := remaining[0]
-					lengthBytes := int(types.ValueFromHeader(lengthHeader))
-					if len(remaining) >= 1+lengthBytes {
-						// Parse the actual length
-						var actualLength uint64 = 0
-						for i := 1; i <= lengthBytes; i++ {
-							actualLength |= uint64(remaining[i]) << (8 * (lengthBytes - (i - 1) - 1))
-						}
-						bytesToSkip = 1 + lengthBytes + int(actualLength)
-						fmt.Printf(", Length bytes: %d, Actual length: %d", lengthBytes, actualLength)
-					} else {
-						bytesToSkip = len(remaining) // Skip rest if malformed
-					}
-				} else {
-					bytesToSkip = 0
-				}
-			} else {
-				// Length stored in header
-				bytesToSkip = int(headerValue)
-			}
+	for offset < len(data) {
+		next, err := printValue(data, offset, 0, fmt.Sprintf("[%d]", valueIndex))
+		if err != nil {
+			fmt.Printf("Stopping at offset %d: %v\n", offset, err)
+			break
+		}
+		offset = next
+		valueIndex++
+	}
+
+	fmt.Printf("Parsed %d values total\n", valueIndex)
+}
+
+// printValue prints the value starting at offset, and everything it contains, and returns the offset after it
+func printValue(data []byte, offset int, depth int, label string) (int, error) {
+	if offset >= len(data) {
+		return offset, fmt.Errorf("missing value for %s", label)
+	}
+
+	header := data[offset]
+	headerType := types.TypeFromHeader(header)
+	headerValue := types.ValueFromHeader(header)
+	offset++
+
+	indent := strings.Repeat("  ", depth)
+	fmt.Printf("%s%s Type: %s, Value: %d", indent, label, types.TypeName(headerType), headerValue)
 
-		case types.Array:
-			// Array format: header, [length if > 7], element_type, then elements
-			var arrayLength uint64 = uint64(headerValue)
-			elementTypeBytes := 1 // Always 1 byte for element type
-
-			if headerValue&0x08 != 0 {
-				// Length stored as separate UInt - need to parse it
-				if len(remaining) > 0 {
-					lengthHeader := remaining[0]
-					lengthBytes := int(types.ValueFromHeader(lengthHeader))
-					if len(remaining) >= 1+lengthBytes {
-						// Parse the actual length
-						arrayLength = 0
-						for i := 1; i <= lengthBytes; i++ {
-							arrayLength |= uint64(remaining[i]) << (8 * (lengthBytes - (i - 1) - 1))
-						}
-						elementTypeBytes += 1 + lengthBytes
-						fmt.Printf(", Length bytes: %d, Array length: %d", lengthBytes, arrayLength)
-					}
-				}
+	// printChildren prints count nested values, labelled by their position
+	printChildren := func(count uint64, name string) (int, error) {
+		fmt.Println()
+		var err error
+		for i := uint64(0); i < count; i++ {
+			if offset, err = printValue(data, offset, depth+1, fmt.Sprintf("%s %d", name, i)); err != nil {
+				return offset, err
 			}
+		}
+		return offset, nil
+	}
 
-			// For arrays, we just skip the element type byte and let the elements be parsed individually
-			bytesToSkip = elementTypeBytes
-			if len(remaining) >= elementTypeBytes {
-				elementType := types.Types(remaining[elementTypeBytes-1])
-				fmt.Printf(", Element type: %s", types.TypeName(elementType))
+	switch headerType {
+
+	case types.UNibble, types.SNibble, types.Boolean, types.Null:
+		// These store their value in the header nibble
+		fmt.Println()
+		return offset, nil
+
+	case types.UInt, types.SInt:
+		// These use the header value as the length
+		return printData(data, offset, int(headerValue))
+
+	case types.Float:
+		// Only some float forms have data bytes
+		return printData(data, offset, types.FloatDataSize(headerValue))
+
+	case types.Complex:
+		// Complex uses header value as the width of each part, real then imaginary
+		remaining := data[offset:]
+		if headerValue == 4 && len(remaining) >= 8 {
+			re := math.Float32frombits(binary.LittleEndian.Uint32(remaining[0:4]))
+			im := math.Float32frombits(binary.LittleEndian.Uint32(remaining[4:8]))
+			fmt.Printf(", Complex: %v", complex(re, im))
+		} else if headerValue == 8 && len(remaining) >= 16 {
+			re := math.Float64frombits(binary.LittleEndian.Uint64(remaining[0:8]))
+			im := math.Float64frombits(binary.LittleEndian.Uint64(remaining[8:16]))
+			fmt.Printf(", Complex: %v", complex(re, im))
+		}
+		return printData(data, offset, 2*int(headerValue))
+
+	case types.String, types.Buffer:
+		if headerType == types.String && headerValue == types.StringReference {
+			position, next, err := readPrintedUint(data, offset)
+			if err != nil {
+				fmt.Println()
+				return next, err
+			}
+			fmt.Printf(", Reference: %d", position)
+			fmt.Println()
+			return next, nil
+		}
+		if headerType == types.String && headerValue == types.StringDefine {
+			fmt.Printf(", Defined")
+		}
+		length := uint64(headerValue)
+		if headerValue&0x08 != 0 {
+			var err error
+			if length, offset, err = readPrintedUint(data, offset); err != nil {
+				fmt.Println()
+				return offset, err
 			}
+		}
+		fmt.Printf(", Length: %d", length)
+		if headerType == types.String && uint64(len(data)-offset) >= length {
+			fmt.Printf(", String: %q", data[offset:offset+int(length)])
+		}
+		return printData(data, offset, int(length))
+
+	case types.Json:
+		// Length always follows as a UInt
+		length, next, err := readPrintedUint(data, offset)
+		if err != nil {
+			fmt.Println()
+			return next, err
+		}
+		fmt.Printf(", Length: %d", length)
+		return printData(data, next, int(length))
+
+	case types.Array:
+		// Array format: header, [length if > 7], element type, then elements
+		length := uint64(headerValue)
+		if headerValue&0x08 != 0 {
+			var err error
+			if length, offset, err = readPrintedUint(data, offset); err != nil {
+				fmt.Println()
+				return offset, err
+			}
+		}
+		if offset >= len(data) {
+			fmt.Println()
+			return offset, fmt.Errorf("missing array element type")
+		}
+		fmt.Printf(", Length: %d, Element type: %s", length, types.TypeName(types.Types(data[offset])))
+		offset++
+		if headerValue != types.ArrayPacked {
+			return printChildren(length, "element")
+		}
+
+		// Packed elements have no headers and are printed as one block of data
+		if offset >= len(data) {
+			fmt.Println()
+			return offset, fmt.Errorf("missing array packing")
+		}
+		width := data[offset]
+		offset++
+		if width >= 1 && width <= 8 {
+			fmt.Printf(", Packed width: %d", width)
+			return printData(data, offset, int(length)*int(width))
+		}
+		if width == types.PackedBits {
+			fmt.Printf(", Packed: bits")
+			return printData(data, offset, int((length+7)/8))
+		}
+		switch width {
+		case types.PackedDelta:
+			fmt.Printf(", Packed: delta")
+		case types.PackedDeltaOfDelta:
+			fmt.Printf(", Packed: delta of delta")
 		default:
-			// Unknown type, skip 1 byte and continue
-			bytesToSkip = 1
+			fmt.Printf(", Packed: varint")
+		}
+		size := 0
+		for i := uint64(0); i < length; i++ {
+			for offset+size < len(data) && data[offset+size] >= 0x80 {
+				size++
+			}
+			size++
+		}
+		return printData(data, offset, size)
+
+	case types.Map:
+		count := uint64(headerValue)
+		if headerValue == 8 {
+			var err error
+			if count, offset, err = readPrintedUint(data, offset); err != nil {
+				fmt.Println()
+				return offset, err
+			}
+		}
+		fmt.Printf(", Entries: %d", count)
+		fmt.Println()
+		var err error
+		for i := uint64(0); i < count; i++ {
+			if offset, err = printValue(data, offset, depth+1, fmt.Sprintf("key %d", i)); err != nil {
+				return offset, err
+			}
+			if offset, err = printValue(data, offset, depth+1, fmt.Sprintf("value %d", i)); err != nil {
+				return offset, err
+			}
+		}
+		return offset, nil
+
+	case types.Struct:
+		count := uint64(headerValue)
+		if headerValue == 8 || headerValue == 9 {
+			var err error
+			if count, offset, err = readPrintedUint(data, offset); err != nil {
+				fmt.Println()
+				return offset, err
+			}
+		}
+		fmt.Printf(", Fields: %d", count)
+		if headerValue != 9 {
+			return printChildren(count, "field")
 		}
 
-		// Print the data bytes if any
-		if bytesToSkip > 0 {
-			if len(remaining) >= bytesToSkip {
-				fmt.Printf(", Data (%d bytes): [% x]", bytesToSkip, remaining[:bytesToSkip])
-				remaining = remaining[bytesToSkip:]
-			} else {
-				fmt.Printf(", Data (remaining %d bytes): [% x]", len(remaining), remaining)
-				remaining = nil
+		// Tagged structs prefix every field with its id
+		fmt.Println(", Tagged")
+		for i := uint64(0); i < count; i++ {
+			id, next, err := readPrintedUint(data, offset)
+			if err != nil {
+				return next, err
+			}
+			if offset, err = printValue(data, next, depth+1, fmt.Sprintf("field id %d", id)); err != nil {
+				return offset, err
 			}
 		}
+		return offset, nil
+
+	case types.Extended:
+		// Extended values are followed by their parts, which are printed as individual values
+		fmt.Printf(", Kind: %s", types.ExtendedName(headerValue))
+		switch headerValue {
+		case types.ExtendedTime:
+			return printChildren(2, "part")
+		case types.ExtendedTimeOffset:
+			return printChildren(3, "part")
+		case types.ExtendedDuration:
+			return printChildren(1, "part")
+		case types.ExtendedTyped:
+			id, next, err := readPrintedUint(data, offset)
+			if err != nil {
+				fmt.Println()
+				return next, err
+			}
+			fmt.Printf(", Type id: %d", id)
+			offset = next
+			return printChildren(1, "typed value")
+		default:
+			fmt.Println()
+			return offset, fmt.Errorf("unknown extended kind %d", headerValue)
+		}
 
+	default:
 		fmt.Println()
-		valueIndex++
+		return offset, fmt.Errorf("unknown type %d", headerType)
+	}
+}
 
-		// Safety check to prevent infinite loops
-		if valueIndex > 100 {
-			fmt.Println("Stopping after 100 values to prevent infinite loop")
-			break
-		}
+// printData prints the n data bytes at offset and returns the offset after them
+func printData(data []byte, offset int, n int) (int, error) {
+	if n > len(data)-offset {
+		fmt.Printf(", Data (remaining %d of %d bytes): [% x]\n", len(data)-offset, n, data[offset:])
+		return len(data), fmt.Errorf("value truncated")
 	}
+	if n > 0 {
+		fmt.Printf(", Data (%d bytes): [% x]", n, data[offset:offset+n])
+	}
+	fmt.Println()
+	return offset + n, nil
+}
 
-	fmt.Printf("Parsed %d values total\n", valueIndex)
+// readPrintedUint reads a length, count or id encoded as a UInt at offset and returns it with the offset after it
+func readPrintedUint(data []byte, offset int) (uint64, int, error) {
+	if offset >= len(data) {
+		return 0, offset, fmt.Errorf("missing length")
+	}
+
+	header := data[offset]
+	headerType := types.TypeFromHeader(header)
+	headerValue := types.ValueFromHeader(header)
+	offset++
+
+	switch headerType {
+	case types.UNibble:
+		return uint64(headerValue), offset, nil
+	case types.SNibble:
+		if headerValue != 0 {
+			return 0, offset, fmt.Errorf("expected UInt length, got SNibble %d", headerValue)
+		}
+		return 0, offset, nil
+	case types.UInt:
+		length := int(headerValue)
+		if length > 8 || length > len(data)-offset {
+			return 0, len(data), fmt.Errorf("truncated UInt length")
+		}
+		var value uint64
+		for _, b := range data[offset : offset+length] {
+			value = value<<8 | uint64(b)
+		}
+		return value, offset + length, nil
+	default:
+		return 0, offset, fmt.Errorf("expected UInt length, got %s", types.TypeName(headerType))
+	}
 }
 
 // SetValueWithConversion sets a reflect.Value with type conversion support